@@ -0,0 +1,91 @@
+package konfig
+
+import (
+	"sort"
+	"time"
+)
+
+// debouncer delays changes to files until no more changes are received for every file within a window,
+// so a file written in several chunks is read once it is completely written.
+// It is not safe for concurrent use and should be used by the goroutine watching the files.
+type debouncer struct {
+	window  time.Duration
+	pending map[string]time.Time
+	timer   *time.Timer
+}
+
+func newDebouncer(window time.Duration) *debouncer {
+	return &debouncer{
+		window:  window,
+		pending: map[string]time.Time{},
+	}
+}
+
+// add delays changes to a list of files until the window for every file is passed.
+// Every change to a file restarts the window for the file.
+// If there is no window, it returns the files right away; otherwise, it returns nil.
+func (d *debouncer) add(paths []string) []string {
+	if d.window <= 0 {
+		return paths
+	}
+
+	deadline := time.Now().Add(d.window)
+	for _, path := range paths {
+		d.pending[path] = deadline
+	}
+
+	d.reset()
+
+	return nil
+}
+
+// C returns a channel that receives once the window for a file is passed.
+// It returns nil if no change is pending, so receiving from it blocks forever.
+func (d *debouncer) C() <-chan time.Time {
+	if d.timer == nil {
+		return nil
+	}
+	return d.timer.C
+}
+
+// due returns the sorted list of files that their windows are passed.
+func (d *debouncer) due() []string {
+	now := time.Now()
+	paths := []string{}
+
+	for path, deadline := range d.pending {
+		if !deadline.After(now) {
+			paths = append(paths, path)
+			delete(d.pending, path)
+		}
+	}
+
+	d.reset()
+	sort.Strings(paths)
+
+	return paths
+}
+
+// reset sets the timer to the earliest window among the pending files.
+func (d *debouncer) reset() {
+	d.stop()
+
+	var earliest time.Time
+	for _, deadline := range d.pending {
+		if earliest.IsZero() || deadline.Before(earliest) {
+			earliest = deadline
+		}
+	}
+
+	if !earliest.IsZero() {
+		d.timer = time.NewTimer(time.Until(earliest))
+	}
+}
+
+// stop stops the timer and pending changes are not returned anymore.
+func (d *debouncer) stop() {
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+}
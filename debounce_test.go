@@ -0,0 +1,85 @@
+package konfig
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebouncer(t *testing.T) {
+	t.Run("NoWindow", func(t *testing.T) {
+		d := newDebouncer(0)
+
+		assert.Equal(t, []string{"a", "b"}, d.add([]string{"a", "b"}))
+		assert.Nil(t, d.C())
+	})
+
+	t.Run("Window", func(t *testing.T) {
+		d := newDebouncer(50 * time.Millisecond)
+		defer d.stop()
+
+		assert.Nil(t, d.C())
+		assert.Nil(t, d.add([]string{"b", "a"}))
+		assert.NotNil(t, d.C())
+
+		select {
+		case <-d.C():
+			assert.Equal(t, []string{"a", "b"}, d.due())
+			assert.Nil(t, d.C())
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for debouncer")
+		}
+	})
+
+	t.Run("WindowRestarted", func(t *testing.T) {
+		d := newDebouncer(100 * time.Millisecond)
+		defer d.stop()
+
+		start := time.Now()
+		d.add([]string{"a"})
+		time.Sleep(60 * time.Millisecond)
+		d.add([]string{"a"})
+
+		select {
+		case <-d.C():
+			assert.Equal(t, []string{"a"}, d.due())
+			assert.True(t, time.Since(start) >= 160*time.Millisecond)
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for debouncer")
+		}
+	})
+
+	t.Run("SeparateWindows", func(t *testing.T) {
+		d := newDebouncer(100 * time.Millisecond)
+		defer d.stop()
+
+		d.add([]string{"a"})
+		time.Sleep(60 * time.Millisecond)
+		d.add([]string{"b"})
+
+		select {
+		case <-d.C():
+			assert.Equal(t, []string{"a"}, d.due())
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for debouncer")
+		}
+
+		select {
+		case <-d.C():
+			assert.Equal(t, []string{"b"}, d.due())
+			assert.Nil(t, d.C())
+		case <-time.After(time.Second):
+			t.Fatal("timed out waiting for debouncer")
+		}
+	})
+
+	t.Run("Stopped", func(t *testing.T) {
+		d := newDebouncer(50 * time.Millisecond)
+
+		d.add([]string{"a"})
+		d.stop()
+
+		assert.Nil(t, d.C())
+	})
+}
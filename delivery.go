@@ -0,0 +1,183 @@
+package konfig
+
+import "sync"
+
+// DeliveryPolicy determines what happens when a subscriber does not keep up with updates.
+type DeliveryPolicy int
+
+const (
+	// Block waits for the subscriber to make room for new updates, so watching is slowed down to the pace of the slowest subscriber.
+	Block DeliveryPolicy = iota + 1
+	// DropOldest drops the oldest update not yet received by the subscriber to make room for a new update.
+	DropOldest
+	// Coalesce replaces an update not yet received by the subscriber with a new update for the same field.
+	// The subscriber receives the latest value of every field with the value of the field before the first replaced update as the old value.
+	// Since there is at most one update per field waiting, the queue size is not used.
+	Coalesce
+)
+
+func (p DeliveryPolicy) String() string {
+	switch p {
+	case Block:
+		return "block"
+	case DropOldest:
+		return "drop-oldest"
+	case Coalesce:
+		return "coalesce"
+	default:
+		return "unknown"
+	}
+}
+
+// dispatcher delivers updates to a subscriber channel in order using a queue.
+type dispatcher struct {
+	c      *controller
+	id     int
+	ch     chan Update
+	policy DeliveryPolicy
+	size   int
+
+	mu       sync.Mutex
+	cond     *sync.Cond
+	queue    []Update
+	closed   bool
+	stopping chan struct{}
+	done     chan struct{}
+}
+
+func newDispatcher(c *controller, id int, ch chan Update, policy DeliveryPolicy, size int) *dispatcher {
+	// A queue should have room for at least one update
+	if size < 1 {
+		size = 1
+	}
+
+	d := &dispatcher{
+		c:        c,
+		id:       id,
+		ch:       ch,
+		policy:   policy,
+		size:     size,
+		stopping: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+
+	d.cond = sync.NewCond(&d.mu)
+	go d.run()
+
+	return d
+}
+
+// push queues an update for the subscriber based on the delivery policy.
+// If wait is false, the update is queued even if the queue is full, so pushing never blocks.
+// Updates pushed once the dispatcher is shut down are discarded.
+func (d *dispatcher) push(update Update, wait bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.closed {
+		d.c.log(4, "[%s] subscriber %d is closed", update.Path, d.id)
+		return
+	}
+
+	switch d.policy {
+	case Coalesce:
+		for i, queued := range d.queue {
+			if queued.Path == update.Path {
+				d.drop(queued)
+				update.OldValue = queued.OldValue
+				d.queue[i] = update
+				return
+			}
+		}
+
+	case DropOldest:
+		if len(d.queue) >= d.size {
+			d.drop(d.queue[0])
+			d.queue = d.queue[1:]
+		}
+
+	default:
+		for wait && len(d.queue) >= d.size && !d.closed {
+			d.cond.Wait()
+		}
+
+		if d.closed {
+			d.c.log(4, "[%s] subscriber %d is closed", update.Path, d.id)
+			return
+		}
+	}
+
+	d.queue = append(d.queue, update)
+	d.cond.Broadcast()
+}
+
+// drop reports an update that will not be received by the subscriber.
+func (d *dispatcher) drop(update Update) {
+	d.c.log(1, "[%s] update dropped for subscriber %d: %s", update.Path, d.id, update)
+
+	if d.c.onDrop != nil {
+		d.c.onDrop(update)
+	}
+}
+
+// run sends queued updates to the subscriber channel one at a time until the dispatcher is closed and the queue is empty.
+func (d *dispatcher) run() {
+	defer close(d.done)
+
+	for {
+		d.mu.Lock()
+		for len(d.queue) == 0 && !d.closed {
+			d.cond.Wait()
+		}
+
+		if len(d.queue) == 0 {
+			d.mu.Unlock()
+			return
+		}
+
+		update := d.queue[0]
+		d.queue = d.queue[1:]
+		d.cond.Broadcast()
+		d.mu.Unlock()
+
+		d.c.log(4, "[%s] notifying subscriber %d ...", update.Path, d.id)
+		select {
+		case d.ch <- update:
+			d.c.log(4, "[%s] subscriber %d notified", update.Path, d.id)
+		case <-d.stopping:
+			return
+		}
+	}
+}
+
+// shutdown stops the dispatcher from queueing new updates and wakes up any push waiting for room in the queue.
+// Updates already queued are still sent to the subscriber.
+func (d *dispatcher) shutdown() {
+	d.mu.Lock()
+	d.closed = true
+	d.cond.Broadcast()
+	d.mu.Unlock()
+}
+
+// close waits for all queued updates to be received by the subscriber and stops the dispatcher.
+func (d *dispatcher) close() {
+	d.shutdown()
+	<-d.done
+}
+
+// stop stops the dispatcher without waiting for queued updates to be received by the subscriber.
+// Queued updates are discarded, so the dispatcher stops even if the subscriber does not receive anymore.
+func (d *dispatcher) stop() {
+	d.mu.Lock()
+	d.closed = true
+	d.queue = nil
+	select {
+	case <-d.stopping:
+	default:
+		close(d.stopping)
+	}
+	d.cond.Broadcast()
+	d.mu.Unlock()
+
+	<-d.done
+}
@@ -0,0 +1,190 @@
+package konfig
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeliveryPolicyString(t *testing.T) {
+	tests := []struct {
+		policy         DeliveryPolicy
+		expectedString string
+	}{
+		{Block, "block"},
+		{DropOldest, "drop-oldest"},
+		{Coalesce, "coalesce"},
+		{DeliveryPolicy(0), "unknown"},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.expectedString, tc.policy.String())
+	}
+}
+
+func TestDispatcher(t *testing.T) {
+	u := func(path string, old, value int) Update {
+		return Update{Name: path, Path: path, OldValue: old, Value: value}
+	}
+
+	tests := []struct {
+		name             string
+		policy           DeliveryPolicy
+		size             int
+		updates          []Update
+		expectedReceived []Update
+		expectedDropped  []Update
+	}{
+		{
+			name:             "Block",
+			policy:           Block,
+			size:             1,
+			updates:          []Update{u("A", 0, 1), u("A", 1, 2), u("B", 0, 1), u("A", 2, 3)},
+			expectedReceived: []Update{u("A", 0, 1), u("A", 1, 2), u("B", 0, 1), u("A", 2, 3)},
+			expectedDropped:  []Update{},
+		},
+		{
+			name:             "DropOldest",
+			policy:           DropOldest,
+			size:             2,
+			updates:          []Update{u("A", 0, 1), u("A", 1, 2), u("B", 0, 1), u("A", 2, 3)},
+			expectedReceived: []Update{u("A", 0, 1), u("B", 0, 1), u("A", 2, 3)},
+			expectedDropped:  []Update{u("A", 1, 2)},
+		},
+		{
+			name:             "Coalesce",
+			policy:           Coalesce,
+			size:             1,
+			updates:          []Update{u("A", 0, 1), u("B", 0, 1), u("A", 1, 2), u("B", 1, 2), u("A", 2, 3)},
+			expectedReceived: []Update{u("A", 0, 1), u("B", 0, 2), u("A", 1, 3)},
+			expectedDropped:  []Update{u("B", 0, 1), u("A", 1, 2)},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var mu sync.Mutex
+			dropped := []Update{}
+
+			c := &controller{
+				onDrop: func(update Update) {
+					mu.Lock()
+					dropped = append(dropped, update)
+					mu.Unlock()
+				},
+			}
+
+			ch := make(chan Update)
+			d := newDispatcher(c, 0, ch, tc.policy, tc.size)
+
+			// The first update is taken off the queue and waits for the subscriber
+			d.push(tc.updates[0], true)
+			time.Sleep(50 * time.Millisecond)
+
+			pushed := make(chan struct{})
+			go func() {
+				for _, update := range tc.updates[1:] {
+					d.push(update, true)
+				}
+				close(pushed)
+			}()
+
+			// Let the subscriber fall behind unless pushing blocks
+			if tc.policy != Block {
+				<-pushed
+			}
+
+			received := []Update{}
+			done := make(chan struct{})
+			go func() {
+				for update := range ch {
+					received = append(received, update)
+				}
+				close(done)
+			}()
+
+			<-pushed
+			d.close()
+			close(ch)
+			<-done
+
+			assert.Equal(t, tc.expectedReceived, received)
+			assert.Equal(t, tc.expectedDropped, dropped)
+		})
+	}
+}
+
+func TestDispatcherStop(t *testing.T) {
+	policies := []DeliveryPolicy{Block, DropOldest, Coalesce}
+
+	for _, policy := range policies {
+		t.Run(policy.String(), func(t *testing.T) {
+			c := &controller{}
+			d := newDispatcher(c, 0, make(chan Update), policy, 1)
+
+			// Nothing ever receives from the subscriber
+			d.push(Update{Name: "A", Path: "A", Value: 1}, true)
+			time.Sleep(10 * time.Millisecond)
+			d.push(Update{Name: "B", Path: "B", Value: 1}, true)
+
+			stopped := make(chan struct{})
+			go func() {
+				d.stop()
+				d.stop()
+				close(stopped)
+			}()
+
+			select {
+			case <-stopped:
+			case <-time.After(time.Second):
+				t.Fatal("dispatcher not stopped")
+			}
+		})
+	}
+}
+
+func TestNotifySubscribersInOrder(t *testing.T) {
+	policies := []DeliveryPolicy{Block, DropOldest}
+
+	for _, policy := range policies {
+		t.Run(policy.String(), func(t *testing.T) {
+			c := &controller{
+				delivery:     policy,
+				deliverySize: 1000,
+				subscribers: []chan Update{
+					make(chan Update),
+					make(chan Update, 10),
+				},
+			}
+
+			c.startDispatchers()
+
+			var wg sync.WaitGroup
+			received := make([][]interface{}, len(c.subscribers))
+			for i, sub := range c.subscribers {
+				wg.Add(1)
+				go func(i int, ch chan Update) {
+					defer wg.Done()
+					for update := range ch {
+						received[i] = append(received[i], update.Value)
+					}
+				}(i, sub)
+			}
+
+			expected := []interface{}{}
+			for i := 0; i < 100; i++ {
+				c.notifySubscribers(Update{Name: "Counter", Path: "Counter", Value: i})
+				expected = append(expected, i)
+			}
+
+			c.closeSubscribers()
+			wg.Wait()
+
+			for i := range c.subscribers {
+				assert.Equal(t, expected, received[i])
+			}
+		})
+	}
+}
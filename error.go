@@ -0,0 +1,113 @@
+package konfig
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError is the error returned when a value read for a field cannot be parsed into the type of the field.
+type ParseError struct {
+	// Field is the name of the field.
+	Field string
+	// Source is the name of the source the value is read from (flag, env, file, config, or a custom source).
+	Source string
+	// Key is the flag name, the environment variable name, the file path, or the source-specific key the value is read from.
+	Key string
+	// Value is the raw value read for the field.
+	Value string
+	// Err is the error occurred while parsing the value.
+	Err error
+	// Secret determines whether or not the field is a secret.
+	// If so, the value is masked in the error message and the parsing error is left out, since it may include the value.
+	Secret bool
+}
+
+func (e *ParseError) Error() string {
+	if e.Secret {
+		return fmt.Sprintf("invalid value %s for %s from %s %s", secretMask, e.Field, e.Source, e.Key)
+	}
+
+	return fmt.Sprintf("invalid value %q for %s from %s %s: %s", e.Value, e.Field, e.Source, e.Key, e.Err)
+}
+
+// Unwrap returns the error occurred while parsing the value.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// MissingError is the error returned when no value is provided for a required field.
+type MissingError struct {
+	// Field is the name of the field.
+	Field string
+	// FlagName is the name of command-line flag that could provide the value (empty if skipped).
+	FlagName string
+	// EnvName is the name of environment variable that could provide the value (empty if skipped).
+	EnvName string
+	// FileEnvName is the name of file environment variable that could provide the value (empty if skipped).
+	FileEnvName string
+	// FileKey is the key in the configuration file that could provide the value (empty if no configuration file).
+	FileKey string
+}
+
+func (e *MissingError) Error() string {
+	names := []string{}
+
+	if e.FlagName != "" {
+		names = append(names, "flag "+e.FlagName)
+	}
+
+	if e.EnvName != "" {
+		names = append(names, "env "+e.EnvName)
+	}
+
+	if e.FileEnvName != "" {
+		names = append(names, "file env "+e.FileEnvName)
+	}
+
+	if e.FileKey != "" {
+		names = append(names, "config key "+e.FileKey)
+	}
+
+	if len(names) == 0 {
+		return fmt.Sprintf("no value for required field %s", e.Field)
+	}
+
+	return fmt.Sprintf("no value for required field %s: set %s", e.Field, strings.Join(names, " or "))
+}
+
+// ValidationError is the error returned when the value of a field does not satisfy one of its validation struct tags.
+type ValidationError struct {
+	// Field is the name of the field.
+	Field string
+	// Value is the value that does not satisfy the validation.
+	// For slices and maps, it is the first element that does not satisfy the validation.
+	Value interface{}
+	// Tag is the validation struct tag (min, max, oneof, or pattern).
+	Tag string
+	// Message describes what is expected from the value.
+	Message string
+	// Secret determines whether or not the field is a secret.
+	// If so, the value is masked in the error message.
+	Secret bool
+}
+
+func (e *ValidationError) Error() string {
+	value := maskValue(e.Secret, fmt.Sprint(e.Value))
+	return fmt.Sprintf("invalid value %s for %s: %s", value, e.Field, e.Message)
+}
+
+// Errors is the error returned when one or more fields cannot be populated.
+type Errors []error
+
+func (e Errors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+
+	strs := make([]string, len(e))
+	for i, err := range e {
+		strs[i] = "  " + err.Error()
+	}
+
+	return fmt.Sprintf("%d errors occurred:\n%s", len(e), strings.Join(strs, "\n"))
+}
@@ -0,0 +1,176 @@
+package konfig
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseError(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           *ParseError
+		expectedError string
+	}{
+		{
+			"FromEnv",
+			&ParseError{
+				Field:  "Timeout",
+				Source: "env",
+				Key:    "TIMEOUT",
+				Value:  "30",
+				Err:    errors.New(`time: missing unit in duration "30"`),
+			},
+			`invalid value "30" for Timeout from env TIMEOUT: time: missing unit in duration "30"`,
+		},
+		{
+			"FromFile",
+			&ParseError{
+				Field:  "Port",
+				Source: "file",
+				Key:    "/etc/config/port",
+				Value:  "http",
+				Err:    &strconv.NumError{Func: "ParseInt", Num: "http", Err: strconv.ErrSyntax},
+			},
+			`invalid value "http" for Port from file /etc/config/port: strconv.ParseInt: parsing "http": invalid syntax`,
+		},
+		{
+			"Secret",
+			&ParseError{
+				Field:  "Port",
+				Source: "env",
+				Key:    "PORT",
+				Value:  "s3cr3t",
+				Err:    &strconv.NumError{Func: "ParseInt", Num: "s3cr3t", Err: strconv.ErrSyntax},
+				Secret: true,
+			},
+			`invalid value ****** for Port from env PORT`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedError, tc.err.Error())
+			assert.Equal(t, tc.err.Err, errors.Unwrap(tc.err))
+		})
+	}
+}
+
+func TestMissingError(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           *MissingError
+		expectedError string
+	}{
+		{
+			"NoSource",
+			&MissingError{
+				Field: "DatabaseURL",
+			},
+			"no value for required field DatabaseURL",
+		},
+		{
+			"OneSource",
+			&MissingError{
+				Field:   "DatabaseURL",
+				EnvName: "DATABASE_URL",
+			},
+			"no value for required field DatabaseURL: set env DATABASE_URL",
+		},
+		{
+			"AllSources",
+			&MissingError{
+				Field:       "DatabaseURL",
+				FlagName:    "database.url",
+				EnvName:     "DATABASE_URL",
+				FileEnvName: "DATABASE_URL_FILE",
+				FileKey:     "database.url",
+			},
+			"no value for required field DatabaseURL: set flag database.url or env DATABASE_URL or file env DATABASE_URL_FILE or config key database.url",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedError, tc.err.Error())
+		})
+	}
+}
+
+func TestValidationError(t *testing.T) {
+	tests := []struct {
+		name          string
+		err           *ValidationError
+		expectedError string
+	}{
+		{
+			"Min",
+			&ValidationError{
+				Field:   "Port",
+				Value:   0,
+				Tag:     "min",
+				Message: "must be at least 1",
+			},
+			"invalid value 0 for Port: must be at least 1",
+		},
+		{
+			"OneOf",
+			&ValidationError{
+				Field:   "LogLevel",
+				Value:   "trace",
+				Tag:     "oneof",
+				Message: "must be one of debug, info",
+			},
+			"invalid value trace for LogLevel: must be one of debug, info",
+		},
+		{
+			"Secret",
+			&ValidationError{
+				Field:   "Password",
+				Value:   "s3cr3t",
+				Tag:     "min",
+				Message: "must be at least 8 characters",
+				Secret:  true,
+			},
+			"invalid value ****** for Password: must be at least 8 characters",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedError, tc.err.Error())
+		})
+	}
+}
+
+func TestErrors(t *testing.T) {
+	tests := []struct {
+		name          string
+		errs          Errors
+		expectedError string
+	}{
+		{
+			"OneError",
+			Errors{
+				errors.New("first error"),
+			},
+			"first error",
+		},
+		{
+			"MultipleErrors",
+			Errors{
+				errors.New("first error"),
+				errors.New("second error"),
+			},
+			"2 errors occurred:\n  first error\n  second error",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedError, tc.errs.Error())
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package konfig
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+)
+
+// Candidate is a source that is checked for the value of a field but does not have any value for it.
+type Candidate struct {
+	// Source is the name of the source (i.e. flag, env, file, config, or the name of a custom source).
+	Source string `json:"source"`
+	// Key is the key the value is looked up by (i.e. a flag name, an environment variable name, or a file path).
+	// For files, it is the name of the file environment variable if the variable is not set.
+	Key string `json:"key"`
+}
+
+// FieldReport describes where the value of a field comes from.
+type FieldReport struct {
+	// Field is the path to the field separated by dots (i.e. Database.Pool.Size for a nested field).
+	Field string `json:"field"`
+	// Value is the resolved value of the field.
+	Value string `json:"value"`
+	// Source is the name of the source the value is read from, or default if the field has its default value.
+	Source string `json:"source"`
+	// Key is the key the value is read by (i.e. a flag name, an environment variable name, or a file path).
+	Key string `json:"key,omitempty"`
+	// Checked is the list of sources with a higher precedence that are checked but do not have any value for the field.
+	// Sources skipped for the field are not included.
+	Checked []Candidate `json:"checked,omitempty"`
+	// Error is the error occurred for the field (i.e. a missing required value or a value that cannot be parsed).
+	Error string `json:"error,omitempty"`
+}
+
+// Report describes where the values of all fields of a configuration struct come from.
+// It can be encoded as JSON or printed as a table.
+type Report []FieldReport
+
+// String returns the report as a table with one field per line.
+func (r Report) String() string {
+	var b strings.Builder
+
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FIELD\tVALUE\tSOURCE\tKEY\tCHECKED\tERROR")
+
+	for _, f := range r {
+		checked := make([]string, len(f.Checked))
+		for i, c := range f.Checked {
+			checked[i] = c.Source + " " + c.Key
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", f.Field, f.Value, f.Source, f.Key, strings.Join(checked, ", "), f.Error)
+	}
+
+	w.Flush()
+
+	// Columns are padded even if the last column is empty
+	lines := strings.SplitAfter(b.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \n")
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// Explain reads values for exported fields of a struct the same way as Pick and returns a report of where every value comes from.
+// The report is returned even if some values cannot be read, so it can be used for finding out why reading the configuration fails.
+func Explain(config interface{}, opts ...Option) (Report, error) {
+	return New(opts...).Explain(config)
+}
+
+// Explain reads values for exported fields of a struct the same way as the Explain function using the loader environment.
+func (l *Loader) Explain(config interface{}) (Report, error) {
+	report := Report{}
+	if err := l.pick(config, &report); err != nil {
+		return report, err
+	}
+
+	return report, nil
+}
+
+// formatValue formats the value of a field for reports.
+// Types implementing fmt.Stringer on their pointers (i.e. url.URL) are formatted using their String method.
+func formatValue(v reflect.Value) string {
+	if v.CanAddr() {
+		if s, ok := v.Addr().Interface().(fmt.Stringer); ok {
+			return s.String()
+		}
+	}
+
+	return fmt.Sprint(v.Interface())
+}
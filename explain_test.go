@@ -0,0 +1,320 @@
+package konfig
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExplain(t *testing.T) {
+	type explainConfig struct {
+		Port     int
+		LogLevel string
+		Token    string
+		Timeout  time.Duration
+		Address  url.URL
+		Internal string `flag:"-" env:"-" fileenv:"-"`
+		Database struct {
+			User string `required:"true"`
+		}
+	}
+
+	tests := []struct {
+		name           string
+		args           []string
+		env            map[string]string
+		fs             mapFS
+		expectedError  error
+		expectedReport Report
+	}{
+		{
+			name: "AllSources",
+			args: []string{"-port", "8080"},
+			env: map[string]string{
+				"LOG_LEVEL":          "debug",
+				"TOKEN_FILE":         "/secrets/token",
+				"ADDRESS":            "http://localhost:8080",
+				"DATABASE_USER_FILE": "/secrets/user",
+			},
+			fs: mapFS{
+				"/secrets/token": "secret\n",
+				"/secrets/user":  "admin",
+			},
+			expectedReport: Report{
+				{
+					Field:  "Port",
+					Value:  "8080",
+					Source: "flag",
+					Key:    "port",
+				},
+				{
+					Field:  "LogLevel",
+					Value:  "debug",
+					Source: "env",
+					Key:    "LOG_LEVEL",
+					Checked: []Candidate{
+						{Source: "flag", Key: "log.level"},
+					},
+				},
+				{
+					Field:  "Token",
+					Value:  "secret",
+					Source: "file",
+					Key:    "/secrets/token",
+					Checked: []Candidate{
+						{Source: "flag", Key: "token"},
+						{Source: "env", Key: "TOKEN"},
+					},
+				},
+				{
+					Field:  "Timeout",
+					Value:  "30s",
+					Source: "default",
+					Checked: []Candidate{
+						{Source: "flag", Key: "timeout"},
+						{Source: "env", Key: "TIMEOUT"},
+						{Source: "file", Key: "TIMEOUT_FILE"},
+					},
+				},
+				{
+					Field:  "Address",
+					Value:  "http://localhost:8080",
+					Source: "env",
+					Key:    "ADDRESS",
+					Checked: []Candidate{
+						{Source: "flag", Key: "address"},
+					},
+				},
+				{
+					Field:  "Internal",
+					Value:  "internal",
+					Source: "default",
+				},
+				{
+					Field:  "Database.User",
+					Value:  "admin",
+					Source: "file",
+					Key:    "/secrets/user",
+					Checked: []Candidate{
+						{Source: "flag", Key: "database.user"},
+						{Source: "env", Key: "DATABASE_USER"},
+					},
+				},
+			},
+		},
+		{
+			name: "Errors",
+			args: []string{"-port", "NaN"},
+			env:  map[string]string{},
+			fs:   mapFS{},
+			expectedError: Errors{
+				&ParseError{
+					Field:  "Port",
+					Source: "flag",
+					Key:    "port",
+					Value:  "NaN",
+					Err:    errors.New(`strconv.ParseInt: parsing "NaN": invalid syntax`),
+				},
+				&MissingError{
+					Field:       "Database.User",
+					FlagName:    "database.user",
+					EnvName:     "DATABASE_USER",
+					FileEnvName: "DATABASE_USER_FILE",
+				},
+			},
+			expectedReport: Report{
+				{
+					Field:  "Port",
+					Value:  "0",
+					Source: "flag",
+					Key:    "port",
+					Error:  `invalid value "NaN" for Port from flag port: strconv.ParseInt: parsing "NaN": invalid syntax`,
+				},
+				{
+					Field:  "LogLevel",
+					Value:  "",
+					Source: "default",
+					Checked: []Candidate{
+						{Source: "flag", Key: "log.level"},
+						{Source: "env", Key: "LOG_LEVEL"},
+						{Source: "file", Key: "LOG_LEVEL_FILE"},
+					},
+				},
+				{
+					Field:  "Token",
+					Value:  "",
+					Source: "default",
+					Checked: []Candidate{
+						{Source: "flag", Key: "token"},
+						{Source: "env", Key: "TOKEN"},
+						{Source: "file", Key: "TOKEN_FILE"},
+					},
+				},
+				{
+					Field:  "Timeout",
+					Value:  "30s",
+					Source: "default",
+					Checked: []Candidate{
+						{Source: "flag", Key: "timeout"},
+						{Source: "env", Key: "TIMEOUT"},
+						{Source: "file", Key: "TIMEOUT_FILE"},
+					},
+				},
+				{
+					Field:  "Address",
+					Value:  "",
+					Source: "default",
+					Checked: []Candidate{
+						{Source: "flag", Key: "address"},
+						{Source: "env", Key: "ADDRESS"},
+						{Source: "file", Key: "ADDRESS_FILE"},
+					},
+				},
+				{
+					Field:  "Internal",
+					Value:  "internal",
+					Source: "default",
+				},
+				{
+					Field:  "Database.User",
+					Value:  "",
+					Source: "default",
+					Checked: []Candidate{
+						{Source: "flag", Key: "database.user"},
+						{Source: "env", Key: "DATABASE_USER"},
+						{Source: "file", Key: "DATABASE_USER_FILE"},
+					},
+					Error: "no value for required field Database.User: set flag database.user or env DATABASE_USER or file env DATABASE_USER_FILE",
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config := explainConfig{
+				Timeout:  30 * time.Second,
+				Internal: "internal",
+			}
+
+			report, err := New(
+				Args(tc.args),
+				LookupEnv(func(name string) (string, bool) {
+					val, ok := tc.env[name]
+					return val, ok
+				}),
+				FlagSet(flag.NewFlagSet("app", flag.ContinueOnError)),
+				FS(tc.fs),
+			).Explain(&config)
+
+			if tc.expectedError == nil {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expectedError.Error())
+			}
+
+			assert.Equal(t, tc.expectedReport, report)
+		})
+	}
+}
+
+func TestExplainNonStruct(t *testing.T) {
+	report, err := Explain(27)
+
+	assert.EqualError(t, err, "a non-pointer type is passed")
+	assert.Empty(t, report)
+}
+
+func TestReportString(t *testing.T) {
+	report := Report{
+		{
+			Field:  "Port",
+			Value:  "8080",
+			Source: "flag",
+			Key:    "port",
+		},
+		{
+			Field:  "LogLevel",
+			Value:  "info",
+			Source: "default",
+			Checked: []Candidate{
+				{Source: "flag", Key: "log.level"},
+				{Source: "env", Key: "LOG_LEVEL"},
+			},
+		},
+		{
+			Field:  "Timeout",
+			Value:  "0s",
+			Source: "env",
+			Key:    "TIMEOUT",
+			Error:  "invalid value",
+		},
+	}
+
+	expected := "" +
+		"FIELD     VALUE  SOURCE   KEY      CHECKED                        ERROR\n" +
+		"Port      8080   flag     port\n" +
+		"LogLevel  info   default           flag log.level, env LOG_LEVEL\n" +
+		"Timeout   0s     env      TIMEOUT                                 invalid value\n"
+
+	assert.Equal(t, expected, report.String())
+}
+
+func TestReportJSON(t *testing.T) {
+	report := Report{
+		{
+			Field:  "Port",
+			Value:  "8080",
+			Source: "flag",
+			Key:    "port",
+		},
+		{
+			Field:  "LogLevel",
+			Value:  "info",
+			Source: "default",
+			Checked: []Candidate{
+				{Source: "env", Key: "LOG_LEVEL"},
+			},
+		},
+	}
+
+	b, err := json.Marshal(report)
+	assert.NoError(t, err)
+
+	expected := `[` +
+		`{"field":"Port","value":"8080","source":"flag","key":"port"},` +
+		`{"field":"LogLevel","value":"info","source":"default","checked":[{"source":"env","key":"LOG_LEVEL"}]}` +
+		`]`
+
+	assert.JSONEq(t, expected, string(b))
+}
+
+func TestFormatValue(t *testing.T) {
+	u, _ := url.Parse("http://localhost:8080")
+
+	config := struct {
+		Int      int
+		Duration time.Duration
+		URL      url.URL
+		Strings  []string
+	}{
+		Int:      27,
+		Duration: time.Minute,
+		URL:      *u,
+		Strings:  []string{"a", "b"},
+	}
+
+	v := reflect.ValueOf(&config).Elem()
+
+	assert.Equal(t, "27", formatValue(v.Field(0)))
+	assert.Equal(t, "1m0s", formatValue(v.Field(1)))
+	assert.Equal(t, "http://localhost:8080", formatValue(v.Field(2)))
+	assert.Equal(t, "[a b]", formatValue(v.Field(3)))
+	assert.Equal(t, "27", formatValue(reflect.ValueOf(27)))
+}
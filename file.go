@@ -0,0 +1,221 @@
+package konfig
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// ConfigFileSource is the built-in source for reading values from a structured configuration file (YAML, JSON, or TOML).
+// The configuration file is specified using File option or KONFIG_FILE environment variable.
+var ConfigFileSource Source = &configFileSource{}
+
+type configFileSource struct {
+	c *controller
+}
+
+func (s *configFileSource) Name() string {
+	return sourceConfigFile
+}
+
+// Lookup returns the value for a field from the configuration file.
+// The key for a field is the path to the field in the file separated by dots (i.e. database.pool.size).
+func (s *configFileSource) Lookup(f Field) (string, string) {
+	if s.c.file == "" {
+		return "", ""
+	}
+
+	key := getFileKey(f.Name)
+
+	s.c.fileLock.RLock()
+	val, ok := s.c.fileValues[key]
+	s.c.fileLock.RUnlock()
+
+	if !ok {
+		return "", key
+	}
+
+	return stringifyValue(val, f.ListSep, f.KVSep), key
+}
+
+// Watch watches the configuration file and notifies all keys at once whenever the file changes.
+// The file is watched using file system notifications unless polling is specified by Polling or PollingFallback options.
+func (s *configFileSource) Watch(keys []string, notify func(keys ...string)) (func(), error) {
+	return s.watch(keys, func(keys ...string) error {
+		notify(keys...)
+		return nil
+	})
+}
+
+// watch watches the configuration file the same way as Watch and applies the values of all keys at once whenever the file changes.
+// The content of the file is only recorded as applied if applying the values does not fail (see watchSources).
+func (s *configFileSource) watch(keys []string, apply func(keys ...string) error) (func(), error) {
+	// An invalid file is not applied and all fields keep their current values
+	changed := func() {
+		// A file rewritten with the same content is not applied again
+		if b, err := s.c.getFS().ReadFile(s.c.file); err == nil && !s.c.isFileChanged(s.c.file, b) {
+			s.c.log(5, "config file %s is not changed", s.c.file)
+			return
+		}
+
+		b, err := s.c.readFile()
+		if err != nil {
+			s.c.log(1, "%s", err)
+			return
+		}
+
+		s.c.log(3, "received an update from config file %s", s.c.file)
+
+		// A rolled back file is applied again if it is rewritten with the same content (i.e. once other fields are changed)
+		if err := apply(keys...); err != nil {
+			return
+		}
+
+		s.c.setFileHash(s.c.file, b)
+	}
+
+	poll := func() func() {
+		return s.c.pollFiles([]string{s.c.file}, func([]string) {
+			changed()
+		})
+	}
+
+	if s.c.pollInterval > 0 && !s.c.pollFallback {
+		return poll(), nil
+	}
+
+	// The directory of the file is watched, so the file is picked up when replaced (i.e. by editors or ConfigMap updates)
+	stop, err := s.c.watchFileEvents([]string{s.c.file}, func([]string) {
+		changed()
+	})
+	if err != nil && s.c.pollFallback {
+		s.c.log(1, "falling back to polling config file: %s", err)
+		return poll(), nil
+	}
+
+	return stop, err
+}
+
+// readFile reads and parses the configuration file if one is specified.
+// It returns the content of the file, so the content can be recorded once its values are applied (see setFileHash).
+func (c *controller) readFile() ([]byte, error) {
+	if c.file == "" {
+		return nil, nil
+	}
+
+	b, err := c.getFS().ReadFile(c.file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read config file %s: %w", c.file, err)
+	}
+
+	doc, err := parseFile(c.file, b)
+	if err != nil {
+		return nil, fmt.Errorf("cannot parse config file %s: %w", c.file, err)
+	}
+
+	values := map[string]interface{}{}
+	flattenValues("", doc, values)
+
+	c.fileLock.Lock()
+	c.fileValues = values
+	c.fileLock.Unlock()
+
+	c.log(2, "config file read: %s", c.file)
+
+	return b, nil
+}
+
+// parseFile parses the content of a configuration file based on the file extension.
+func parseFile(path string, b []byte) (interface{}, error) {
+	var doc interface{}
+
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		if err := yaml.Unmarshal(b, &doc); err != nil {
+			return nil, err
+		}
+	case ".json":
+		// Numbers are kept as they are written, so large integers do not lose precision
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		if err := dec.Decode(&doc); err != nil {
+			return nil, err
+		}
+	case ".toml":
+		m := map[string]interface{}{}
+		if _, err := toml.Decode(string(b), &m); err != nil {
+			return nil, err
+		}
+		doc = m
+	default:
+		return nil, fmt.Errorf("unsupported file format: %q", ext)
+	}
+
+	return doc, nil
+}
+
+// flattenValues flattens a nested document into a map of keys separated by dots to values.
+// Nested maps are also kept as values for their keys, so they can be read into fields with map types.
+func flattenValues(prefix string, doc interface{}, values map[string]interface{}) {
+	join := func(key string) string {
+		if prefix == "" {
+			return key
+		}
+		return prefix + "." + key
+	}
+
+	if prefix != "" {
+		values[prefix] = doc
+	}
+
+	switch m := doc.(type) {
+	case map[string]interface{}:
+		for k, v := range m {
+			flattenValues(join(k), v, values)
+		}
+	case map[interface{}]interface{}:
+		for k, v := range m {
+			flattenValues(join(fmt.Sprint(k)), v, values)
+		}
+	}
+}
+
+// stringifyValue converts a value read from a configuration file to a string.
+// Lists are joined using the given list separator.
+// Maps are converted to lists of keys and values joined using the given key/value separator and sorted by keys.
+func stringifyValue(val interface{}, listSep, kvSep string) string {
+	switch v := val.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case []interface{}:
+		strs := make([]string, len(v))
+		for i, item := range v {
+			strs[i] = stringifyValue(item, listSep, kvSep)
+		}
+		return strings.Join(strs, listSep)
+	case map[string]interface{}:
+		strs := make([]string, 0, len(v))
+		for key, item := range v {
+			strs = append(strs, key+kvSep+stringifyValue(item, listSep, kvSep))
+		}
+		sort.Strings(strs)
+		return strings.Join(strs, listSep)
+	case map[interface{}]interface{}:
+		strs := make([]string, 0, len(v))
+		for key, item := range v {
+			strs = append(strs, fmt.Sprint(key)+kvSep+stringifyValue(item, listSep, kvSep))
+		}
+		sort.Strings(strs)
+		return strings.Join(strs, listSep)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,621 @@
+package konfig
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeConfigFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	err := ioutil.WriteFile(path, []byte(content), 0644)
+	assert.NoError(t, err)
+
+	return path
+}
+
+func TestConfigFileSource(t *testing.T) {
+	tests := []struct {
+		name          string
+		c             *controller
+		f             Field
+		expectedValue string
+		expectedKey   string
+	}{
+		{
+			"NoFile",
+			&controller{},
+			Field{Name: "LogLevel", ListSep: ","},
+			"", "",
+		},
+		{
+			"NoValue",
+			&controller{
+				file:       "config.yaml",
+				fileValues: map[string]interface{}{},
+			},
+			Field{Name: "LogLevel", ListSep: ","},
+			"", "log.level",
+		},
+		{
+			"NullValue",
+			&controller{
+				file: "config.yaml",
+				fileValues: map[string]interface{}{
+					"log.level": nil,
+				},
+			},
+			Field{Name: "LogLevel", ListSep: ","},
+			"", "log.level",
+		},
+		{
+			"StringValue",
+			&controller{
+				file: "config.yaml",
+				fileValues: map[string]interface{}{
+					"log.level": "debug",
+				},
+			},
+			Field{Name: "LogLevel", ListSep: ","},
+			"debug", "log.level",
+		},
+		{
+			"NestedValue",
+			&controller{
+				file: "config.yaml",
+				fileValues: map[string]interface{}{
+					"database.pool.size": 10,
+				},
+			},
+			Field{Name: "Database.Pool.Size", ListSep: ","},
+			"10", "database.pool.size",
+		},
+		{
+			"ListValue",
+			&controller{
+				file: "config.yaml",
+				fileValues: map[string]interface{}{
+					"endpoints": []interface{}{"url1", "url2"},
+				},
+			},
+			Field{Name: "Endpoints", ListSep: "|"},
+			"url1|url2", "endpoints",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			src := &configFileSource{c: tc.c}
+			value, key := src.Lookup(tc.f)
+
+			assert.Equal(t, "config", src.Name())
+			assert.Equal(t, tc.expectedValue, value)
+			assert.Equal(t, tc.expectedKey, key)
+		})
+	}
+}
+
+func TestReadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotest_")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		name               string
+		file               string
+		content            string
+		expectedError      string
+		expectedFileValues map[string]interface{}
+	}{
+		{
+			"NoFile",
+			"",
+			"",
+			"",
+			nil,
+		},
+		{
+			"MissingFile",
+			"missing.yaml",
+			"",
+			"cannot read config file",
+			nil,
+		},
+		{
+			"UnsupportedFormat",
+			"config.ini",
+			"log.level = debug",
+			`cannot parse config file ` + filepath.Join(dir, "config.ini") + `: unsupported file format: ".ini"`,
+			nil,
+		},
+		{
+			"InvalidYAML",
+			"invalid.yaml",
+			"log: [",
+			"cannot parse config file",
+			nil,
+		},
+		{
+			"InvalidJSON",
+			"invalid.json",
+			`{"log": `,
+			"cannot parse config file",
+			nil,
+		},
+		{
+			"InvalidTOML",
+			"invalid.toml",
+			"[log",
+			"cannot parse config file",
+			nil,
+		},
+		{
+			"YAML",
+			"config.yaml",
+			"log:\n  level: debug\ndatabase.url: postgres://localhost\nendpoints:\n  - url1\n  - url2\n",
+			"",
+			map[string]interface{}{
+				"log":          map[interface{}]interface{}{"level": "debug"},
+				"log.level":    "debug",
+				"database.url": "postgres://localhost",
+				"endpoints":    []interface{}{"url1", "url2"},
+			},
+		},
+		{
+			"JSON",
+			"config.json",
+			`{"log": {"level": "debug"}, "max": 18446744073709551615, "endpoints": ["url1", "url2"]}`,
+			"",
+			map[string]interface{}{
+				"log":       map[string]interface{}{"level": "debug"},
+				"log.level": "debug",
+				"max":       json.Number("18446744073709551615"),
+				"endpoints": []interface{}{"url1", "url2"},
+			},
+		},
+		{
+			"TOML",
+			"config.toml",
+			"endpoints = [\"url1\", \"url2\"]\n\n[log]\nlevel = \"debug\"\n",
+			"",
+			map[string]interface{}{
+				"log":       map[string]interface{}{"level": "debug"},
+				"log.level": "debug",
+				"endpoints": []interface{}{"url1", "url2"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &controller{}
+
+			if tc.file != "" {
+				c.file = filepath.Join(dir, tc.file)
+				if tc.content != "" {
+					writeConfigFile(t, dir, tc.file, tc.content)
+				}
+			}
+
+			_, err := c.readFile()
+
+			if tc.expectedError != "" {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), tc.expectedError)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedFileValues, c.fileValues)
+			}
+		})
+	}
+}
+
+func TestStringifyValue(t *testing.T) {
+	tests := []struct {
+		val           interface{}
+		listSep       string
+		kvSep         string
+		expectedValue string
+	}{
+		{nil, ",", "=", ""},
+		{"content", ",", "=", "content"},
+		{true, ",", "=", "true"},
+		{27, ",", "=", "27"},
+		{int64(-9223372036854775808), ",", "=", "-9223372036854775808"},
+		{uint64(18446744073709551615), ",", "=", "18446744073709551615"},
+		{3.14159265359, ",", "=", "3.14159265359"},
+		{json.Number("2.7182"), ",", "=", "2.7182"},
+		{[]interface{}{}, ",", "=", ""},
+		{[]interface{}{"milad", "mona"}, ",", "=", "milad,mona"},
+		{[]interface{}{1, 2, 3}, "|", "=", "1|2|3"},
+		{map[string]interface{}{"team": "core", "env": "prod"}, ",", "=", "env=prod,team=core"},
+		{map[interface{}]interface{}{"tenant-b": 200, "tenant-a": 100}, "|", ":", "tenant-a:100|tenant-b:200"},
+	}
+
+	for _, tc := range tests {
+		value := stringifyValue(tc.val, tc.listSep, tc.kvSep)
+		assert.Equal(t, tc.expectedValue, value)
+	}
+}
+
+func TestPickWithFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotest_")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	type config struct {
+		LogLevel  string
+		Endpoints []string
+		Labels    map[string]string
+		Database  struct {
+			URL  string
+			Pool struct {
+				Size    int
+				Timeout time.Duration
+			}
+		}
+	}
+
+	expected := config{
+		LogLevel:  "debug",
+		Endpoints: []string{"url1", "url2"},
+		Labels:    map[string]string{"env": "prod", "team": "core"},
+	}
+	expected.Database.URL = "postgres://localhost"
+	expected.Database.Pool.Size = 10
+	expected.Database.Pool.Timeout = 30 * time.Second
+
+	tests := []struct {
+		name           string
+		file           string
+		content        string
+		envs           map[string]string
+		expectedConfig config
+	}{
+		{
+			"YAML",
+			"config.yaml",
+			"log.level: debug\nendpoints: [url1, url2]\nlabels:\n  env: prod\n  team: core\ndatabase:\n  url: postgres://localhost\n  pool:\n    size: 10\n    timeout: 30s\n",
+			nil,
+			expected,
+		},
+		{
+			"JSON",
+			"config.json",
+			`{"log.level": "debug", "endpoints": ["url1", "url2"], "labels": {"env": "prod", "team": "core"}, "database": {"url": "postgres://localhost", "pool": {"size": 10, "timeout": "30s"}}}`,
+			nil,
+			expected,
+		},
+		{
+			"TOML",
+			"config.toml",
+			"\"log.level\" = \"debug\"\nendpoints = [\"url1\", \"url2\"]\n\n[labels]\nenv = \"prod\"\nteam = \"core\"\n\n[database]\nurl = \"postgres://localhost\"\n\n[database.pool]\nsize = 10\ntimeout = \"30s\"\n",
+			nil,
+			expected,
+		},
+		{
+			"EnvOverridesFile",
+			"config.yaml",
+			"log.level: debug\nendpoints: [url1, url2]\nlabels:\n  env: prod\n  team: core\ndatabase:\n  url: postgres://localhost\n  pool:\n    size: 10\n    timeout: 30s\n",
+			map[string]string{
+				"LOG_LEVEL":          "info",
+				"DATABASE_POOL_SIZE": "20",
+			},
+			func() config {
+				c := expected
+				c.LogLevel = "info"
+				c.Database.Pool.Size = 20
+				return c
+			}(),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for name, value := range tc.envs {
+				err := os.Setenv(name, value)
+				assert.NoError(t, err)
+				defer os.Unsetenv(name)
+			}
+
+			path := writeConfigFile(t, dir, tc.file, tc.content)
+
+			cfg := config{}
+			err := Pick(&cfg, File(path))
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedConfig, cfg)
+		})
+	}
+}
+
+func TestWatchWithFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotest_")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "config.yaml", "log.level: debug\nport: 8080\nlabels:\n  env: prod\n")
+
+	cfg := &struct {
+		sync.Mutex
+		LogLevel string
+		Port     int
+		Labels   map[string]string
+	}{}
+
+	ch := make(chan Update)
+	close, err := Watch(cfg, []chan Update{ch}, File(path))
+	assert.NoError(t, err)
+	defer close()
+
+	cfg.Lock()
+	assert.Equal(t, "debug", cfg.LogLevel)
+	assert.Equal(t, 8080, cfg.Port)
+	cfg.Unlock()
+
+	writeConfigFile(t, dir, "config.yaml", "log.level: info\nport: 8080\nlabels:\n  env: prod\n  team: core\n")
+
+	// Subscribers are also notified of the values read initially
+	updates := []Update{}
+	timeout := time.After(2 * time.Second)
+	for len(updates) < 5 {
+		select {
+		case update := <-ch:
+			assert.False(t, update.Time.IsZero())
+			update.Time = time.Time{}
+			updates = append(updates, update)
+		case <-timeout:
+			t.Fatalf("timeout waiting for updates: %v", updates)
+		}
+	}
+
+	assert.Contains(t, updates, Update{Name: "LogLevel", Path: "LogLevel", Value: "debug", OldValue: "", Source: "config", Key: "log.level"})
+	assert.Contains(t, updates, Update{Name: "Port", Path: "Port", Value: 8080, OldValue: 0, Source: "config", Key: "port"})
+	assert.Contains(t, updates, Update{Name: "Labels", Path: "Labels", Value: map[string]string{"env": "prod"}, OldValue: map[string]string(nil), Source: "config", Key: "labels"})
+	assert.Contains(t, updates, Update{Name: "LogLevel", Path: "LogLevel", Value: "info", OldValue: "debug", Source: "config", Key: "log.level"})
+	assert.Contains(t, updates, Update{Name: "Labels", Path: "Labels", Value: map[string]string{"env": "prod", "team": "core"}, OldValue: map[string]string{"env": "prod"}, Source: "config", Key: "labels"})
+
+	cfg.Lock()
+	assert.Equal(t, "info", cfg.LogLevel)
+	assert.Equal(t, 8080, cfg.Port)
+	assert.Equal(t, map[string]string{"env": "prod", "team": "core"}, cfg.Labels)
+	cfg.Unlock()
+}
+
+func TestWatchWithFilePolling(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotest_")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "config.yaml", "log.level: debug\n")
+
+	cfg := &struct {
+		sync.Mutex
+		LogLevel string
+	}{}
+
+	ch := make(chan Update, 10)
+	close, err := Watch(cfg, []chan Update{ch}, File(path), Polling(20*time.Millisecond))
+	assert.NoError(t, err)
+	defer close()
+
+	writeConfigFile(t, dir, "config.yaml", "log.level: info\n")
+
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case update := <-ch:
+			if update.Value == "info" {
+				assert.Equal(t, "debug", update.OldValue)
+				assert.Equal(t, "config", update.Source)
+
+				cfg.Lock()
+				assert.Equal(t, "info", cfg.LogLevel)
+				cfg.Unlock()
+				return
+			}
+		case <-timeout:
+			t.Fatal("timed out waiting for update")
+		}
+	}
+}
+
+func TestWatchWithFileReplaced(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotest_")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "config.yaml", "log.level: debug\n")
+
+	cfg := &struct {
+		sync.Mutex
+		LogLevel string
+	}{}
+
+	ch := make(chan Update, 10)
+	close, err := New(
+		Args([]string{}),
+		LookupEnv(func(string) (string, bool) { return "", false }),
+		FlagSet(flag.NewFlagSet("app", flag.ContinueOnError)),
+		File(path),
+	).Watch(cfg, []chan Update{ch})
+	assert.NoError(t, err)
+	defer close()
+
+	waitFor := func(value string) {
+		timeout := time.After(2 * time.Second)
+		for {
+			select {
+			case update := <-ch:
+				if update.Value == value {
+					return
+				}
+			case <-timeout:
+				t.Fatalf("timed out waiting for update to %q", value)
+			}
+		}
+	}
+
+	waitFor("debug")
+
+	// Editors and configuration agents replace the file by renaming a temporary file
+	tmp := writeConfigFile(t, dir, "tmp.yaml", "log.level: info\n")
+	assert.NoError(t, os.Rename(tmp, path))
+	waitFor("info")
+
+	// The file is still watched after being replaced
+	writeConfigFile(t, dir, "config.yaml", "log.level: warn\n")
+	waitFor("warn")
+
+	cfg.Lock()
+	assert.Equal(t, "warn", cfg.LogLevel)
+	cfg.Unlock()
+}
+
+func TestWatchWithFileNewKey(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotest_")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "config.yaml", "log.level: info\n")
+
+	cfg := &struct {
+		sync.Mutex
+		LogLevel string
+		Port     int
+	}{}
+
+	cs := make(chan ChangeSet, 10)
+	close, err := New(
+		Args([]string{}),
+		LookupEnv(func(string) (string, bool) { return "", false }),
+		FlagSet(flag.NewFlagSet("app", flag.ContinueOnError)),
+		File(path),
+		ChangeSets(cs),
+	).Watch(cfg, nil)
+	assert.NoError(t, err)
+	defer close()
+
+	// A key without any value initially is applied once it is added to the file
+	writeConfigFile(t, dir, "config.yaml", "log.level: debug\nport: 9\n")
+
+	select {
+	case changeSet := <-cs:
+		values := map[string]interface{}{}
+		for _, update := range changeSet.Updates {
+			values[update.Name] = update.Value
+		}
+		assert.Equal(t, map[string]interface{}{"LogLevel": "debug", "Port": 9}, values)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for change set")
+	}
+
+	cfg.Lock()
+	assert.Equal(t, "debug", cfg.LogLevel)
+	assert.Equal(t, 9, cfg.Port)
+	cfg.Unlock()
+}
+
+func TestWatchWithFileKeyRemoved(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotest_")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "config.yaml", "log.level: debug\nport: 9\n")
+
+	cfg := &struct {
+		sync.Mutex
+		LogLevel string
+		Port     int
+	}{
+		LogLevel: "info",
+		Port:     8080,
+	}
+
+	cs := make(chan ChangeSet, 10)
+	close, err := New(
+		Args([]string{}),
+		LookupEnv(func(string) (string, bool) { return "", false }),
+		FlagSet(flag.NewFlagSet("app", flag.ContinueOnError)),
+		File(path),
+		ChangeSets(cs),
+	).Watch(cfg, nil)
+	assert.NoError(t, err)
+	defer close()
+
+	// A key removed from the file falls back to the default value, the same as a deleted file
+	writeConfigFile(t, dir, "config.yaml", "log.level: debug\n")
+
+	select {
+	case changeSet := <-cs:
+		assert.Len(t, changeSet.Updates, 1)
+		assert.Equal(t, "Port", changeSet.Updates[0].Name)
+		assert.Equal(t, 9, changeSet.Updates[0].OldValue)
+		assert.Equal(t, 8080, changeSet.Updates[0].Value)
+		assert.Equal(t, sourceDefault, changeSet.Updates[0].Source)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for change set")
+	}
+
+	cfg.Lock()
+	assert.Equal(t, "debug", cfg.LogLevel)
+	assert.Equal(t, 8080, cfg.Port)
+	cfg.Unlock()
+}
+
+func TestWatchWithFileRolledBack(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotest_")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := writeConfigFile(t, dir, "config.yaml", "min.conns: 1\n")
+	maxPath := writeConfigFile(t, dir, "max_conns", "10")
+
+	cfg := &connsConfig{}
+	env := map[string]string{"MAX_CONNS_FILE": maxPath}
+
+	close, err := New(
+		Args([]string{}),
+		LookupEnv(func(name string) (string, bool) {
+			val, ok := env[name]
+			return val, ok
+		}),
+		FlagSet(flag.NewFlagSet("app", flag.ContinueOnError)),
+		File(path),
+	).Watch(cfg, nil)
+	assert.NoError(t, err)
+	defer close()
+
+	waitFor := func(min, max int) {
+		deadline := time.Now().Add(2 * time.Second)
+		for time.Now().Before(deadline) {
+			cfg.Lock()
+			ok := cfg.MinConns == min && cfg.MaxConns == max
+			cfg.Unlock()
+			if ok {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		t.Fatalf("timed out waiting for MinConns=%d and MaxConns=%d", min, max)
+	}
+
+	// The new value does not pass the validation, so it is rolled back
+	writeConfigFile(t, dir, "config.yaml", "min.conns: 20\n")
+	time.Sleep(200 * time.Millisecond)
+	waitFor(1, 10)
+
+	writeConfigFile(t, dir, "max_conns", "30")
+	waitFor(1, 30)
+
+	// The rolled back file is applied once it is rewritten with the same content
+	writeConfigFile(t, dir, "config.yaml", "min.conns: 20\n")
+	waitFor(20, 30)
+}
@@ -1,9 +1,16 @@
 module github.com/moorara/konfig
 
-go 1.13
+go 1.19
 
 require (
+	github.com/BurntSushi/toml v0.3.1
 	github.com/fsnotify/fsnotify v1.4.7
 	github.com/stretchr/testify v1.4.0
+	gopkg.in/yaml.v2 v2.2.2
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
 	golang.org/x/sys v0.0.0-20200202164722-d101bd2416d5 // indirect
 )
@@ -1,10 +1,12 @@
 package konfig
 
 import (
+	"encoding"
 	"errors"
-	"os"
+	"flag"
 	"reflect"
 	"regexp"
+	"strconv"
 	"strings"
 	"unicode"
 )
@@ -93,21 +95,34 @@ func getFileEnvVarName(name string) string {
 	return result
 }
 
-// getFlagValue returns the value set for a flag.
+// getFileKey returns a canonical key in a configuration file for a field.
+// For a nested field, the name is the path to the field separated by dots.
+//   UserID                  -->  user.id
+//   Database.Pool.MaxSize   -->  database.pool.max.size
+func getFileKey(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = getFlagName(part)
+	}
+
+	return strings.Join(parts, ".")
+}
+
+// getFlagValue returns the value set for a flag in a list of command-line arguments.
 //   - The flag name can start with - or --
 //   - The flag value can be separated by space or =
-func getFlagValue(flagName string) string {
+func getFlagValue(args []string, flagName string) string {
 	flagRegex := regexp.MustCompile("-{1,2}" + flagName)
 	genericRegex := regexp.MustCompile("^-{1,2}[A-Za-z].*")
 
-	for i, arg := range os.Args {
+	for i, arg := range args {
 		if flagRegex.MatchString(arg) {
 			if s := strings.Index(arg, "="); s > 0 {
 				return arg[s+1:]
 			}
 
-			if i+1 < len(os.Args) {
-				val := os.Args[i+1]
+			if i+1 < len(args) {
+				val := args[i+1]
 				if !genericRegex.MatchString(val) {
 					return val
 				}
@@ -120,6 +135,32 @@ func getFlagValue(flagName string) string {
 	return ""
 }
 
+// hasOption determines whether or not an option is enabled for a field.
+// An option can be enabled using either its own struct tag or konfig struct tag.
+//   `required:"true"`  or  `konfig:"required"`
+func hasOption(tag reflect.StructTag, name string) bool {
+	if b, err := strconv.ParseBool(tag.Get(name)); err == nil && b {
+		return true
+	}
+
+	for _, opt := range strings.Split(tag.Get(tagKonfig), ",") {
+		if strings.TrimSpace(opt) == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// maskValue returns a mask instead of a value if the value belongs to a secret field.
+// Empty values are not masked, so it is still known whether or not a secret is set.
+func maskValue(secret bool, val string) string {
+	if secret && val != "" {
+		return secretMask
+	}
+	return val
+}
+
 func validateStruct(s interface{}) (reflect.Value, error) {
 	v := reflect.ValueOf(s) // reflect.Value --> v.Type(), v.Kind(), v.NumField()
 	t := reflect.TypeOf(s)  // reflect.Type --> t.Name(), t.Kind(), t.NumField()
@@ -140,7 +181,23 @@ func validateStruct(s interface{}) (reflect.Value, error) {
 	return v, nil
 }
 
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	flagValueType       = reflect.TypeOf((*flag.Value)(nil)).Elem()
+)
+
+// isUnmarshaler determines whether or not a pointer to a type implements encoding.TextUnmarshaler or flag.Value.
+func isUnmarshaler(t reflect.Type) bool {
+	pt := reflect.PtrTo(t)
+	return pt.Implements(textUnmarshalerType) || pt.Implements(flagValueType)
+}
+
 func isTypeSupported(t reflect.Type) bool {
+	// Types implementing encoding.TextUnmarshaler or flag.Value are populated through those interfaces
+	if isUnmarshaler(t) {
+		return true
+	}
+
 	switch t.Kind() {
 	case reflect.String:
 		return true
@@ -153,7 +210,11 @@ func isTypeSupported(t reflect.Type) bool {
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
 		return true
 	case reflect.Slice:
-		return isTypeSupported(t.Elem())
+		return t.Elem().Kind() != reflect.Map && isTypeSupported(t.Elem())
+	case reflect.Map:
+		// Only maps with string keys and scalar values are supported
+		elemKind := t.Elem().Kind()
+		return t.Key().Kind() == reflect.String && elemKind != reflect.Slice && elemKind != reflect.Map && isTypeSupported(t.Elem())
 	case reflect.Struct:
 		if t.PkgPath() == "net/url" && t.Name() == "URL" {
 			return true
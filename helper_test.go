@@ -3,7 +3,6 @@ package konfig
 import (
 	"errors"
 	"net/url"
-	"os"
 	"reflect"
 	"testing"
 	"time"
@@ -123,6 +122,26 @@ func TestGetFileEnvVarName(t *testing.T) {
 	}
 }
 
+func TestGetFileKey(t *testing.T) {
+	tests := []struct {
+		fieldName       string
+		expectedFileKey string
+	}{
+		{"c", "c"},
+		{"C", "c"},
+		{"camelCase", "camel.case"},
+		{"CamelCase", "camel.case"},
+		{"DatabaseURL", "database.url"},
+		{"Database.URL", "database.url"},
+		{"Database.Pool.MaxSize", "database.pool.max.size"},
+	}
+
+	for _, tc := range tests {
+		fileKey := getFileKey(tc.fieldName)
+		assert.Equal(t, tc.expectedFileKey, fileKey)
+	}
+}
+
 func TestGetFlagValue(t *testing.T) {
 	tests := []struct {
 		args              []string
@@ -157,19 +176,54 @@ func TestGetFlagValue(t *testing.T) {
 		{[]string{"exec", "--service.name", "go-service"}, "service.name", "go-service"},
 	}
 
-	origArgs := os.Args
-	defer func() {
-		os.Args = origArgs
-	}()
-
 	for _, tc := range tests {
-		os.Args = tc.args
-		flagValue := getFlagValue(tc.flagName)
+		flagValue := getFlagValue(tc.args[1:], tc.flagName)
 
 		assert.Equal(t, tc.expectedFlagValue, flagValue)
 	}
 }
 
+func TestHasOption(t *testing.T) {
+	tests := []struct {
+		tag      reflect.StructTag
+		name     string
+		expected bool
+	}{
+		{``, "required", false},
+		{`required:"false"`, "required", false},
+		{`required:"invalid"`, "required", false},
+		{`required:"true"`, "required", true},
+		{`konfig:"required"`, "required", true},
+		{`konfig:"secret, required"`, "required", true},
+		{`konfig:"secret"`, "required", false},
+		{`flag:"required"`, "required", false},
+		{`secret:"true"`, "secret", true},
+		{`konfig:"secret, required"`, "secret", true},
+	}
+
+	for _, tc := range tests {
+		res := hasOption(tc.tag, tc.name)
+		assert.Equal(t, tc.expected, res)
+	}
+}
+
+func TestMaskValue(t *testing.T) {
+	tests := []struct {
+		secret   bool
+		val      string
+		expected string
+	}{
+		{false, "", ""},
+		{false, "value", "value"},
+		{true, "", ""},
+		{true, "value", "******"},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.expected, maskValue(tc.secret, tc.val))
+	}
+}
+
 func TestValidateStruct(t *testing.T) {
 	tests := []struct {
 		name          string
@@ -248,7 +302,22 @@ func TestIsTypeSupported(t *testing.T) {
 		{"Uint32Slice", []uint32{}, true},
 		{"Uint64Slice", []uint64{}, true},
 		{"URLSlice", []url.URL{*service1URL, *service2URL}, true},
-		{"Unsupported", time.Now(), false},
+		{"StringMap", map[string]string{"foo": "bar"}, true},
+		{"BoolMap", map[string]bool{}, true},
+		{"Float64Map", map[string]float64{}, true},
+		{"IntMap", map[string]int{}, true},
+		{"DurationMap", map[string]time.Duration{}, true},
+		{"Uint64Map", map[string]uint64{}, true},
+		{"URLMap", map[string]url.URL{"service-1": *service1URL}, true},
+		{"TextUnmarshaler", time.Now(), true},
+		{"TextUnmarshalerSlice", []time.Time{}, true},
+		{"FlagValue", byteSize(0), true},
+		{"FlagValueMap", map[string]byteSize{}, true},
+		{"Unsupported", complex(1, 2), false},
+		{"UnsupportedMapKey", map[int]string{}, false},
+		{"UnsupportedMapValue", map[string][]string{}, false},
+		{"UnsupportedNestedMap", map[string]map[string]string{}, false},
+		{"UnsupportedMapSlice", []map[string]string{}, false},
 	}
 
 	for _, tc := range tests {
@@ -3,20 +3,21 @@
 package konfig
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"net/url"
 	"os"
-	"path/filepath"
 	"reflect"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
-
-	"github.com/fsnotify/fsnotify"
 )
 
 const (
@@ -25,9 +26,16 @@ const (
 	tagEnv     = "env"
 	tagFileEnv = "fileenv"
 	tagSep     = "sep"
+	tagKVSep   = "kvsep"
+	tagTrim    = "trim"
+	tagKonfig  = "konfig"
+
+	optRequired = "required"
+	optSecret   = "secret"
 
 	envDebug            = "KONFIG_DEBUG"
 	envListSep          = "KONFIG_LIST_SEP"
+	envTrim             = "KONFIG_TRIM"
 	envSkipFlag         = "KONFIG_SKIP_FLAG"
 	envSkipEnv          = "KONFIG_SKIP_ENV"
 	envSkipFileEnv      = "KONFIG_SKIP_FILE_ENV"
@@ -36,27 +44,125 @@ const (
 	envPrefixFileEnv    = "KONFIG_PREFIX_FILE_ENV"
 	envTelepresence     = "KONFIG_TELEPRESENCE"
 	envTelepresenceRoot = "TELEPRESENCE_ROOT"
+	envFile             = "KONFIG_FILE"
+
+	sourceFlag    = "flag"
+	sourceEnv     = "env"
+	sourceFile    = "file"
+	sourceDefault = "default"
+
+	sourceConfigFile = "config"
+
+	defaultKVSep = "="
 
 	line = "----------------------------------------------------------------------------------------------------"
+
+	secretMask = "******"
 )
 
 // Update represents a configuration field that received a new value.
 type Update struct {
-	Name  string
+	// Name is the name of the field.
+	Name string
+	// Path is the path to the field separated by dots (i.e. Database.Pool.Size for a nested field).
+	// For a field that is not nested, it is the same as Name.
+	Path string
+	// Value is the new value of the field.
 	Value interface{}
+	// OldValue is the value of the field before the update.
+	OldValue interface{}
+	// Source is the name of the source the new value is read from (i.e. flag, env, file, config, or the name of a custom source).
+	// It is default when a field falls back to its default value because its file is deleted.
+	Source string
+	// Key is the key the new value is read by (i.e. a flag name, an environment variable name, or a file path).
+	Key string
+	// Time is when the new value is applied.
+	Time time.Time
+	// Secret determines whether or not the field is a secret (see `secret` struct tag).
+	// The values of a secret field are masked in the string representation of the update.
+	Secret bool
+}
+
+// ChangeSet represents all updates applied together in one batch (i.e. from one file change or one configuration file write).
+type ChangeSet struct {
+	// Updates are the updates for all fields changed in the batch.
+	Updates []Update
+	// Time is when the batch is applied.
+	Time time.Time
+}
+
+// newUpdate creates an update for a field that received a new value from a source.
+func newUpdate(path string, oldValue, value interface{}, source, key string, secret bool) Update {
+	name := path
+	if i := strings.LastIndex(path, "."); i >= 0 {
+		name = path[i+1:]
+	}
+
+	return Update{
+		Name:     name,
+		Path:     path,
+		Value:    value,
+		OldValue: oldValue,
+		Source:   source,
+		Key:      key,
+		Time:     time.Now(),
+		Secret:   secret,
+	}
+}
+
+// String returns a one-line description of the update suitable for logging and auditing.
+//   LogLevel changed info -> debug from file /etc/config/log_level
+func (u Update) String() string {
+	oldValue := maskValue(u.Secret, fmt.Sprint(u.OldValue))
+	value := maskValue(u.Secret, fmt.Sprint(u.Value))
+	return fmt.Sprintf("%s changed %s -> %s from %s %s", u.Path, oldValue, value, u.Source, u.Key)
+}
+
+// Validator is implemented by configuration structs that can validate their values as a whole (i.e. cross-field checks).
+// Validate is called at the end of Pick and Watch and before applying every batch of new values received while watching.
+// When watching, Validate is called while the struct is locked, so it should not lock the struct itself.
+type Validator interface {
+	Validate() error
 }
 
 // fieldInfo has all the information for setting a struct field later.
 type fieldInfo struct {
-	v       reflect.Value
-	name    string
-	listSep string
+	Field
+	v   reflect.Value
+	def reflect.Value
+}
+
+// getDefault returns the default value of the field (the value of the field before reading any value).
+func (f fieldInfo) getDefault() reflect.Value {
+	if !f.def.IsValid() {
+		return reflect.Zero(f.v.Type())
+	}
+	return f.def
+}
+
+// FileSystem is the interface for reading files.
+// It can be used for reading files from a file system other than the operating system file system (i.e. in tests).
+type FileSystem interface {
+	ReadFile(name string) ([]byte, error)
+}
+
+// osFS is the FileSystem for reading files from the operating system file system.
+type osFS struct{}
+
+func (osFS) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(name)
 }
 
 // controller controls how configuration values are read.
 type controller struct {
+	args      []string
+	lookupEnv func(string) (string, bool)
+	flagSet   *flag.FlagSet
+	fs        FileSystem
+
 	debug         uint
 	listSep       string
+	trim          TrimMode
 	skipFlag      bool
 	skipEnv       bool
 	skipFileEnv   bool
@@ -64,55 +170,111 @@ type controller struct {
 	prefixEnv     string
 	prefixFileEnv string
 	telepresence  bool
+	file          string
+	sources       []Source
+	delivery      DeliveryPolicy
+	deliverySize  int
+	onDrop        func(Update)
+	handlers      []handler
+	reloadSignals []os.Signal
+	pollInterval  time.Duration
+	pollFallback  bool
+	debounce      time.Duration
+
+	subscribers        []chan Update
+	changeSets         []chan ChangeSet
+	initialUpdates     []Update
+	dispatchers        []*dispatcher
+	subscribersLock    sync.RWMutex
+	subscribersClosed  bool
+	watching           bool
+	stopping           chan struct{}
+	stoppingOnce       sync.Once
+	notifying          sync.WaitGroup
+	handling           sync.Mutex
+	watchErrs          chan error
+	fields             []fieldInfo
+	filesToFields      map[string][]fieldInfo
+	sourceKeysToFields map[string]map[string][]fieldInfo
+	fileHashesLock     sync.Mutex
+	fileHashes         map[string][sha256.Size]byte
+
+	fileLock   sync.RWMutex
+	fileValues map[string]interface{}
+
+	report *Report
+}
+
+// newController creates a new controller with defaults, options read from environment variables, and the given options.
+// The given options take precedence over the options read from environment variables.
+func newController(opts ...Option) *controller {
+	// The options are applied once first, so the options read from environment variables are looked up using LookupEnv option
+	e := &controller{}
+	for _, opt := range opts {
+		opt(e)
+	}
+
+	c := controllerFromEnv(e.lookupEnv)
+	for _, opt := range opts {
+		opt(c)
+	}
 
-	subscribers   []chan Update
-	filesToFields map[string]fieldInfo
+	return c
 }
 
 // controllerFromEnv creates a new controller with defaults and with options read from environment variables.
-func controllerFromEnv() *controller {
+// If lookupEnv is nil, environment variables are looked up from the process environment.
+func controllerFromEnv(lookupEnv func(string) (string, bool)) *controller {
+	getenv := (&controller{lookupEnv: lookupEnv}).getEnv
+
 	var debug uint
-	if str := os.Getenv(envDebug); str != "" {
+	if str := getenv(envDebug); str != "" {
 		// debug verbosity level should not be higher than 255 (8-bits)
 		if u, err := strconv.ParseUint(str, 10, 8); err == nil {
 			debug = uint(u)
 		}
 	}
 
-	listSep := os.Getenv(envListSep)
+	listSep := getenv(envListSep)
 
 	// Set the default list separator
 	if listSep == "" {
 		listSep = ","
 	}
 
+	// An unknown trim mode is ignored, so the default mode is used
+	trim, _ := parseTrimMode(getenv(envTrim))
+
 	var skipFlag bool
-	if str := os.Getenv(envSkipFlag); str != "" {
+	if str := getenv(envSkipFlag); str != "" {
 		skipFlag, _ = strconv.ParseBool(str)
 	}
 
 	var skipEnv bool
-	if str := os.Getenv(envSkipEnv); str != "" {
+	if str := getenv(envSkipEnv); str != "" {
 		skipEnv, _ = strconv.ParseBool(str)
 	}
 
 	var skipFileEnv bool
-	if str := os.Getenv(envSkipFileEnv); str != "" {
+	if str := getenv(envSkipFileEnv); str != "" {
 		skipFileEnv, _ = strconv.ParseBool(str)
 	}
 
-	prefixFlag := os.Getenv(envPrefixFlag)
-	prefixEnv := os.Getenv(envPrefixEnv)
-	prefixFileEnv := os.Getenv(envPrefixFileEnv)
+	prefixFlag := getenv(envPrefixFlag)
+	prefixEnv := getenv(envPrefixEnv)
+	prefixFileEnv := getenv(envPrefixFileEnv)
 
 	var telepresence bool
-	if str := os.Getenv(envTelepresence); str != "" {
+	if str := getenv(envTelepresence); str != "" {
 		telepresence, _ = strconv.ParseBool(str)
 	}
 
+	file := getenv(envFile)
+
 	return &controller{
 		debug:         debug,
 		listSep:       listSep,
+		trim:          trim,
 		skipFlag:      skipFlag,
 		skipEnv:       skipEnv,
 		skipFileEnv:   skipFileEnv,
@@ -120,15 +282,166 @@ func controllerFromEnv() *controller {
 		prefixEnv:     prefixEnv,
 		prefixFileEnv: prefixFileEnv,
 		telepresence:  telepresence,
+		file:          file,
 
-		subscribers:   nil,
-		filesToFields: map[string]fieldInfo{},
+		subscribers:        nil,
+		filesToFields:      map[string][]fieldInfo{},
+		sourceKeysToFields: map[string]map[string][]fieldInfo{},
 	}
 }
 
 // Option sets optional parameters for controller.
 type Option func(*controller)
 
+// Delivery is the option for delivering updates to every subscriber in order using a queue of the given size.
+// The policy determines what happens when the queue for a subscriber is full (see DeliveryPolicy).
+// Updates for values read initially never wait for room in the queue, since subscribers can only receive them once watching is started.
+// By default, every update is sent to every subscriber in a new goroutine, so updates may be received out of order.
+func Delivery(policy DeliveryPolicy, size int) Option {
+	return func(c *controller) {
+		c.delivery = policy
+		c.deliverySize = size
+	}
+}
+
+// OnDrop is the option for specifying a function that is called for every update not received by a subscriber
+// because of the delivery policy (i.e. for counting dropped updates in a metric).
+// Dropped updates are also logged.
+func OnDrop(f func(Update)) Option {
+	return func(c *controller) {
+		c.onDrop = f
+	}
+}
+
+// ChangeSets is the option for subscribing to batches of updates.
+// All updates applied together while watching (i.e. from one file change or one configuration file write) are sent as one ChangeSet
+// after the struct is unlocked, so subscribers can reconfigure once with a consistent view of the configuration.
+// Change sets are sent in order and watching waits for every change set to be received until the watch is stopped.
+// Values read initially are not sent as a change set.
+func ChangeSets(subscribers ...chan ChangeSet) Option {
+	return func(c *controller) {
+		c.changeSets = subscribers
+	}
+}
+
+// handler is a function called for updates to a field or to every field if the path is empty.
+type handler struct {
+	path string
+	f    func(Update)
+}
+
+// OnChange is the option for registering a function that is called whenever a field receives a new value while watching.
+// The field is specified by its name or its path separated by dots for a nested field (i.e. Database.Pool.Size).
+// The function is called with the old and new values of the field, including for values read initially, the same as subscribers.
+// It is not called when values are only read once (i.e. Pick and Explain).
+// Handlers are called one at a time and in order from the goroutine applying the updates, so they should return quickly.
+// You can pass this option more than once for registering several handlers.
+func OnChange(field string, f func(old, new interface{})) Option {
+	return func(c *controller) {
+		c.handlers = append(c.handlers, handler{
+			path: field,
+			f: func(update Update) {
+				f(update.OldValue, update.Value)
+			},
+		})
+	}
+}
+
+// OnAnyChange is the option for registering a function that is called whenever any field receives a new value while watching.
+// It is the same as OnChange for every field and the function is called with the update.
+func OnAnyChange(f func(Update)) Option {
+	return func(c *controller) {
+		c.handlers = append(c.handlers, handler{
+			f: f,
+		})
+	}
+}
+
+// ReloadOnSignal is the option for reading the values of all fields again from all sources whenever one of the given signals is received while watching.
+// If no signal is given, SIGHUP is used.
+// Fields are reloaded the same way as the Reload method of Loader.
+func ReloadOnSignal(signals ...os.Signal) Option {
+	return func(c *controller) {
+		if len(signals) == 0 {
+			signals = []os.Signal{syscall.SIGHUP}
+		}
+		c.reloadSignals = signals
+	}
+}
+
+// Polling is the option for watching files by checking them for changes at the given interval instead of using file system notifications
+// (i.e. for network file systems and FUSE mounts that do not support notifications).
+// A file is changed if its modification time, size, or content hash is changed.
+// If the interval is not positive, files are checked every 5 seconds.
+func Polling(interval time.Duration) Option {
+	return func(c *controller) {
+		if interval <= 0 {
+			interval = defaultPollInterval
+		}
+		c.pollInterval = interval
+		c.pollFallback = false
+	}
+}
+
+// PollingFallback is the option for watching files by checking them for changes at the given interval
+// only if watching them using file system notifications fails.
+// If the interval is not positive, files are checked every 5 seconds.
+func PollingFallback(interval time.Duration) Option {
+	return func(c *controller) {
+		if interval <= 0 {
+			interval = defaultPollInterval
+		}
+		c.pollInterval = interval
+		c.pollFallback = true
+	}
+}
+
+// Debounce is the option for applying changes to a file once no more changes to the file are received within the given window
+// (i.e. for files written in several chunks by editors and configuration agents).
+// Every file is debounced separately and files changed together are still applied in one batch.
+// Regardless of this option, a file rewritten with the same content is not applied again.
+func Debounce(window time.Duration) Option {
+	return func(c *controller) {
+		c.debounce = window
+	}
+}
+
+// Args is the option for specifying the command-line arguments that flag values are read from.
+// The arguments should not include the program name (i.e. os.Args[1:]).
+// By default, the command-line arguments of the process are used.
+func Args(args []string) Option {
+	return func(c *controller) {
+		c.args = args
+	}
+}
+
+// LookupEnv is the option for specifying a function for looking up environment variables.
+// The function is also used for looking up options set using environment variables (i.e. KONFIG_DEBUG).
+// By default, os.LookupEnv is used.
+func LookupEnv(lookup func(string) (string, bool)) Option {
+	return func(c *controller) {
+		c.lookupEnv = lookup
+	}
+}
+
+// FlagSet is the option for specifying the flag set that flags for fields are registered on.
+// By default, flags are registered on flag.CommandLine.
+func FlagSet(fs *flag.FlagSet) Option {
+	return func(c *controller) {
+		c.flagSet = fs
+	}
+}
+
+// FS is the option for specifying the file system that files are read from.
+// This applies to both files specified by file environment variables and the configuration file.
+// Files are still watched for changes on the operating system file system.
+// By default, files are read from the operating system file system.
+func FS(fs FileSystem) Option {
+	return func(c *controller) {
+		c.fs = fs
+	}
+}
+
 // Debug is the option for enabling logs for debugging purposes.
 // verbosity is the verbosity level of logs.
 // You can also enable this option by setting KONFIG_DEBUG environment variable to a verbosity level.
@@ -148,6 +461,15 @@ func ListSep(sep string) Option {
 	}
 }
 
+// Trim is the option for specifying how values read from files are trimmed for all fields.
+// By default, trailing newlines are removed (TrimNewline).
+// You can specify a trim mode for each field using `trim` struct tag (none, newline, or space).
+func Trim(mode TrimMode) Option {
+	return func(c *controller) {
+		c.trim = mode
+	}
+}
+
 // SkipFlag is the option for skipping command-line flags as a source for all fields.
 // You can skip command-line flag as a source for each field by setting `flag` struct tag to `-`.
 func SkipFlag() Option {
@@ -208,6 +530,28 @@ func Telepresence() Option {
 	}
 }
 
+// File is the option for reading values from a structured configuration file.
+// The format of the file is determined by its extension and it can be YAML (.yaml or .yml), JSON (.json), or TOML (.toml).
+// The key for each field is derived from the field name the same way as command-line flags (i.e. database.pool.size).
+// Values read from the configuration file have the lowest precedence after the file environment variables.
+// You can also set this option by setting KONFIG_FILE environment variable to the path of the file.
+func File(path string) Option {
+	return func(c *controller) {
+		c.file = path
+	}
+}
+
+// Sources is the option for adding custom sources for reading configuration values and specifying the precedence of sources.
+// Sources are tried in the given order and the first one that has a value for a field wins.
+// FlagSource, EnvSource, FileEnvSource, and ConfigFileSource can be used for specifying the precedence of built-in sources.
+// If none of the built-in sources is given, the given sources will be tried after the built-in ones.
+// If any of the built-in sources is given, the built-in sources not given will not be used.
+func Sources(sources ...Source) Option {
+	return func(c *controller) {
+		c.sources = sources
+	}
+}
+
 // String is used for printing debugging information.
 // The output should fit in one line.
 func (c *controller) String() string {
@@ -221,6 +565,10 @@ func (c *controller) String() string {
 		strs = append(strs, fmt.Sprintf("ListSep<%s>", c.listSep))
 	}
 
+	if c.trim != 0 {
+		strs = append(strs, fmt.Sprintf("Trim<%s>", c.trim))
+	}
+
 	if c.skipFlag {
 		strs = append(strs, "SkipFlag")
 	}
@@ -249,81 +597,184 @@ func (c *controller) String() string {
 		strs = append(strs, "Telepresence")
 	}
 
+	if c.file != "" {
+		strs = append(strs, fmt.Sprintf("File<%s>", c.file))
+	}
+
+	if len(c.sources) > 0 {
+		names := make([]string, len(c.sources))
+		for i, src := range c.sources {
+			names[i] = src.Name()
+		}
+		strs = append(strs, fmt.Sprintf("Sources<%s>", strings.Join(names, ",")))
+	}
+
+	if c.delivery != 0 {
+		strs = append(strs, fmt.Sprintf("Delivery<%s,%d>", c.delivery, c.deliverySize))
+	}
+
 	if len(c.subscribers) > 0 {
 		strs = append(strs, fmt.Sprintf("Subscribers<%d>", len(c.subscribers)))
 	}
 
+	if len(c.changeSets) > 0 {
+		strs = append(strs, fmt.Sprintf("ChangeSets<%d>", len(c.changeSets)))
+	}
+
+	if len(c.handlers) > 0 {
+		strs = append(strs, fmt.Sprintf("Handlers<%d>", len(c.handlers)))
+	}
+
+	if c.pollInterval > 0 {
+		if c.pollFallback {
+			strs = append(strs, fmt.Sprintf("PollingFallback<%s>", c.pollInterval))
+		} else {
+			strs = append(strs, fmt.Sprintf("Polling<%s>", c.pollInterval))
+		}
+	}
+
+	if c.debounce > 0 {
+		strs = append(strs, fmt.Sprintf("Debounce<%s>", c.debounce))
+	}
+
+	if len(c.reloadSignals) > 0 {
+		names := make([]string, len(c.reloadSignals))
+		for i, sig := range c.reloadSignals {
+			names[i] = sig.String()
+		}
+		strs = append(strs, fmt.Sprintf("ReloadOnSignal<%s>", strings.Join(names, ",")))
+	}
+
 	return strings.Join(strs, " + ")
 }
 
+// getArgs returns the command-line arguments of the controller.
+func (c *controller) getArgs() []string {
+	if c.args == nil {
+		return os.Args[1:]
+	}
+	return c.args
+}
+
+// getEnv returns the value of an environment variable from the environment of the controller.
+func (c *controller) getEnv(name string) string {
+	lookup := c.lookupEnv
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+
+	val, _ := lookup(name)
+	return val
+}
+
+// getFlagSet returns the flag set of the controller.
+func (c *controller) getFlagSet() *flag.FlagSet {
+	if c.flagSet == nil {
+		return flag.CommandLine
+	}
+	return c.flagSet
+}
+
+// getFS returns the file system of the controller.
+func (c *controller) getFS() FileSystem {
+	if c.fs == nil {
+		return osFS{}
+	}
+	return c.fs
+}
+
 func (c *controller) log(v uint, msg string, args ...interface{}) {
 	if v <= c.debug {
 		log.Printf(msg+"\n", args...)
 	}
 }
 
-// getFieldValue reads and returns the string value for a field from either
+// getFieldValue reads and returns the string value for a field from the first source that has a value for it.
+// By default, the sources in the order of precedence are
 //   - command-line flags,
 //   - environment variables,
-//   - or configuration files
-// If the value is read from a file, the second returned value will be the file path.
-func (c *controller) getFieldValue(fieldName, flagName, envName, fileEnvName string) (string, string) {
-	var value, filePath string
-
-	// First, try reading from flag
-	if value == "" && flagName != skip && !c.skipFlag {
-		value = getFlagValue(flagName)
-		c.log(5, "[%s] value read from flag %s: %s", fieldName, flagName, value)
-	}
-
-	// Second, try reading from environment variable
-	if value == "" && envName != skip && !c.skipEnv {
-		value = os.Getenv(envName)
-		c.log(5, "[%s] value read from environment variable %s: %s", fieldName, envName, value)
-	}
-
-	// Third, try reading from file
-	if value == "" && fileEnvName != skip && !c.skipFileEnv {
-		// Read file environment variable
-		filePath = os.Getenv(fileEnvName)
-		c.log(5, "[%s] value read from file environment variable %s: %s", fieldName, fileEnvName, filePath)
-
-		if filePath != "" {
-			// Check for Telepresence
-			// See https://telepresence.io/howto/volumes.html for details
-			if c.telepresence {
-				if mountPath := os.Getenv(envTelepresenceRoot); mountPath != "" {
-					filePath = filepath.Join(mountPath, filePath)
-					c.log(5, "[%s] telepresence mount path: %s", fieldName, mountPath)
-				}
-			}
+//   - configuration files specified by file environment variables,
+//   - or the structured configuration file
+// The second and third returned values are the name of the source and the key (i.e. flag name, environment variable name, or file path)
+// the value is read from. If the value is read from a file, the key will be the file path.
+func (c *controller) getFieldValue(f Field) (string, string, string) {
+	val, source, key, _ := c.lookupFieldValue(f)
+	return val, source, key
+}
 
-			// Read config file
-			if b, err := ioutil.ReadFile(filePath); err == nil {
-				value = string(b)
-				c.log(5, "[%s] value read from %s: %s", fieldName, filePath, value)
-			}
+// lookupFieldValue reads the value of a field the same way as getFieldValue.
+// It also returns the sources checked before the value is found that do not have any value for the field.
+func (c *controller) lookupFieldValue(f Field) (string, string, string, []Candidate) {
+	var checked []Candidate
+
+	for _, src := range c.getSources() {
+		value, key := src.Lookup(f)
+		c.log(5, "[%s] value read from %s %s: %s", f.Name, src.Name(), key, maskValue(f.Secret, value))
+
+		if value != "" {
+			return value, src.Name(), key, checked
+		}
+
+		// The file environment variable is checked even if it is not set
+		if _, ok := src.(*fileEnvSource); ok && key == "" && f.FileEnvName != skip && !c.skipFileEnv {
+			key = f.FileEnvName
+		}
+
+		// A source without any key is skipped for the field
+		if key != "" {
+			checked = append(checked, Candidate{Source: src.Name(), Key: key})
 		}
 	}
 
-	return value, filePath
+	return "", "", "", checked
+}
+
+// notifySubscribers calls the handlers for an update and sends the update to every subscriber channel in a new go routine.
+// Subscribers are not notified once their channels are closed.
+func (c *controller) notifySubscribers(update Update) {
+	c.notify(update, true)
 }
 
-// notifySubscribers sends an update to every subscriber channel in a new go routine.
-func (c *controller) notifySubscribers(name string, value interface{}) {
+// notify notifies handlers and subscribers of an update.
+// If wait is false, dispatchers queue the update without waiting for room in their queues (see dispatcher.push).
+func (c *controller) notify(update Update, wait bool) {
+	if len(c.subscribers) == 0 && len(c.handlers) == 0 {
+		return
+	}
+
+	c.subscribersLock.RLock()
+	defer c.subscribersLock.RUnlock()
+
+	name := update.Path
+
+	if c.subscribersClosed {
+		c.log(4, "[%s] subscribers are closed", name)
+		return
+	}
+
+	// Handlers are only called while watching, so reading values once (see Pick) does not call them
+	if c.watching {
+		c.callHandlers(update)
+	}
+
 	if len(c.subscribers) == 0 {
 		return
 	}
 
 	c.log(4, "[%s] notifying %d subscribers ...", name, len(c.subscribers))
 
-	update := Update{
-		Name:  name,
-		Value: value,
+	// Updates are queued in order for every subscriber when a delivery policy is set
+	if c.dispatchers != nil {
+		for _, d := range c.dispatchers {
+			d.push(update, wait)
+		}
+		return
 	}
 
+	c.notifying.Add(len(c.subscribers))
 	for i, sub := range c.subscribers {
 		go func(id int, ch chan Update) {
+			defer c.notifying.Done()
 			c.log(4, "[%s] notifying subscriber %d ...", name, id)
 			ch <- update
 			c.log(4, "[%s] subscriber %d notified", name, id)
@@ -331,603 +782,1013 @@ func (c *controller) notifySubscribers(name string, value interface{}) {
 	}
 }
 
-func (c *controller) setString(v reflect.Value, name, val string) bool {
-	if v.String() != val {
-		c.log(5, "[%s] setting string value: %s", name, val)
-		v.SetString(val)
-		c.notifySubscribers(name, val)
-		return true
-	}
-
-	return false
-}
+// notifyInitialUpdates notifies subscribers of values read initially.
+// It is called once all values are read and validated, so nothing is notified of values that are rejected.
+// Subscribers can only receive once watching is started, so notifying never waits for them.
+func (c *controller) notifyInitialUpdates() {
+	updates := c.initialUpdates
+	c.initialUpdates = nil
 
-func (c *controller) setBool(v reflect.Value, name, val string) bool {
-	if b, err := strconv.ParseBool(val); err == nil {
-		if v.Bool() != b {
-			c.log(5, "[%s] setting boolean value: %t", name, b)
-			v.SetBool(b)
-			c.notifySubscribers(name, b)
-			return true
-		}
+	for _, update := range updates {
+		c.notify(update, false)
 	}
-
-	return false
 }
 
-func (c *controller) setFloat32(v reflect.Value, name, val string) bool {
-	if f, err := strconv.ParseFloat(val, 32); err == nil {
-		if v.Float() != f {
-			c.log(5, "[%s] setting float value: %f", name, f)
-			v.SetFloat(f)
-			c.notifySubscribers(name, float32(f))
-			return true
-		}
-	}
-
-	return false
-}
+// callHandlers calls every handler registered for the field of an update in order.
+// Handlers are never called concurrently, even for updates from different watches.
+func (c *controller) callHandlers(update Update) {
+	c.handling.Lock()
+	defer c.handling.Unlock()
 
-func (c *controller) setFloat64(v reflect.Value, name, val string) bool {
-	if f, err := strconv.ParseFloat(val, 64); err == nil {
-		if v.Float() != f {
-			c.log(5, "[%s] setting float value: %f", name, f)
-			v.SetFloat(f)
-			c.notifySubscribers(name, f)
-			return true
+	for i, h := range c.handlers {
+		if h.path == "" || h.path == update.Path {
+			c.log(4, "[%s] calling handler %d ...", update.Path, i)
+			h.f(update)
 		}
 	}
-
-	return false
 }
 
-func (c *controller) setInt(v reflect.Value, name, val string) bool {
-	// int size and range are platform-dependent
-	if i, err := strconv.ParseInt(val, 10, 64); err == nil {
-		if v.Int() != i {
-			c.log(5, "[%s] setting integer value: %d", name, i)
-			v.SetInt(i)
-			c.notifySubscribers(name, int(i))
-			return true
-		}
+// notifyChangeSets sends a change set to every change set subscriber in order.
+// It waits for every subscriber to receive the change set.
+func (c *controller) notifyChangeSets(cs ChangeSet) {
+	if len(c.changeSets) == 0 {
+		return
 	}
 
-	return false
-}
+	c.subscribersLock.RLock()
+	defer c.subscribersLock.RUnlock()
 
-func (c *controller) setInt8(v reflect.Value, name, val string) bool {
-	if i, err := strconv.ParseInt(val, 10, 8); err == nil {
-		if v.Int() != i {
-			c.log(5, "[%s] setting integer value: %d", name, i)
-			v.SetInt(i)
-			c.notifySubscribers(name, int8(i))
-			return true
-		}
+	if c.subscribersClosed {
+		c.log(4, "change set subscribers are closed")
+		return
 	}
 
-	return false
-}
-
-func (c *controller) setInt16(v reflect.Value, name, val string) bool {
-	if i, err := strconv.ParseInt(val, 10, 16); err == nil {
-		if v.Int() != i {
-			c.log(5, "[%s] setting integer value: %d", name, i)
-			v.SetInt(i)
-			c.notifySubscribers(name, int16(i))
-			return true
+	// Sending is given up once watching stops, so stopping a watch does not wait for subscribers that do not receive anymore
+	for i, ch := range c.changeSets {
+		c.log(4, "sending a change set with %d updates to subscriber %d ...", len(cs.Updates), i)
+		select {
+		case ch <- cs:
+		case <-c.stopping:
+			c.log(4, "watch stopped, change set not sent to subscriber %d", i)
+			return
 		}
 	}
-
-	return false
 }
 
-func (c *controller) setInt32(v reflect.Value, name, val string) bool {
-	if i, err := strconv.ParseInt(val, 10, 32); err == nil {
-		if v.Int() != i {
-			c.log(5, "[%s] setting integer value: %d", name, i)
-			v.SetInt(i)
-			c.notifySubscribers(name, int32(i))
-			return true
+// stopNotifying stops sending change sets to subscribers that have not received them yet.
+// Dispatchers do not queue new updates anymore either, so notifying never blocks watching from stopping.
+// Updates already queued are still sent unless dispatchers are stopped (see stopDispatchers and closeSubscribers).
+func (c *controller) stopNotifying() {
+	c.stoppingOnce.Do(func() {
+		if c.stopping != nil {
+			close(c.stopping)
 		}
-	}
+	})
 
-	return false
+	for _, d := range c.dispatchers {
+		d.shutdown()
+	}
 }
 
-func (c *controller) setInt64(v reflect.Value, name, val string) bool {
-	if t := v.Type(); t.PkgPath() == "time" && t.Name() == "Duration" {
-		// time.Duration
-		if d, err := time.ParseDuration(val); err == nil {
-			if v.Interface() != d {
-				c.log(5, "[%s] setting duration value: %s", name, d)
-				v.Set(reflect.ValueOf(d))
-				c.notifySubscribers(name, d)
-				return true
-			}
-		}
-	} else if i, err := strconv.ParseInt(val, 10, 64); err == nil {
-		if v.Int() != i {
-			c.log(5, "[%s] setting integer value: %d", name, i)
-			v.SetInt(i)
-			c.notifySubscribers(name, i)
-			return true
-		}
-	}
+// closeSubscribers waits for all in-flight notifications to be received and then closes every subscriber channel once.
+// No subscriber is notified afterwards.
+func (c *controller) closeSubscribers() {
+	c.stopNotifying()
 
-	return false
-}
+	c.subscribersLock.Lock()
+	c.subscribersClosed = true
+	c.subscribersLock.Unlock()
 
-func (c *controller) setUint(v reflect.Value, name, val string) bool {
-	// uint size and range are platform-dependent
-	if u, err := strconv.ParseUint(val, 10, 64); err == nil {
-		if v.Uint() != u {
-			c.log(5, "[%s] setting unsigned integer value: %d", name, u)
-			v.SetUint(u)
-			c.notifySubscribers(name, uint(u))
-			return true
-		}
+	c.log(4, "waiting for subscribers to receive notifications ...")
+	for _, d := range c.dispatchers {
+		d.close()
 	}
+	c.notifying.Wait()
 
-	return false
-}
-
-func (c *controller) setUint8(v reflect.Value, name, val string) bool {
-	if u, err := strconv.ParseUint(val, 10, 8); err == nil {
-		if v.Uint() != u {
-			c.log(5, "[%s] setting unsigned integer value: %d", name, u)
-			v.SetUint(u)
-			c.notifySubscribers(name, uint8(u))
-			return true
+	// The same channel may be passed more than once
+	closed := map[chan Update]bool{}
+	for _, sub := range c.subscribers {
+		if !closed[sub] {
+			close(sub)
+			closed[sub] = true
 		}
 	}
 
-	return false
-}
-
-func (c *controller) setUint16(v reflect.Value, name, val string) bool {
-	if u, err := strconv.ParseUint(val, 10, 16); err == nil {
-		if v.Uint() != u {
-			c.log(5, "[%s] setting unsigned integer value: %d", name, u)
-			v.SetUint(u)
-			c.notifySubscribers(name, uint16(u))
-			return true
+	closedChangeSets := map[chan ChangeSet]bool{}
+	for _, sub := range c.changeSets {
+		if !closedChangeSets[sub] {
+			close(sub)
+			closedChangeSets[sub] = true
 		}
 	}
 
-	return false
+	c.log(4, "subscribers closed")
 }
 
-func (c *controller) setUint32(v reflect.Value, name, val string) bool {
-	if u, err := strconv.ParseUint(val, 10, 32); err == nil {
-		if v.Uint() != u {
-			c.log(5, "[%s] setting unsigned integer value: %d", name, u)
-			v.SetUint(u)
-			c.notifySubscribers(name, uint32(u))
-			return true
-		}
+// startDispatchers creates a dispatcher for every subscriber if a delivery policy is set.
+func (c *controller) startDispatchers() {
+	if c.delivery == 0 {
+		return
 	}
 
-	return false
+	c.dispatchers = make([]*dispatcher, len(c.subscribers))
+	for i, sub := range c.subscribers {
+		c.dispatchers[i] = newDispatcher(c, i, sub, c.delivery, c.deliverySize)
+	}
 }
 
-func (c *controller) setUint64(v reflect.Value, name, val string) bool {
-	if u, err := strconv.ParseUint(val, 10, 64); err == nil {
-		if v.Uint() != u {
-			c.log(5, "[%s] setting unsigned integer value: %d", name, u)
-			v.SetUint(u)
-			c.notifySubscribers(name, u)
-			return true
-		}
+// stopDispatchers stops every dispatcher without waiting for queued updates to be received by subscribers.
+func (c *controller) stopDispatchers() {
+	for _, d := range c.dispatchers {
+		d.stop()
 	}
-
-	return false
 }
 
-func (c *controller) setStruct(v reflect.Value, name, val string) bool {
-	if t := v.Type(); t.PkgPath() == "net/url" && t.Name() == "URL" {
-		// url.URL
-		if u, err := url.Parse(val); err == nil {
-			// u is a pointer
-			if !reflect.DeepEqual(v.Interface(), *u) {
-				c.log(5, "[%s] setting url value: %s", name, val)
-				v.Set(reflect.ValueOf(u).Elem())
-				c.notifySubscribers(name, *u)
-				return true
-			}
-		}
-	}
+// fail reports an error that stops watching.
+func (c *controller) fail(err error) {
+	c.log(1, "%s", err)
 
-	return false
+	select {
+	case c.watchErrs <- err:
+	default:
+	}
 }
 
-func (c *controller) setStringSlice(v reflect.Value, name string, vals []string) bool {
-	if !reflect.DeepEqual(v.Interface(), vals) {
-		c.log(5, "[%s] setting string slice: %v", name, vals)
-		v.Set(reflect.ValueOf(vals))
-		c.notifySubscribers(name, vals)
-		return true
+func setString(v reflect.Value, val string) (bool, error) {
+	if v.String() != val {
+		v.SetString(val)
+		return true, nil
 	}
 
-	return false
+	return false, nil
 }
 
-func (c *controller) setBoolSlice(v reflect.Value, name string, vals []string) bool {
-	bools := []bool{}
-	for _, val := range vals {
-		if b, err := strconv.ParseBool(val); err == nil {
-			bools = append(bools, b)
-		}
+func setBool(v reflect.Value, val string) (bool, error) {
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return false, err
 	}
 
-	if !reflect.DeepEqual(v.Interface(), bools) {
-		c.log(5, "[%s] setting boolean slice: %v", name, bools)
-		v.Set(reflect.ValueOf(bools))
-		c.notifySubscribers(name, bools)
-		return true
+	if v.Bool() != b {
+		v.SetBool(b)
+		return true, nil
 	}
 
-	return false
+	return false, nil
 }
 
-func (c *controller) setFloat32Slice(v reflect.Value, name string, vals []string) bool {
-	floats := []float32{}
-	for _, val := range vals {
-		if f, err := strconv.ParseFloat(val, 32); err == nil {
-			floats = append(floats, float32(f))
-		}
+func setFloat32(v reflect.Value, val string) (bool, error) {
+	f, err := strconv.ParseFloat(val, 32)
+	if err != nil {
+		return false, err
 	}
 
-	if !reflect.DeepEqual(v.Interface(), floats) {
-		c.log(5, "[%s] setting float32 slice: %v", name, floats)
-		v.Set(reflect.ValueOf(floats))
-		c.notifySubscribers(name, floats)
-		return true
+	if v.Float() != f {
+		v.SetFloat(f)
+		return true, nil
 	}
 
-	return false
+	return false, nil
 }
 
-func (c *controller) setFloat64Slice(v reflect.Value, name string, vals []string) bool {
-	floats := []float64{}
-	for _, val := range vals {
-		if f, err := strconv.ParseFloat(val, 64); err == nil {
-			floats = append(floats, f)
-		}
+func setFloat64(v reflect.Value, val string) (bool, error) {
+	f, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		return false, err
 	}
 
-	if !reflect.DeepEqual(v.Interface(), floats) {
-		c.log(5, "[%s] setting float64 slice: %v", name, floats)
-		v.Set(reflect.ValueOf(floats))
-		c.notifySubscribers(name, floats)
-		return true
+	if v.Float() != f {
+		v.SetFloat(f)
+		return true, nil
 	}
 
-	return false
+	return false, nil
 }
 
-func (c *controller) setIntSlice(v reflect.Value, name string, vals []string) bool {
+func setInt(v reflect.Value, val string) (bool, error) {
 	// int size and range are platform-dependent
-	ints := []int{}
-	for _, val := range vals {
-		if i, err := strconv.ParseInt(val, 10, 64); err == nil {
-			ints = append(ints, int(i))
-		}
+	i, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return false, err
 	}
 
-	if !reflect.DeepEqual(v.Interface(), ints) {
-		c.log(5, "[%s] setting int slice: %v", name, ints)
-		v.Set(reflect.ValueOf(ints))
-		c.notifySubscribers(name, ints)
-		return true
+	if v.Int() != i {
+		v.SetInt(i)
+		return true, nil
 	}
 
-	return false
+	return false, nil
 }
 
-func (c *controller) setInt8Slice(v reflect.Value, name string, vals []string) bool {
-	ints := []int8{}
-	for _, val := range vals {
-		if i, err := strconv.ParseInt(val, 10, 8); err == nil {
-			ints = append(ints, int8(i))
-		}
+func setInt8(v reflect.Value, val string) (bool, error) {
+	i, err := strconv.ParseInt(val, 10, 8)
+	if err != nil {
+		return false, err
 	}
 
-	if !reflect.DeepEqual(v.Interface(), ints) {
-		c.log(5, "[%s] setting int8 slice: %v", name, ints)
-		v.Set(reflect.ValueOf(ints))
-		c.notifySubscribers(name, ints)
-		return true
+	if v.Int() != i {
+		v.SetInt(i)
+		return true, nil
 	}
 
-	return false
+	return false, nil
 }
 
-func (c *controller) setInt16Slice(v reflect.Value, name string, vals []string) bool {
+func setInt16(v reflect.Value, val string) (bool, error) {
+	i, err := strconv.ParseInt(val, 10, 16)
+	if err != nil {
+		return false, err
+	}
+
+	if v.Int() != i {
+		v.SetInt(i)
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func setInt32(v reflect.Value, val string) (bool, error) {
+	i, err := strconv.ParseInt(val, 10, 32)
+	if err != nil {
+		return false, err
+	}
+
+	if v.Int() != i {
+		v.SetInt(i)
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func setInt64(v reflect.Value, val string) (bool, error) {
+	if t := v.Type(); t.PkgPath() == "time" && t.Name() == "Duration" {
+		// time.Duration
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return false, err
+		}
+
+		if v.Interface() != d {
+			v.Set(reflect.ValueOf(d))
+			return true, nil
+		}
+
+		return false, nil
+	}
+
+	i, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return false, err
+	}
+
+	if v.Int() != i {
+		v.SetInt(i)
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func setUint(v reflect.Value, val string) (bool, error) {
+	// uint size and range are platform-dependent
+	u, err := strconv.ParseUint(val, 10, 64)
+	if err != nil {
+		return false, err
+	}
+
+	if v.Uint() != u {
+		v.SetUint(u)
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func setUint8(v reflect.Value, val string) (bool, error) {
+	u, err := strconv.ParseUint(val, 10, 8)
+	if err != nil {
+		return false, err
+	}
+
+	if v.Uint() != u {
+		v.SetUint(u)
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func setUint16(v reflect.Value, val string) (bool, error) {
+	u, err := strconv.ParseUint(val, 10, 16)
+	if err != nil {
+		return false, err
+	}
+
+	if v.Uint() != u {
+		v.SetUint(u)
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func setUint32(v reflect.Value, val string) (bool, error) {
+	u, err := strconv.ParseUint(val, 10, 32)
+	if err != nil {
+		return false, err
+	}
+
+	if v.Uint() != u {
+		v.SetUint(u)
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func setUint64(v reflect.Value, val string) (bool, error) {
+	u, err := strconv.ParseUint(val, 10, 64)
+	if err != nil {
+		return false, err
+	}
+
+	if v.Uint() != u {
+		v.SetUint(u)
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func setStruct(v reflect.Value, val string) (bool, error) {
+	if t := v.Type(); t.PkgPath() == "net/url" && t.Name() == "URL" {
+		// url.URL
+		u, err := url.Parse(val)
+		if err != nil {
+			return false, err
+		}
+
+		// u is a pointer
+		if !reflect.DeepEqual(v.Interface(), *u) {
+			v.Set(reflect.ValueOf(u).Elem())
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func setStringSlice(v reflect.Value, vals []string) (bool, error) {
+	if !reflect.DeepEqual(v.Interface(), vals) {
+		v.Set(reflect.ValueOf(vals))
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func setBoolSlice(v reflect.Value, vals []string) (bool, error) {
+	bools := []bool{}
+	for _, val := range vals {
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return false, err
+		}
+
+		bools = append(bools, b)
+	}
+
+	if !reflect.DeepEqual(v.Interface(), bools) {
+		v.Set(reflect.ValueOf(bools))
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func setFloat32Slice(v reflect.Value, vals []string) (bool, error) {
+	floats := []float32{}
+	for _, val := range vals {
+		f, err := strconv.ParseFloat(val, 32)
+		if err != nil {
+			return false, err
+		}
+
+		floats = append(floats, float32(f))
+	}
+
+	if !reflect.DeepEqual(v.Interface(), floats) {
+		v.Set(reflect.ValueOf(floats))
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func setFloat64Slice(v reflect.Value, vals []string) (bool, error) {
+	floats := []float64{}
+	for _, val := range vals {
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return false, err
+		}
+
+		floats = append(floats, f)
+	}
+
+	if !reflect.DeepEqual(v.Interface(), floats) {
+		v.Set(reflect.ValueOf(floats))
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func setIntSlice(v reflect.Value, vals []string) (bool, error) {
+	// int size and range are platform-dependent
+	ints := []int{}
+	for _, val := range vals {
+		i, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return false, err
+		}
+
+		ints = append(ints, int(i))
+	}
+
+	if !reflect.DeepEqual(v.Interface(), ints) {
+		v.Set(reflect.ValueOf(ints))
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func setInt8Slice(v reflect.Value, vals []string) (bool, error) {
+	ints := []int8{}
+	for _, val := range vals {
+		i, err := strconv.ParseInt(val, 10, 8)
+		if err != nil {
+			return false, err
+		}
+
+		ints = append(ints, int8(i))
+	}
+
+	if !reflect.DeepEqual(v.Interface(), ints) {
+		v.Set(reflect.ValueOf(ints))
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func setInt16Slice(v reflect.Value, vals []string) (bool, error) {
 	ints := []int16{}
 	for _, val := range vals {
-		if i, err := strconv.ParseInt(val, 10, 16); err == nil {
-			ints = append(ints, int16(i))
+		i, err := strconv.ParseInt(val, 10, 16)
+		if err != nil {
+			return false, err
 		}
+
+		ints = append(ints, int16(i))
 	}
 
 	if !reflect.DeepEqual(v.Interface(), ints) {
-		c.log(5, "[%s] setting int16 slice: %v", name, ints)
 		v.Set(reflect.ValueOf(ints))
-		c.notifySubscribers(name, ints)
-		return true
+		return true, nil
 	}
 
-	return false
+	return false, nil
 }
 
-func (c *controller) setInt32Slice(v reflect.Value, name string, vals []string) bool {
+func setInt32Slice(v reflect.Value, vals []string) (bool, error) {
 	ints := []int32{}
 	for _, val := range vals {
-		if i, err := strconv.ParseInt(val, 10, 32); err == nil {
-			ints = append(ints, int32(i))
+		i, err := strconv.ParseInt(val, 10, 32)
+		if err != nil {
+			return false, err
 		}
+
+		ints = append(ints, int32(i))
 	}
 
 	if !reflect.DeepEqual(v.Interface(), ints) {
-		c.log(5, "[%s] setting int32 slice: %v", name, ints)
 		v.Set(reflect.ValueOf(ints))
-		c.notifySubscribers(name, ints)
-		return true
+		return true, nil
 	}
 
-	return false
+	return false, nil
 }
 
-func (c *controller) setInt64Slice(v reflect.Value, name string, vals []string) bool {
+func setInt64Slice(v reflect.Value, vals []string) (bool, error) {
 	if t := reflect.TypeOf(v.Interface()).Elem(); t.PkgPath() == "time" && t.Name() == "Duration" {
 		durations := []time.Duration{}
 		for _, val := range vals {
-			if d, err := time.ParseDuration(val); err == nil {
-				durations = append(durations, d)
+			d, err := time.ParseDuration(val)
+			if err != nil {
+				return false, err
 			}
+
+			durations = append(durations, d)
 		}
 
 		// []time.Duration
 		if !reflect.DeepEqual(v.Interface(), durations) {
-			c.log(5, "[%s] setting duration slice: %v", name, durations)
 			v.Set(reflect.ValueOf(durations))
-			c.notifySubscribers(name, durations)
-			return true
+			return true, nil
 		}
 	} else {
 		ints := []int64{}
 		for _, val := range vals {
-			if i, err := strconv.ParseInt(val, 10, 64); err == nil {
-				ints = append(ints, i)
+			i, err := strconv.ParseInt(val, 10, 64)
+			if err != nil {
+				return false, err
 			}
+
+			ints = append(ints, i)
 		}
 
 		if !reflect.DeepEqual(v.Interface(), ints) {
-			c.log(5, "[%s] setting int64 slice: %v", name, ints)
 			v.Set(reflect.ValueOf(ints))
-			c.notifySubscribers(name, ints)
-			return true
+			return true, nil
 		}
 	}
 
-	return false
+	return false, nil
 }
 
-func (c *controller) setUintSlice(v reflect.Value, name string, vals []string) bool {
+func setUintSlice(v reflect.Value, vals []string) (bool, error) {
 	// uint size and range are platform-dependent
 	uints := []uint{}
 	for _, val := range vals {
-		if u, err := strconv.ParseUint(val, 10, 64); err == nil {
-			uints = append(uints, uint(u))
+		u, err := strconv.ParseUint(val, 10, 64)
+		if err != nil {
+			return false, err
 		}
+
+		uints = append(uints, uint(u))
 	}
 
 	if !reflect.DeepEqual(v.Interface(), uints) {
-		c.log(5, "[%s] setting uint slice: %v", name, uints)
 		v.Set(reflect.ValueOf(uints))
-		c.notifySubscribers(name, uints)
-		return true
+		return true, nil
 	}
 
-	return false
+	return false, nil
 }
 
-func (c *controller) setUint8Slice(v reflect.Value, name string, vals []string) bool {
+func setUint8Slice(v reflect.Value, vals []string) (bool, error) {
 	uints := []uint8{}
 	for _, val := range vals {
-		if u, err := strconv.ParseUint(val, 10, 8); err == nil {
-			uints = append(uints, uint8(u))
+		u, err := strconv.ParseUint(val, 10, 8)
+		if err != nil {
+			return false, err
 		}
+
+		uints = append(uints, uint8(u))
 	}
 
 	if !reflect.DeepEqual(v.Interface(), uints) {
-		c.log(5, "[%s] setting uint8 slice: %v", name, uints)
 		v.Set(reflect.ValueOf(uints))
-		c.notifySubscribers(name, uints)
-		return true
+		return true, nil
 	}
 
-	return false
+	return false, nil
 }
 
-func (c *controller) setUint16Slice(v reflect.Value, name string, vals []string) bool {
+func setUint16Slice(v reflect.Value, vals []string) (bool, error) {
 	uints := []uint16{}
 	for _, val := range vals {
-		if u, err := strconv.ParseUint(val, 10, 16); err == nil {
-			uints = append(uints, uint16(u))
+		u, err := strconv.ParseUint(val, 10, 16)
+		if err != nil {
+			return false, err
 		}
+
+		uints = append(uints, uint16(u))
 	}
 
 	if !reflect.DeepEqual(v.Interface(), uints) {
-		c.log(5, "[%s] setting uint16 slice: %v", name, uints)
 		v.Set(reflect.ValueOf(uints))
-		c.notifySubscribers(name, uints)
-		return true
+		return true, nil
 	}
 
-	return false
+	return false, nil
 }
 
-func (c *controller) setUint32Slice(v reflect.Value, name string, vals []string) bool {
+func setUint32Slice(v reflect.Value, vals []string) (bool, error) {
 	uints := []uint32{}
 	for _, val := range vals {
-		if u, err := strconv.ParseUint(val, 10, 32); err == nil {
-			uints = append(uints, uint32(u))
+		u, err := strconv.ParseUint(val, 10, 32)
+		if err != nil {
+			return false, err
 		}
+
+		uints = append(uints, uint32(u))
 	}
 
 	if !reflect.DeepEqual(v.Interface(), uints) {
-		c.log(5, "[%s] setting uint32 slice: %v", name, uints)
 		v.Set(reflect.ValueOf(uints))
-		c.notifySubscribers(name, uints)
-		return true
+		return true, nil
 	}
 
-	return false
+	return false, nil
 }
 
-func (c *controller) setUint64Slice(v reflect.Value, name string, vals []string) bool {
+func setUint64Slice(v reflect.Value, vals []string) (bool, error) {
 	uints := []uint64{}
 	for _, val := range vals {
-		if u, err := strconv.ParseUint(val, 10, 64); err == nil {
-			uints = append(uints, u)
+		u, err := strconv.ParseUint(val, 10, 64)
+		if err != nil {
+			return false, err
 		}
+
+		uints = append(uints, u)
 	}
 
 	if !reflect.DeepEqual(v.Interface(), uints) {
-		c.log(5, "[%s] setting uint64 slice: %v", name, uints)
 		v.Set(reflect.ValueOf(uints))
-		c.notifySubscribers(name, uints)
-		return true
+		return true, nil
 	}
 
-	return false
+	return false, nil
 }
 
-func (c *controller) setURLSlice(v reflect.Value, name string, vals []string) bool {
+func setURLSlice(v reflect.Value, vals []string) (bool, error) {
 	t := reflect.TypeOf(v.Interface()).Elem()
 
 	if t.PkgPath() == "net/url" && t.Name() == "URL" {
 		urls := []url.URL{}
 		for _, val := range vals {
-			if u, err := url.Parse(val); err == nil {
-				urls = append(urls, *u)
+			u, err := url.Parse(val)
+			if err != nil {
+				return false, err
 			}
+
+			urls = append(urls, *u)
 		}
 
 		// []url.URL
 		if !reflect.DeepEqual(v.Interface(), urls) {
-			c.log(5, "[%s] setting url slice: %v", name, urls)
 			v.Set(reflect.ValueOf(urls))
-			c.notifySubscribers(name, urls)
-			return true
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// parseValue parses a string into a new value of a scalar type.
+// If a pointer to the type implements encoding.TextUnmarshaler or flag.Value, the value is parsed using that interface.
+func parseValue(t reflect.Type, val string) (reflect.Value, error) {
+	ptr := reflect.New(t)
+
+	switch u := ptr.Interface().(type) {
+	case encoding.TextUnmarshaler:
+		if err := u.UnmarshalText([]byte(val)); err != nil {
+			return reflect.Value{}, err
+		}
+		return ptr.Elem(), nil
+	case flag.Value:
+		if err := u.Set(val); err != nil {
+			return reflect.Value{}, err
+		}
+		return ptr.Elem(), nil
+	}
+
+	v := ptr.Elem()
+
+	switch t.Kind() {
+	case reflect.String:
+		v.SetString(val)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetBool(b)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(val, t.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetFloat(f)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if t.PkgPath() == "time" && t.Name() == "Duration" {
+			// time.Duration
+			d, err := time.ParseDuration(val)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v.SetInt(int64(d))
+		} else {
+			i, err := strconv.ParseInt(val, 10, t.Bits())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v.SetInt(i)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(val, 10, t.Bits())
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		v.SetUint(u)
+	case reflect.Struct:
+		if t.PkgPath() == "net/url" && t.Name() == "URL" {
+			// url.URL
+			u, err := url.Parse(val)
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v.Set(reflect.ValueOf(u).Elem())
+		}
+	}
+
+	return v, nil
+}
+
+func setUnmarshaler(v reflect.Value, val string) (bool, error) {
+	u, err := parseValue(v.Type(), val)
+	if err != nil {
+		return false, err
+	}
+
+	if !reflect.DeepEqual(v.Interface(), u.Interface()) {
+		v.Set(u)
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func setUnmarshalerSlice(v reflect.Value, vals []string) (bool, error) {
+	s := reflect.MakeSlice(v.Type(), 0, len(vals))
+	for _, val := range vals {
+		u, err := parseValue(v.Type().Elem(), val)
+		if err != nil {
+			return false, err
+		}
+
+		s = reflect.Append(s, u)
+	}
+
+	if !reflect.DeepEqual(v.Interface(), s.Interface()) {
+		v.Set(s)
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func setMap(v reflect.Value, vals []string, kvSep string) (bool, error) {
+	m := reflect.MakeMapWithSize(v.Type(), len(vals))
+	for _, val := range vals {
+		kv := strings.SplitN(val, kvSep, 2)
+		if len(kv) != 2 {
+			return false, fmt.Errorf("missing key/value separator %q in %q", kvSep, val)
+		}
+
+		elem, err := parseValue(v.Type().Elem(), kv[1])
+		if err != nil {
+			return false, err
 		}
+
+		m.SetMapIndex(reflect.ValueOf(kv[0]).Convert(v.Type().Key()), elem)
+	}
+
+	if !reflect.DeepEqual(v.Interface(), m.Interface()) {
+		v.Set(m)
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// resetField sets a field to its default value and returns true if the value of the field is changed.
+func (c *controller) resetField(f fieldInfo) bool {
+	def := f.getDefault()
+	if reflect.DeepEqual(f.v.Interface(), def.Interface()) {
+		return false
+	}
+
+	f.v.Set(def)
+	c.log(5, "[%s] default value set: %s", f.Name, maskValue(f.Secret, formatValue(f.v)))
+
+	return true
+}
+
+// setField parses a value and sets a field to it and returns true if the value of the field is changed.
+// The values of secret fields are masked in logs.
+func (c *controller) setField(f fieldInfo, val string) (bool, error) {
+	changed, err := c.setValue(f, val)
+	if changed {
+		c.log(5, "[%s] %s value set: %s", f.Name, f.v.Type(), maskValue(f.Secret, formatValue(f.v)))
 	}
 
-	return false
+	return changed, err
 }
 
-func (c *controller) setField(f fieldInfo, val string) bool {
+func (c *controller) setValue(f fieldInfo, val string) (bool, error) {
+	if isUnmarshaler(f.v.Type()) {
+		return setUnmarshaler(f.v, val)
+	}
+
 	switch f.v.Kind() {
 	case reflect.String:
-		return c.setString(f.v, f.name, val)
+		return setString(f.v, val)
 	case reflect.Bool:
-		return c.setBool(f.v, f.name, val)
+		return setBool(f.v, val)
 	case reflect.Float32:
-		return c.setFloat32(f.v, f.name, val)
+		return setFloat32(f.v, val)
 	case reflect.Float64:
-		return c.setFloat64(f.v, f.name, val)
+		return setFloat64(f.v, val)
 	case reflect.Int:
-		return c.setInt(f.v, f.name, val)
+		return setInt(f.v, val)
 	case reflect.Int8:
-		return c.setInt8(f.v, f.name, val)
+		return setInt8(f.v, val)
 	case reflect.Int16:
-		return c.setInt16(f.v, f.name, val)
+		return setInt16(f.v, val)
 	case reflect.Int32:
-		return c.setInt32(f.v, f.name, val)
+		return setInt32(f.v, val)
 	case reflect.Int64:
-		return c.setInt64(f.v, f.name, val)
+		return setInt64(f.v, val)
 	case reflect.Uint:
-		return c.setUint(f.v, f.name, val)
+		return setUint(f.v, val)
 	case reflect.Uint8:
-		return c.setUint8(f.v, f.name, val)
+		return setUint8(f.v, val)
 	case reflect.Uint16:
-		return c.setUint16(f.v, f.name, val)
+		return setUint16(f.v, val)
 	case reflect.Uint32:
-		return c.setUint32(f.v, f.name, val)
+		return setUint32(f.v, val)
 	case reflect.Uint64:
-		return c.setUint64(f.v, f.name, val)
+		return setUint64(f.v, val)
 	case reflect.Struct:
-		return c.setStruct(f.v, f.name, val)
+		return setStruct(f.v, val)
+	case reflect.Map:
+		vals := strings.Split(val, f.ListSep)
+		return setMap(f.v, vals, f.KVSep)
 
 	case reflect.Slice:
 		tSlice := reflect.TypeOf(f.v.Interface()).Elem()
-		vals := strings.Split(val, f.listSep)
+		vals := strings.Split(val, f.ListSep)
+
+		if isUnmarshaler(tSlice) {
+			return setUnmarshalerSlice(f.v, vals)
+		}
 
 		switch tSlice.Kind() {
 		case reflect.String:
-			return c.setStringSlice(f.v, f.name, vals)
+			return setStringSlice(f.v, vals)
 		case reflect.Bool:
-			return c.setBoolSlice(f.v, f.name, vals)
+			return setBoolSlice(f.v, vals)
 		case reflect.Float32:
-			return c.setFloat32Slice(f.v, f.name, vals)
+			return setFloat32Slice(f.v, vals)
 		case reflect.Float64:
-			return c.setFloat64Slice(f.v, f.name, vals)
+			return setFloat64Slice(f.v, vals)
 		case reflect.Int:
-			return c.setIntSlice(f.v, f.name, vals)
+			return setIntSlice(f.v, vals)
 		case reflect.Int8:
-			return c.setInt8Slice(f.v, f.name, vals)
+			return setInt8Slice(f.v, vals)
 		case reflect.Int16:
-			return c.setInt16Slice(f.v, f.name, vals)
+			return setInt16Slice(f.v, vals)
 		case reflect.Int32:
-			return c.setInt32Slice(f.v, f.name, vals)
+			return setInt32Slice(f.v, vals)
 		case reflect.Int64:
-			return c.setInt64Slice(f.v, f.name, vals)
+			return setInt64Slice(f.v, vals)
 		case reflect.Uint:
-			return c.setUintSlice(f.v, f.name, vals)
+			return setUintSlice(f.v, vals)
 		case reflect.Uint8:
-			return c.setUint8Slice(f.v, f.name, vals)
+			return setUint8Slice(f.v, vals)
 		case reflect.Uint16:
-			return c.setUint16Slice(f.v, f.name, vals)
+			return setUint16Slice(f.v, vals)
 		case reflect.Uint32:
-			return c.setUint32Slice(f.v, f.name, vals)
+			return setUint32Slice(f.v, vals)
 		case reflect.Uint64:
-			return c.setUint64Slice(f.v, f.name, vals)
+			return setUint64Slice(f.v, vals)
 		case reflect.Struct:
-			return c.setURLSlice(f.v, f.name, vals)
+			return setURLSlice(f.v, vals)
 		}
 	}
 
-	return false
+	return false, nil
 }
 
-func (c *controller) iterateOnFields(vStruct reflect.Value, handle func(v reflect.Value, fieldName, flagName, envName, fileEnvName, listSep string)) {
-	// Iterate over struct fields
-	for i := 0; i < vStruct.NumField(); i++ {
-		v := vStruct.Field(i)        // reflect.Value --> vField.Kind(), vField.Type().Name(), vField.Type().Kind(), vField.Interface()
-		f := vStruct.Type().Field(i) // reflect.StructField --> tField.Name, tField.Type.Name(), tField.Type.Kind(), tField.Tag.Get(tag)
+// fieldNames has the names of a field for reading its value from different sources.
+// For a nested struct field, the names are used as prefixes for the names of its fields.
+type fieldNames struct {
+	field   string
+	flag    string
+	env     string
+	fileEnv string
+}
 
-		// Skip unexported and unsupported fields
-		if !v.CanSet() || !isTypeSupported(v.Type()) {
-			continue
-		}
+// joinName joins the name of a parent struct field with the name of one of its fields.
+// If either of names is skipped, the joined name will be skipped too.
+func joinName(parent, sep, name string) string {
+	if parent == skip || name == skip {
+		return skip
+	}
+
+	return parent + sep + name
+}
+
+// getFieldNames returns the names of a struct field for reading its value from different sources.
+// If parent is nil, the field is a top-level field and the prefix options are applied to its names.
+func (c *controller) getFieldNames(f reflect.StructField, parent *fieldNames, nested bool) fieldNames {
+	flagName := f.Tag.Get(tagFlag)
+	envName := f.Tag.Get(tagEnv)
+	fileEnvName := f.Tag.Get(tagFileEnv)
+
+	// A nested struct field does not have a file environment variable itself,
+	// so the _FILE suffix is only added to the names of fields with supported types.
+	fileEnvVarName := getFileEnvVarName
+	if nested {
+		fileEnvVarName = getEnvVarName
+	}
 
+	if parent == nil {
 		// `flag:"..."`
-		flagName := f.Tag.Get(tagFlag)
 		if flagName == "" {
 			flagName = c.prefixFlag + getFlagName(f.Name)
 		}
 
 		// `env:"..."`
-		envName := f.Tag.Get(tagEnv)
 		if envName == "" {
 			envName = c.prefixEnv + getEnvVarName(f.Name)
 		}
 
 		// `fileenv:"..."`
-		fileEnvName := f.Tag.Get(tagFileEnv)
 		if fileEnvName == "" {
-			fileEnvName = c.prefixFileEnv + getFileEnvVarName(f.Name)
+			fileEnvName = c.prefixFileEnv + fileEnvVarName(f.Name)
+		}
+
+		return fieldNames{
+			field:   f.Name,
+			flag:    flagName,
+			env:     envName,
+			fileEnv: fileEnvName,
+		}
+	}
+
+	// For nested fields, struct tags only specify the part of the name for the current level
+
+	if flagName == "" {
+		flagName = getFlagName(f.Name)
+	}
+
+	if envName == "" {
+		envName = getEnvVarName(f.Name)
+	}
+
+	if fileEnvName == "" {
+		fileEnvName = fileEnvVarName(f.Name)
+	}
+
+	return fieldNames{
+		field:   parent.field + "." + f.Name,
+		flag:    joinName(parent.flag, ".", flagName),
+		env:     joinName(parent.env, "_", envName),
+		fileEnv: joinName(parent.fileEnv, "_", fileEnvName),
+	}
+}
+
+func (c *controller) iterateOnFields(vStruct reflect.Value, handle func(v reflect.Value, f Field)) {
+	c.iterateOnNestedFields(vStruct, nil, handle)
+}
+
+func (c *controller) iterateOnNestedFields(vStruct reflect.Value, parent *fieldNames, handle func(v reflect.Value, f Field)) {
+	// Iterate over struct fields
+	for i := 0; i < vStruct.NumField(); i++ {
+		v := vStruct.Field(i)        // reflect.Value --> vField.Kind(), vField.Type().Name(), vField.Type().Kind(), vField.Interface()
+		f := vStruct.Type().Field(i) // reflect.StructField --> tField.Name, tField.Type.Name(), tField.Type.Kind(), tField.Tag.Get(tag)
+
+		// Skip unexported fields
+		if !v.CanSet() {
+			continue
+		}
+
+		// Structs with unsupported types are nested configurations
+		nested := v.Kind() == reflect.Struct && !isTypeSupported(v.Type())
+
+		// Skip unsupported fields
+		if !nested && !isTypeSupported(v.Type()) {
+			continue
+		}
+
+		// Fields of an embedded struct without any struct tag are promoted to the parent struct
+		if nested && f.Anonymous && f.Tag.Get(tagFlag) == "" && f.Tag.Get(tagEnv) == "" && f.Tag.Get(tagFileEnv) == "" {
+			c.iterateOnNestedFields(v, parent, handle)
+			continue
+		}
+
+		names := c.getFieldNames(f, parent, nested)
+
+		if nested {
+			c.iterateOnNestedFields(v, &names, handle)
+			continue
 		}
 
 		// `sep:"..."`
@@ -936,7 +1797,33 @@ func (c *controller) iterateOnFields(vStruct reflect.Value, handle func(v reflec
 			listSep = c.listSep
 		}
 
-		handle(v, f.Name, flagName, envName, fileEnvName, listSep)
+		// `kvsep:"..."`
+		kvSep := f.Tag.Get(tagKVSep)
+		if kvSep == "" {
+			kvSep = defaultKVSep
+		}
+
+		// `trim:"..."`
+		trim := c.trim
+		if str := f.Tag.Get(tagTrim); str != "" {
+			if mode, ok := parseTrimMode(str); ok {
+				trim = mode
+			} else {
+				c.log(1, "[%s] invalid trim tag %q, using trim mode %s", names.field, str, trim)
+			}
+		}
+
+		handle(v, Field{
+			Name:        names.field,
+			FlagName:    names.flag,
+			EnvName:     names.env,
+			FileEnvName: names.fileEnv,
+			ListSep:     listSep,
+			KVSep:       kvSep,
+			Trim:        trim,
+			Secret:      hasOption(f.Tag, optSecret),
+			Tag:         f.Tag,
+		})
 	}
 }
 
@@ -944,8 +1831,8 @@ func (c *controller) registerFlags(vStruct reflect.Value) {
 	c.log(2, "Registering configuration flags ...")
 	c.log(2, line)
 
-	c.iterateOnFields(vStruct, func(v reflect.Value, fieldName, flagName, envName, fileEnvName, listSep string) {
-		if flagName == skip {
+	c.iterateOnFields(vStruct, func(v reflect.Value, f Field) {
+		if f.FlagName == skip {
 			return
 		}
 
@@ -956,74 +1843,378 @@ func (c *controller) registerFlags(vStruct reflect.Value) {
 			dataType = v.Type().String()
 		}
 
-		defaultValue := fmt.Sprintf("%v", v.Interface())
+		defaultValue := maskValue(f.Secret, fmt.Sprintf("%v", v.Interface()))
 
 		usage := fmt.Sprintf(
 			"%s:\t\t\t\t%s\n%s:\t\t\t\t%s\n%s:\t\t\t%s\n%s:\t%s",
 			"data type", dataType,
 			"default value", defaultValue,
-			"environment variable", envName,
-			"environment variable for file path", fileEnvName,
+			"environment variable", f.EnvName,
+			"environment variable for file path", f.FileEnvName,
 		)
 
 		// Define a flag for the field, so flag.Parse() can be called
-		if flag.Lookup(flagName) == nil {
+		if fs := c.getFlagSet(); fs.Lookup(f.FlagName) == nil {
 			switch v.Kind() {
 			case reflect.Bool:
-				flag.Bool(flagName, v.Bool(), usage)
+				fs.Bool(f.FlagName, v.Bool(), usage)
 			default:
-				flag.Var(&flagValue{}, flagName, usage)
+				fs.Var(&flagValue{}, f.FlagName, usage)
 			}
 		}
 
-		c.log(5, "[%s] flag registered: %s", fieldName, flagName)
+		c.log(5, "[%s] flag registered: %s", f.Name, f.FlagName)
 	})
 
 	c.log(5, line)
 }
 
-func (c *controller) readFields(vStruct reflect.Value) {
+func (c *controller) readFields(vStruct reflect.Value) error {
 	c.log(2, "Reading configuration values ...")
 	c.log(2, line)
 
-	c.iterateOnFields(vStruct, func(v reflect.Value, fieldName, flagName, envName, fileEnvName, listSep string) {
-		c.log(5, "[%s] expecting flag name: %s", fieldName, flagName)
-		c.log(5, "[%s] expecting environment variable name: %s", fieldName, envName)
-		c.log(5, "[%s] expecting file environment variable name: %s", fieldName, fileEnvName)
-		c.log(5, "[%s] expecting list separator: %s", fieldName, listSep)
+	b, err := c.readFile()
+	if err != nil {
+		c.log(1, err.Error())
+		return err
+	}
+
+	if b != nil {
+		c.setFileHash(c.file, b)
+	}
+
+	var errs Errors
+
+	c.iterateOnFields(vStruct, func(v reflect.Value, field Field) {
+		c.log(5, "[%s] expecting flag name: %s", field.Name, field.FlagName)
+		c.log(5, "[%s] expecting environment variable name: %s", field.Name, field.EnvName)
+		c.log(5, "[%s] expecting file environment variable name: %s", field.Name, field.FileEnvName)
+		c.log(5, "[%s] expecting list separator: %s", field.Name, field.ListSep)
+		c.log(5, "[%s] expecting key/value separator: %s", field.Name, field.KVSep)
 		defer c.log(5, line)
 
+		var changed bool
+		old := reflect.New(v.Type()).Elem()
+		old.Set(v)
+
+		// The current value is the default value of the field
+		f := fieldInfo{
+			Field: field,
+			v:     v,
+			def:   old,
+		}
+
+		// Keep the track of all fields for reloading them later
+		c.fields = append(c.fields, f)
+
 		// Try reading the configuration value for current field
-		val, path := c.getFieldValue(fieldName, flagName, envName, fileEnvName)
+		val, source, key, checked := c.lookupFieldValue(field)
+
+		// The field is reported once its value is resolved, including any error for the field
+		if c.report != nil {
+			nerrs := len(errs)
+			defer func() {
+				r := FieldReport{
+					Field:   field.Name,
+					Value:   maskValue(field.Secret, formatValue(v)),
+					Source:  sourceDefault,
+					Checked: checked,
+				}
+
+				if val != "" {
+					r.Source, r.Key = source, key
+				}
+
+				if len(errs) > nerrs {
+					r.Error = errs[len(errs)-1].Error()
+				}
+
+				*c.report = append(*c.report, r)
+			}()
+		}
 
-		// If no value, skip this field
+		// A file specified for the field is watched even if it cannot be read yet (i.e. it is created later),
+		// unless the value is read from a source with a higher precedence
+		if source != sourceFlag && source != sourceEnv && source != sourceFile {
+			if path := c.getFilePath(field); path != "" {
+				c.log(5, "[%s] file %s cannot be read, watching it for a value", field.Name, path)
+				c.filesToFields[path] = append(c.filesToFields[path], f)
+			}
+		}
+
+		// A field is reloaded whenever the config file changes if the config file has a higher precedence than the source of its value,
+		// so a key added to the config file later is applied too
+		for _, cand := range checked {
+			if cand.Source == sourceConfigFile {
+				c.trackSourceKey(cand.Source, cand.Key, f)
+			}
+		}
+
+		// If no value, skip this field unless it is required
 		if val == "" {
-			c.log(5, "[%s] falling back to default value: %v", fieldName, v.Interface())
+			if hasOption(field.Tag, optRequired) {
+				err := c.missingError(field)
+				c.log(1, err.Error())
+				errs = append(errs, err)
+				return
+			}
+
+			c.log(5, "[%s] falling back to default value: %s", field.Name, maskValue(field.Secret, formatValue(v)))
+		} else {
+			// Keep the track of which fields are read from which files and other sources
+			if source == sourceFile {
+				c.filesToFields[key] = append(c.filesToFields[key], f)
+			} else {
+				c.trackSourceKey(source, key, f)
+			}
+
+			var err error
+			if changed, err = c.setField(f, val); err != nil {
+				err = &ParseError{
+					Field:  field.Name,
+					Source: source,
+					Key:    key,
+					Value:  val,
+					Err:    err,
+					Secret: field.Secret,
+				}
+
+				c.log(1, err.Error())
+				errs = append(errs, err)
+				return
+			}
+		}
+
+		// Default values are validated as well
+		if err := validateField(field.Name, v, field.Tag); err != nil {
+			c.log(1, err.Error())
+			errs = append(errs, err)
 			return
 		}
 
-		f := fieldInfo{
-			v:       v,
-			name:    fieldName,
-			listSep: listSep,
+		// Subscribers are notified once all values are read and validated (see notifyInitialUpdates)
+		if changed {
+			c.initialUpdates = append(c.initialUpdates, newUpdate(field.Name, old.Interface(), v.Interface(), source, key, field.Secret))
+		}
+	})
+
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+// trackSourceKey keeps the track of a field that is reloaded whenever the value for a key changes in a source other than the built-in ones.
+// The config file is tracked the same way as custom sources.
+// Several fields can be read from the same key, so all of them are reloaded when the key changes.
+func (c *controller) trackSourceKey(source, key string, f fieldInfo) {
+	switch source {
+	case sourceFlag, sourceEnv, sourceFile:
+		return
+	}
+
+	if c.sourceKeysToFields[source] == nil {
+		c.sourceKeysToFields[source] = map[string][]fieldInfo{}
+	}
+
+	for _, tracked := range c.sourceKeysToFields[source][key] {
+		if tracked.Name == f.Name {
+			return
+		}
+	}
+
+	c.sourceKeysToFields[source][key] = append(c.sourceKeysToFields[source][key], f)
+}
+
+// missingError returns an error for a required field with the names of all sources that could provide a value for it.
+func (c *controller) missingError(f Field) *MissingError {
+	err := &MissingError{
+		Field: f.Name,
+	}
+
+	for _, src := range c.getSources() {
+		switch src.(type) {
+		case *flagSource:
+			if f.FlagName != skip && !c.skipFlag {
+				err.FlagName = f.FlagName
+			}
+		case *envSource:
+			if f.EnvName != skip && !c.skipEnv {
+				err.EnvName = f.EnvName
+			}
+		case *fileEnvSource:
+			if f.FileEnvName != skip && !c.skipFileEnv {
+				err.FileEnvName = f.FileEnvName
+			}
+		case *configFileSource:
+			if c.file != "" {
+				err.FileKey = getFileKey(f.Name)
+			}
 		}
+	}
+
+	return err
+}
 
-		// Keep the track of which fields are read from which files
-		if path != "" {
-			c.filesToFields[path] = f
+// reloadFields reads the values of a list of fields again from all sources and updates the fields with the new values in one batch.
+// If reset is true, fields that have no value anymore fall back to their default values; otherwise, they keep their current values.
+// It returns the validation error if the batch is rolled back (see updateFields).
+func (c *controller) reloadFields(config sync.Locker, fields []fieldInfo, reset bool) error {
+	updates := []fieldUpdate{}
+	for _, f := range fields {
+		if val, source, key := c.getFieldValue(f.Field); val != "" {
+			updates = append(updates, fieldUpdate{
+				fieldInfo: f,
+				val:       val,
+				source:    source,
+				key:       key,
+			})
+		} else if reset {
+			updates = append(updates, fieldUpdate{fieldInfo: f, source: sourceDefault, reset: true})
 		}
+	}
 
-		c.setField(f, val)
-	})
+	return c.updateFields(config, updates)
+}
+
+// fieldUpdate is a new value received for a field while watching.
+// If reset is true, the field falls back to its default value instead.
+type fieldUpdate struct {
+	fieldInfo
+	val    string
+	source string
+	key    string
+	reset  bool
+}
+
+// updateFields sets a batch of new values received while watching on fields and notifies subscribers of the changed fields.
+// A value that cannot be parsed or does not pass validation is not applied and its field keeps the current value.
+// If the struct implements Validator and the validation fails, all changes in the batch are rolled back, subscribers are not notified,
+// and the validation error is returned.
+func (c *controller) updateFields(config sync.Locker, updates []fieldUpdate) error {
+	type change struct {
+		fieldUpdate
+		old reflect.Value
+	}
+
+	changes := []change{}
+
+	config.Lock()
+
+	for _, u := range updates {
+		// Keep the current value for rolling back
+		old := reflect.New(u.v.Type()).Elem()
+		old.Set(u.v)
+
+		var changed bool
+		var err error
+
+		if u.reset {
+			c.log(3, "[%s] falling back to default value", u.Name)
+			changed = c.resetField(u.fieldInfo)
+		} else {
+			c.log(3, "received an update from %s %s: %s", u.source, u.key, maskValue(u.Secret, u.val))
+			changed, err = c.setField(u.fieldInfo, u.val)
+		}
+
+		if err != nil {
+			err = &ParseError{
+				Field:  u.Name,
+				Source: u.source,
+				Key:    u.key,
+				Value:  u.val,
+				Err:    err,
+				Secret: u.Secret,
+			}
+		} else if changed {
+			if err = validateField(u.Name, u.v, u.Tag); err != nil {
+				u.v.Set(old)
+				changed = false
+			}
+		}
+
+		if err != nil {
+			c.log(1, "%s", err)
+			continue
+		}
+
+		if changed {
+			changes = append(changes, change{u, old})
+		}
+	}
+
+	var err error
+	if len(changes) > 0 {
+		if err = validateConfig(config); err != nil {
+			c.log(1, "rolling back %d changes: %s", len(changes), err)
+
+			// Roll back in reverse order in case a field is changed more than once
+			for i := len(changes) - 1; i >= 0; i-- {
+				changes[i].v.Set(changes[i].old)
+			}
+
+			changes = nil
+		}
+	}
+
+	// Updates are created while the struct is locked, so they have the values of this batch
+	notifications := make([]Update, len(changes))
+	for i, ch := range changes {
+		notifications[i] = newUpdate(ch.Name, ch.old.Interface(), ch.v.Interface(), ch.source, ch.key, ch.Secret)
+	}
+
+	config.Unlock()
+
+	if len(notifications) > 0 {
+		c.notifyChangeSets(ChangeSet{
+			Updates: notifications,
+			Time:    time.Now(),
+		})
+	}
+
+	for _, update := range notifications {
+		c.notifySubscribers(update)
+	}
+
+	return err
+}
+
+// Loader reads configuration values using its own command-line arguments, environment variables, flag set, and file system.
+// They can be specified using Args, LookupEnv, FlagSet, and FS options respectively; otherwise, those of the process are used.
+// Loaders are independent of each other, so several configurations can be loaded in one process.
+type Loader struct {
+	opts []Option
+
+	watchesLock sync.Mutex
+	watches     map[*controller]sync.Locker
+}
+
+// New creates a new loader with the given options.
+// Options set using environment variables are looked up each time values are read, using the environment of the loader.
+func New(opts ...Option) *Loader {
+	return &Loader{
+		opts: opts,
+	}
 }
 
 // Pick reads values for exported fields of a struct from either command-line flags, environment variables, or configuration files.
 // You can also specify default values.
+// If any value cannot be parsed into the type of its field, an Errors value listing all such fields will be returned.
+// If the struct implements Validator, its Validate method is called at the end and its error is returned.
 func Pick(config interface{}, opts ...Option) error {
-	c := controllerFromEnv()
-	for _, opt := range opts {
-		opt(c)
-	}
+	return New(opts...).Pick(config)
+}
+
+// Pick reads values for exported fields of a struct the same way as the Pick function using the loader environment.
+func (l *Loader) Pick(config interface{}) error {
+	return l.pick(config, nil)
+}
+
+// pick reads values for exported fields of a struct and adds where every value comes from to a report if it is not nil.
+func (l *Loader) pick(config interface{}, report *Report) error {
+	c := newController(l.opts...)
+	c.report = report
 
 	c.log(2, line)
 	c.log(2, "Options: %s", c)
@@ -1036,20 +2227,98 @@ func Pick(config interface{}, opts ...Option) error {
 	}
 
 	c.registerFlags(v)
-	c.readFields(v)
+
+	if err := c.readFields(v); err != nil {
+		return err
+	}
+
+	if err := validateConfig(config); err != nil {
+		c.log(1, "%s", err)
+		return err
+	}
 
 	return nil
 }
 
 // Watch first reads values for exported fields of a struct from either command-line flags, environment variables, or configuration files.
 // It then watches any change to those fields that their values are read from configuration files and notifies subscribers on a channel.
+// Fields that their values are read from custom sources implementing WatchableSource are watched as well.
+// If the struct implements Validator, every batch of changes is validated before being applied and rolled back if the validation fails.
+// Subscribers and handlers are notified of values read initially only once all of them are read and validated, so nothing is notified of values that are rejected.
 func Watch(config sync.Locker, subscribers []chan Update, opts ...Option) (func(), error) {
-	c := controllerFromEnv()
-	c.subscribers = subscribers
-	for _, opt := range opts {
-		opt(c)
+	return New(opts...).Watch(config, subscribers)
+}
+
+// Watch reads and watches values for exported fields of a struct the same way as the Watch function using the loader environment.
+func (l *Loader) Watch(config sync.Locker, subscribers []chan Update) (func(), error) {
+	c, stop, err := l.watch(config, config, subscribers)
+	if err != nil {
+		return nil, err
+	}
+
+	// Subscriber channels are not closed, since subscribers may still be notified (see WatchContext)
+	var once sync.Once
+	close := func() {
+		once.Do(func() {
+			stop()
+			c.stopDispatchers()
+		})
+	}
+
+	return close, nil
+}
+
+// WatchContext reads and watches values for exported fields of a struct the same way as Watch until the context is cancelled.
+// Once watching stops, it waits for all in-flight notifications to be received and closes every subscriber channel,
+// so subscribers can range over their channels.
+// It returns once values are read initially and watching is started.
+// The returned function blocks until watching stops and returns the error that stopped it (i.e. context.Canceled).
+func WatchContext(ctx context.Context, config sync.Locker, subscribers []chan Update, opts ...Option) (func() error, error) {
+	return New(opts...).WatchContext(ctx, config, subscribers)
+}
+
+// WatchContext reads and watches values for exported fields of a struct the same way as the WatchContext function using the loader environment.
+func (l *Loader) WatchContext(ctx context.Context, config sync.Locker, subscribers []chan Update) (func() error, error) {
+	c, stop, err := l.watch(config, config, subscribers)
+	if err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	var watchErr error
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			watchErr = ctx.Err()
+		case watchErr = <-c.watchErrs:
+		}
+
+		c.log(2, "stopping watch: %s", watchErr)
+		stop()
+		c.closeSubscribers()
+		close(done)
+	}()
+
+	wait := func() error {
+		<-done
+		return watchErr
 	}
 
+	return wait, nil
+}
+
+// watch reads values for exported fields of a struct and starts watching them.
+// The locker is locked whenever new values are applied to the struct (see Value).
+// It returns the controller and a function for stopping all watches that returns once they are stopped.
+// The returned function stops dispatchers from queueing new updates, but they should be stopped or closed (see closeSubscribers) afterwards.
+func (l *Loader) watch(config interface{}, locker sync.Locker, subscribers []chan Update) (*controller, func(), error) {
+	c := newController(l.opts...)
+	c.subscribers = subscribers
+	c.watching = true
+	c.watchErrs = make(chan error, 1)
+	c.stopping = make(chan struct{})
+
 	c.log(2, line)
 	c.log(2, "Options: %s", c)
 	c.log(2, line)
@@ -1057,60 +2326,81 @@ func Watch(config sync.Locker, subscribers []chan Update, opts ...Option) (func(
 	v, err := validateStruct(config)
 	if err != nil {
 		c.log(1, err.Error())
-		return nil, err
+		return nil, nil, err
 	}
 
 	c.registerFlags(v)
-	c.readFields(v)
 
-	watcher, err := fsnotify.NewWatcher()
+	if err := c.readFields(v); err != nil {
+		return nil, nil, err
+	}
+
+	if err := validateConfig(config); err != nil {
+		c.log(1, "%s", err)
+		return nil, nil, err
+	}
+
+	// Values read initially are not applied while locked, so unlocking makes them visible through the locker (i.e. Value stores its first snapshot)
+	locker.Lock()
+	locker.Unlock()
+
+	// Subscribers are notified of values read initially too, before any change is watched
+	c.startDispatchers()
+	c.notifyInitialUpdates()
+
+	stopFiles, err := c.watchFiles(locker)
 	if err != nil {
-		c.log(1, "cannot create a watcher: %s", err)
-		return nil, err
+		c.stopDispatchers()
+		return nil, nil, err
 	}
 
-	go func() {
-		for {
-			select {
-			case event, ok := <-watcher.Events:
-				if !ok {
-					break
-				}
+	stopSources, err := c.watchSources(locker)
+	if err != nil {
+		stopFiles()
+		c.stopDispatchers()
+		return nil, nil, err
+	}
 
-				if event.Op&fsnotify.Write > 0 {
-					if f, ok := c.filesToFields[event.Name]; ok {
-						if b, err := ioutil.ReadFile(event.Name); err == nil {
-							val := string(b)
-							c.log(3, "received an update from %s: %s", event.Name, val)
-							config.Lock()
-							c.setField(f, val)
-							config.Unlock()
-						}
-					}
-				}
-			case err, ok := <-watcher.Errors:
-				if !ok {
-					break
-				}
-				c.log(1, "error watching: %s", err)
-			}
-		}
-	}()
+	stopSignals := c.watchSignals(locker)
 
-	for f := range c.filesToFields {
-		if err := watcher.Add(f); err != nil {
-			c.log(1, "cannot watch file %s: %s", f, err)
-			return nil, err
-		}
+	l.watchesLock.Lock()
+	if l.watches == nil {
+		l.watches = map[*controller]sync.Locker{}
 	}
+	l.watches[c] = locker
+	l.watchesLock.Unlock()
 
-	close := func() {
-		watcher.Close()
-		// TODO: closing subscriber channels causes data race if notifySubscribers is writing to any
-		/* for _, sub := range c.subscribers {
-			close(sub)
-		} */
+	stop := func() {
+		// A watch may be blocked on sending a change set or queueing an update, so notifying is stopped first
+		c.stopNotifying()
+
+		l.watchesLock.Lock()
+		delete(l.watches, c)
+		l.watchesLock.Unlock()
+
+		stopSignals()
+		stopSources()
+		stopFiles()
 	}
 
-	return close, nil
+	return c, stop, nil
+}
+
+// Reload reads the values of all fields again from all sources for every watch started by the loader and not stopped yet.
+// Environment variables are looked up again, the configuration file is read again,
+// and fields that their file environment variables were not set initially are read from their files too.
+// Fields that have no value anymore keep their current values.
+// Subscribers are notified of every field that changed the same way as when watching.
+// It returns once the new values are applied.
+func (l *Loader) Reload() {
+	l.watchesLock.Lock()
+	watches := make(map[*controller]sync.Locker, len(l.watches))
+	for c, locker := range l.watches {
+		watches[c] = locker
+	}
+	l.watchesLock.Unlock()
+
+	for c, locker := range watches {
+		c.reload(locker)
+	}
 }
@@ -1,14 +1,22 @@
 package konfig
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"flag"
+	"fmt"
 	"io/ioutil"
+	"log"
 	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
@@ -94,6 +102,125 @@ func configEqual(c1, c2 *config) bool {
 		reflect.DeepEqual(c1.FieldURLArray, c2.FieldURLArray)
 }
 
+type Endpoint struct {
+	Host string // `flag:"host" env:"HOST" fileenv:"HOST_FILE"`
+	Port int    // `flag:"port" env:"PORT" fileenv:"PORT_FILE"`
+}
+
+type nestedConfig struct {
+	Endpoint
+	Database struct {
+		URL  url.URL // `flag:"database.url" env:"DATABASE_URL" fileenv:"DATABASE_URL_FILE"`
+		Pool struct {
+			Size    int           // `flag:"database.pool.size" env:"DATABASE_POOL_SIZE" fileenv:"DATABASE_POOL_SIZE_FILE"`
+			Timeout time.Duration `flag:"wait" env:"WAIT" fileenv:"WAIT_PATH"`
+		}
+	}
+	Cache struct {
+		Address string // `flag:"redis.address" env:"REDIS_ADDRESS" fileenv:"-"`
+	} `flag:"redis" env:"REDIS" fileenv:"-"`
+}
+
+// logLevel implements encoding.TextUnmarshaler
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelError
+)
+
+func (l *logLevel) UnmarshalText(text []byte) error {
+	switch string(text) {
+	case "debug":
+		*l = levelDebug
+	case "info":
+		*l = levelInfo
+	case "error":
+		*l = levelError
+	default:
+		return fmt.Errorf("invalid log level: %s", text)
+	}
+
+	return nil
+}
+
+// byteSize implements flag.Value
+type byteSize uint64
+
+func (b *byteSize) String() string {
+	return fmt.Sprintf("%dB", *b)
+}
+
+func (b *byteSize) Set(val string) error {
+	units := map[string]uint64{"KB": 1 << 10, "MB": 1 << 20, "GB": 1 << 30, "B": 1}
+	for _, unit := range []string{"KB", "MB", "GB", "B"} {
+		if strings.HasSuffix(val, unit) {
+			n, err := strconv.ParseUint(strings.TrimSuffix(val, unit), 10, 64)
+			if err != nil {
+				return err
+			}
+
+			*b = byteSize(n * units[unit])
+			return nil
+		}
+	}
+
+	return fmt.Errorf("invalid byte size: %s", val)
+}
+
+type customConfig struct {
+	LogLevel  logLevel
+	Levels    []logLevel
+	CacheSize byteSize
+	Limits    map[string]byteSize
+	Since     time.Time
+}
+
+type requiredConfig struct {
+	Port        int    `required:"true"`
+	DatabaseURL string `konfig:"required" flag:"-"`
+	LogLevel    string `required:"false"`
+	Token       string `konfig:"required" fileenv:"-"`
+}
+
+type validatedConfig struct {
+	Port     int      `min:"1" max:"65535"`
+	LogLevel string   `oneof:"debug info warn error"`
+	Name     string   `pattern:"^[a-z]+$"`
+	Replicas int      `min:"1"`
+	Tags     []string `max:"2"`
+}
+
+type poolConfig struct {
+	sync.Mutex
+	MinConns int `min:"1"`
+	MaxConns int
+}
+
+func (c *poolConfig) Validate() error {
+	if c.MaxConns < c.MinConns {
+		return fmt.Errorf("max conns %d is less than min conns %d", c.MaxConns, c.MinConns)
+	}
+	return nil
+}
+
+type mapFS map[string]string
+
+func (fs mapFS) ReadFile(name string) ([]byte, error) {
+	content, ok := fs[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return []byte(content), nil
+}
+
+type mapConfig struct {
+	Labels   map[string]string
+	Limits   map[string]int           `sep:";" kvsep:":"`
+	Timeouts map[string]time.Duration // `flag:"timeouts" env:"TIMEOUTS" fileenv:"TIMEOUTS_FILE"`
+}
+
 func TestControllerFromEnv(t *testing.T) {
 	tests := []struct {
 		name               string
@@ -103,17 +230,18 @@ func TestControllerFromEnv(t *testing.T) {
 		{
 			name: "NoOption",
 			expectedController: &controller{
-				debug:         0,
-				listSep:       ",",
-				skipFlag:      false,
-				skipEnv:       false,
-				skipFileEnv:   false,
-				prefixFlag:    "",
-				prefixEnv:     "",
-				prefixFileEnv: "",
-				telepresence:  false,
-				subscribers:   nil,
-				filesToFields: map[string]fieldInfo{},
+				debug:              0,
+				listSep:            ",",
+				skipFlag:           false,
+				skipEnv:            false,
+				skipFileEnv:        false,
+				prefixFlag:         "",
+				prefixEnv:          "",
+				prefixFileEnv:      "",
+				telepresence:       false,
+				subscribers:        nil,
+				filesToFields:      map[string][]fieldInfo{},
+				sourceKeysToFields: map[string]map[string][]fieldInfo{},
 			},
 		},
 		{
@@ -122,17 +250,18 @@ func TestControllerFromEnv(t *testing.T) {
 				envDebug: "NaN",
 			},
 			expectedController: &controller{
-				debug:         0,
-				listSep:       ",",
-				skipFlag:      false,
-				skipEnv:       false,
-				skipFileEnv:   false,
-				prefixFlag:    "",
-				prefixEnv:     "",
-				prefixFileEnv: "",
-				telepresence:  false,
-				subscribers:   nil,
-				filesToFields: map[string]fieldInfo{},
+				debug:              0,
+				listSep:            ",",
+				skipFlag:           false,
+				skipEnv:            false,
+				skipFileEnv:        false,
+				prefixFlag:         "",
+				prefixEnv:          "",
+				prefixFileEnv:      "",
+				telepresence:       false,
+				subscribers:        nil,
+				filesToFields:      map[string][]fieldInfo{},
+				sourceKeysToFields: map[string]map[string][]fieldInfo{},
 			},
 		},
 		{
@@ -141,17 +270,18 @@ func TestControllerFromEnv(t *testing.T) {
 				envDebug: "999",
 			},
 			expectedController: &controller{
-				debug:         0,
-				listSep:       ",",
-				skipFlag:      false,
-				skipEnv:       false,
-				skipFileEnv:   false,
-				prefixFlag:    "",
-				prefixEnv:     "",
-				prefixFileEnv: "",
-				telepresence:  false,
-				subscribers:   nil,
-				filesToFields: map[string]fieldInfo{},
+				debug:              0,
+				listSep:            ",",
+				skipFlag:           false,
+				skipEnv:            false,
+				skipFileEnv:        false,
+				prefixFlag:         "",
+				prefixEnv:          "",
+				prefixFileEnv:      "",
+				telepresence:       false,
+				subscribers:        nil,
+				filesToFields:      map[string][]fieldInfo{},
+				sourceKeysToFields: map[string]map[string][]fieldInfo{},
 			},
 		},
 		{
@@ -160,17 +290,18 @@ func TestControllerFromEnv(t *testing.T) {
 				envDebug: "1",
 			},
 			expectedController: &controller{
-				debug:         1,
-				listSep:       ",",
-				skipFlag:      false,
-				skipEnv:       false,
-				skipFileEnv:   false,
-				prefixFlag:    "",
-				prefixEnv:     "",
-				prefixFileEnv: "",
-				telepresence:  false,
-				subscribers:   nil,
-				filesToFields: map[string]fieldInfo{},
+				debug:              1,
+				listSep:            ",",
+				skipFlag:           false,
+				skipEnv:            false,
+				skipFileEnv:        false,
+				prefixFlag:         "",
+				prefixEnv:          "",
+				prefixFileEnv:      "",
+				telepresence:       false,
+				subscribers:        nil,
+				filesToFields:      map[string][]fieldInfo{},
+				sourceKeysToFields: map[string]map[string][]fieldInfo{},
 			},
 		},
 		{
@@ -179,17 +310,18 @@ func TestControllerFromEnv(t *testing.T) {
 				envDebug: "2",
 			},
 			expectedController: &controller{
-				debug:         2,
-				listSep:       ",",
-				skipFlag:      false,
-				skipEnv:       false,
-				skipFileEnv:   false,
-				prefixFlag:    "",
-				prefixEnv:     "",
-				prefixFileEnv: "",
-				telepresence:  false,
-				subscribers:   nil,
-				filesToFields: map[string]fieldInfo{},
+				debug:              2,
+				listSep:            ",",
+				skipFlag:           false,
+				skipEnv:            false,
+				skipFileEnv:        false,
+				prefixFlag:         "",
+				prefixEnv:          "",
+				prefixFileEnv:      "",
+				telepresence:       false,
+				subscribers:        nil,
+				filesToFields:      map[string][]fieldInfo{},
+				sourceKeysToFields: map[string]map[string][]fieldInfo{},
 			},
 		},
 		{
@@ -198,17 +330,18 @@ func TestControllerFromEnv(t *testing.T) {
 				envDebug: "3",
 			},
 			expectedController: &controller{
-				debug:         3,
-				listSep:       ",",
-				skipFlag:      false,
-				skipEnv:       false,
-				skipFileEnv:   false,
-				prefixFlag:    "",
-				prefixEnv:     "",
-				prefixFileEnv: "",
-				telepresence:  false,
-				subscribers:   nil,
-				filesToFields: map[string]fieldInfo{},
+				debug:              3,
+				listSep:            ",",
+				skipFlag:           false,
+				skipEnv:            false,
+				skipFileEnv:        false,
+				prefixFlag:         "",
+				prefixEnv:          "",
+				prefixFileEnv:      "",
+				telepresence:       false,
+				subscribers:        nil,
+				filesToFields:      map[string][]fieldInfo{},
+				sourceKeysToFields: map[string]map[string][]fieldInfo{},
 			},
 		},
 		{
@@ -217,17 +350,59 @@ func TestControllerFromEnv(t *testing.T) {
 				envListSep: "|",
 			},
 			expectedController: &controller{
-				debug:         0,
-				listSep:       "|",
-				skipFlag:      false,
-				skipEnv:       false,
-				skipFileEnv:   false,
-				prefixFlag:    "",
-				prefixEnv:     "",
-				prefixFileEnv: "",
-				telepresence:  false,
-				subscribers:   nil,
-				filesToFields: map[string]fieldInfo{},
+				debug:              0,
+				listSep:            "|",
+				skipFlag:           false,
+				skipEnv:            false,
+				skipFileEnv:        false,
+				prefixFlag:         "",
+				prefixEnv:          "",
+				prefixFileEnv:      "",
+				telepresence:       false,
+				subscribers:        nil,
+				filesToFields:      map[string][]fieldInfo{},
+				sourceKeysToFields: map[string]map[string][]fieldInfo{},
+			},
+		},
+		{
+			name: "Trim",
+			env: map[string]string{
+				envTrim: "space",
+			},
+			expectedController: &controller{
+				debug:              0,
+				listSep:            ",",
+				trim:               TrimSpace,
+				skipFlag:           false,
+				skipEnv:            false,
+				skipFileEnv:        false,
+				prefixFlag:         "",
+				prefixEnv:          "",
+				prefixFileEnv:      "",
+				telepresence:       false,
+				subscribers:        nil,
+				filesToFields:      map[string][]fieldInfo{},
+				sourceKeysToFields: map[string]map[string][]fieldInfo{},
+			},
+		},
+		{
+			name: "UnknownTrim",
+			env: map[string]string{
+				envTrim: "all",
+			},
+			expectedController: &controller{
+				debug:              0,
+				listSep:            ",",
+				skipFlag:           false,
+				skipEnv:            false,
+				skipFileEnv:        false,
+				prefixFlag:         "",
+				prefixEnv:          "",
+				prefixFileEnv:      "",
+				telepresence:       false,
+				subscribers:        nil,
+				filesToFields:      map[string][]fieldInfo{},
+				sourceKeysToFields: map[string]map[string][]fieldInfo{},
 			},
 		},
 		{
@@ -236,17 +411,18 @@ func TestControllerFromEnv(t *testing.T) {
 				envSkipFlag: "true",
 			},
 			expectedController: &controller{
-				debug:         0,
-				listSep:       ",",
-				skipFlag:      true,
-				skipEnv:       false,
-				skipFileEnv:   false,
-				prefixFlag:    "",
-				prefixEnv:     "",
-				prefixFileEnv: "",
-				telepresence:  false,
-				subscribers:   nil,
-				filesToFields: map[string]fieldInfo{},
+				debug:              0,
+				listSep:            ",",
+				skipFlag:           true,
+				skipEnv:            false,
+				skipFileEnv:        false,
+				prefixFlag:         "",
+				prefixEnv:          "",
+				prefixFileEnv:      "",
+				telepresence:       false,
+				subscribers:        nil,
+				filesToFields:      map[string][]fieldInfo{},
+				sourceKeysToFields: map[string]map[string][]fieldInfo{},
 			},
 		},
 		{
@@ -255,17 +431,18 @@ func TestControllerFromEnv(t *testing.T) {
 				envSkipEnv: "true",
 			},
 			expectedController: &controller{
-				debug:         0,
-				listSep:       ",",
-				skipFlag:      false,
-				skipEnv:       true,
-				skipFileEnv:   false,
-				prefixFlag:    "",
-				prefixEnv:     "",
-				prefixFileEnv: "",
-				telepresence:  false,
-				subscribers:   nil,
-				filesToFields: map[string]fieldInfo{},
+				debug:              0,
+				listSep:            ",",
+				skipFlag:           false,
+				skipEnv:            true,
+				skipFileEnv:        false,
+				prefixFlag:         "",
+				prefixEnv:          "",
+				prefixFileEnv:      "",
+				telepresence:       false,
+				subscribers:        nil,
+				filesToFields:      map[string][]fieldInfo{},
+				sourceKeysToFields: map[string]map[string][]fieldInfo{},
 			},
 		},
 		{
@@ -274,17 +451,18 @@ func TestControllerFromEnv(t *testing.T) {
 				envSkipFileEnv: "true",
 			},
 			expectedController: &controller{
-				debug:         0,
-				listSep:       ",",
-				skipFlag:      false,
-				skipEnv:       false,
-				skipFileEnv:   true,
-				prefixFlag:    "",
-				prefixEnv:     "",
-				prefixFileEnv: "",
-				telepresence:  false,
-				subscribers:   nil,
-				filesToFields: map[string]fieldInfo{},
+				debug:              0,
+				listSep:            ",",
+				skipFlag:           false,
+				skipEnv:            false,
+				skipFileEnv:        true,
+				prefixFlag:         "",
+				prefixEnv:          "",
+				prefixFileEnv:      "",
+				telepresence:       false,
+				subscribers:        nil,
+				filesToFields:      map[string][]fieldInfo{},
+				sourceKeysToFields: map[string]map[string][]fieldInfo{},
 			},
 		},
 		{
@@ -293,17 +471,18 @@ func TestControllerFromEnv(t *testing.T) {
 				envPrefixFlag: "config.",
 			},
 			expectedController: &controller{
-				debug:         0,
-				listSep:       ",",
-				skipFlag:      false,
-				skipEnv:       false,
-				skipFileEnv:   false,
-				prefixFlag:    "config.",
-				prefixEnv:     "",
-				prefixFileEnv: "",
-				telepresence:  false,
-				subscribers:   nil,
-				filesToFields: map[string]fieldInfo{},
+				debug:              0,
+				listSep:            ",",
+				skipFlag:           false,
+				skipEnv:            false,
+				skipFileEnv:        false,
+				prefixFlag:         "config.",
+				prefixEnv:          "",
+				prefixFileEnv:      "",
+				telepresence:       false,
+				subscribers:        nil,
+				filesToFields:      map[string][]fieldInfo{},
+				sourceKeysToFields: map[string]map[string][]fieldInfo{},
 			},
 		},
 		{
@@ -312,17 +491,18 @@ func TestControllerFromEnv(t *testing.T) {
 				envPrefixEnv: "CONFIG_",
 			},
 			expectedController: &controller{
-				debug:         0,
-				listSep:       ",",
-				skipFlag:      false,
-				skipEnv:       false,
-				skipFileEnv:   false,
-				prefixFlag:    "",
-				prefixEnv:     "CONFIG_",
-				prefixFileEnv: "",
-				telepresence:  false,
-				subscribers:   nil,
-				filesToFields: map[string]fieldInfo{},
+				debug:              0,
+				listSep:            ",",
+				skipFlag:           false,
+				skipEnv:            false,
+				skipFileEnv:        false,
+				prefixFlag:         "",
+				prefixEnv:          "CONFIG_",
+				prefixFileEnv:      "",
+				telepresence:       false,
+				subscribers:        nil,
+				filesToFields:      map[string][]fieldInfo{},
+				sourceKeysToFields: map[string]map[string][]fieldInfo{},
 			},
 		},
 		{
@@ -331,17 +511,18 @@ func TestControllerFromEnv(t *testing.T) {
 				envPrefixFileEnv: "CONFIG_",
 			},
 			expectedController: &controller{
-				debug:         0,
-				listSep:       ",",
-				skipFlag:      false,
-				skipEnv:       false,
-				skipFileEnv:   false,
-				prefixFlag:    "",
-				prefixEnv:     "",
-				prefixFileEnv: "CONFIG_",
-				telepresence:  false,
-				subscribers:   nil,
-				filesToFields: map[string]fieldInfo{},
+				debug:              0,
+				listSep:            ",",
+				skipFlag:           false,
+				skipEnv:            false,
+				skipFileEnv:        false,
+				prefixFlag:         "",
+				prefixEnv:          "",
+				prefixFileEnv:      "CONFIG_",
+				telepresence:       false,
+				subscribers:        nil,
+				filesToFields:      map[string][]fieldInfo{},
+				sourceKeysToFields: map[string]map[string][]fieldInfo{},
 			},
 		},
 		{
@@ -350,17 +531,39 @@ func TestControllerFromEnv(t *testing.T) {
 				envTelepresence: "true",
 			},
 			expectedController: &controller{
-				debug:         0,
-				listSep:       ",",
-				skipFlag:      false,
-				skipEnv:       false,
-				skipFileEnv:   false,
-				prefixFlag:    "",
-				prefixEnv:     "",
-				prefixFileEnv: "",
-				telepresence:  true,
-				subscribers:   nil,
-				filesToFields: map[string]fieldInfo{},
+				debug:              0,
+				listSep:            ",",
+				skipFlag:           false,
+				skipEnv:            false,
+				skipFileEnv:        false,
+				prefixFlag:         "",
+				prefixEnv:          "",
+				prefixFileEnv:      "",
+				telepresence:       true,
+				subscribers:        nil,
+				filesToFields:      map[string][]fieldInfo{},
+				sourceKeysToFields: map[string]map[string][]fieldInfo{},
+			},
+		},
+		{
+			name: "File",
+			env: map[string]string{
+				envFile: "config.yaml",
+			},
+			expectedController: &controller{
+				debug:              0,
+				listSep:            ",",
+				skipFlag:           false,
+				skipEnv:            false,
+				skipFileEnv:        false,
+				prefixFlag:         "",
+				prefixEnv:          "",
+				prefixFileEnv:      "",
+				telepresence:       false,
+				file:               "config.yaml",
+				subscribers:        nil,
+				filesToFields:      map[string][]fieldInfo{},
+				sourceKeysToFields: map[string]map[string][]fieldInfo{},
 			},
 		},
 		{
@@ -368,6 +571,7 @@ func TestControllerFromEnv(t *testing.T) {
 			env: map[string]string{
 				envDebug:         "3",
 				envListSep:       "|",
+				envTrim:          "none",
 				envSkipFlag:      "true",
 				envSkipEnv:       "true",
 				envSkipFileEnv:   "true",
@@ -375,32 +579,35 @@ func TestControllerFromEnv(t *testing.T) {
 				envPrefixEnv:     "CONFIG_",
 				envPrefixFileEnv: "CONFIG_",
 				envTelepresence:  "true",
+				envFile:          "config.yaml",
 			},
 			expectedController: &controller{
-				debug:         3,
-				listSep:       "|",
-				skipFlag:      true,
-				skipEnv:       true,
-				skipFileEnv:   true,
-				prefixFlag:    "config.",
-				prefixEnv:     "CONFIG_",
-				prefixFileEnv: "CONFIG_",
-				telepresence:  true,
-				subscribers:   nil,
-				filesToFields: map[string]fieldInfo{},
+				debug:              3,
+				listSep:            "|",
+				trim:               TrimNone,
+				skipFlag:           true,
+				skipEnv:            true,
+				skipFileEnv:        true,
+				prefixFlag:         "config.",
+				prefixEnv:          "CONFIG_",
+				prefixFileEnv:      "CONFIG_",
+				telepresence:       true,
+				file:               "config.yaml",
+				subscribers:        nil,
+				filesToFields:      map[string][]fieldInfo{},
+				sourceKeysToFields: map[string]map[string][]fieldInfo{},
 			},
 		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			for name, value := range tc.env {
-				err := os.Setenv(name, value)
-				assert.NoError(t, err)
-				defer os.Unsetenv(name)
+			lookupEnv := func(name string) (string, bool) {
+				val, ok := tc.env[name]
+				return val, ok
 			}
 
-			c := controllerFromEnv()
+			c := controllerFromEnv(lookupEnv)
 			assert.Equal(t, tc.expectedController, c)
 		})
 	}
@@ -452,6 +659,29 @@ func TestListSep(t *testing.T) {
 	}
 }
 
+func TestTrim(t *testing.T) {
+	tests := []struct {
+		c        *controller
+		mode     TrimMode
+		expected *controller
+	}{
+		{
+			&controller{},
+			TrimSpace,
+			&controller{
+				trim: TrimSpace,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		opt := Trim(tc.mode)
+		opt(tc.c)
+
+		assert.Equal(t, tc.expected, tc.c)
+	}
+}
+
 func TestSkipFlag(t *testing.T) {
 	tests := []struct {
 		c        *controller
@@ -523,85 +753,527 @@ func TestPrefixFlag(t *testing.T) {
 	}{
 		{
 			&controller{},
-			"config.",
-			&controller{
-				prefixFlag: "config.",
-			},
+			"config.",
+			&controller{
+				prefixFlag: "config.",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		opt := PrefixFlag(tc.prefix)
+		opt(tc.c)
+
+		assert.Equal(t, tc.expected, tc.c)
+	}
+}
+
+func TestPrefixEnv(t *testing.T) {
+	tests := []struct {
+		c        *controller
+		prefix   string
+		expected *controller
+	}{
+		{
+			&controller{},
+			"CONFIG_",
+			&controller{
+				prefixEnv: "CONFIG_",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		opt := PrefixEnv(tc.prefix)
+		opt(tc.c)
+
+		assert.Equal(t, tc.expected, tc.c)
+	}
+}
+
+func TestPrefixFileEnv(t *testing.T) {
+	tests := []struct {
+		c        *controller
+		prefix   string
+		expected *controller
+	}{
+		{
+			&controller{},
+			"CONFIG_",
+			&controller{
+				prefixFileEnv: "CONFIG_",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		opt := PrefixFileEnv(tc.prefix)
+		opt(tc.c)
+
+		assert.Equal(t, tc.expected, tc.c)
+	}
+}
+
+func TestTelepresence(t *testing.T) {
+	tests := []struct {
+		c        *controller
+		expected *controller
+	}{
+		{
+			&controller{},
+			&controller{
+				telepresence: true,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		opt := Telepresence()
+		opt(tc.c)
+
+		assert.Equal(t, tc.expected, tc.c)
+	}
+}
+
+func TestFile(t *testing.T) {
+	tests := []struct {
+		c        *controller
+		path     string
+		expected *controller
+	}{
+		{
+			&controller{},
+			"config.yaml",
+			&controller{
+				file: "config.yaml",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		opt := File(tc.path)
+		opt(tc.c)
+
+		assert.Equal(t, tc.expected, tc.c)
+	}
+}
+
+func TestDelivery(t *testing.T) {
+	tests := []struct {
+		c        *controller
+		policy   DeliveryPolicy
+		size     int
+		expected *controller
+	}{
+		{
+			&controller{},
+			DropOldest, 10,
+			&controller{
+				delivery:     DropOldest,
+				deliverySize: 10,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		opt := Delivery(tc.policy, tc.size)
+		opt(tc.c)
+
+		assert.Equal(t, tc.expected, tc.c)
+	}
+}
+
+func TestOnDrop(t *testing.T) {
+	tests := []struct {
+		c      *controller
+		update Update
+	}{
+		{
+			&controller{},
+			Update{Name: "LogLevel", Path: "LogLevel", Value: "debug"},
+		},
+	}
+
+	for _, tc := range tests {
+		var dropped Update
+		opt := OnDrop(func(update Update) {
+			dropped = update
+		})
+		opt(tc.c)
+
+		tc.c.onDrop(tc.update)
+		assert.Equal(t, tc.update, dropped)
+	}
+}
+
+func TestOnChange(t *testing.T) {
+	tests := []struct {
+		c             *controller
+		field         string
+		update        Update
+		expectedPath  string
+		expectedCalls [][]interface{}
+	}{
+		{
+			&controller{},
+			"LogLevel",
+			Update{Name: "LogLevel", Path: "LogLevel", Value: "debug", OldValue: "info"},
+			"LogLevel",
+			[][]interface{}{{"info", "debug"}},
+		},
+		{
+			&controller{
+				handlers: []handler{
+					{path: "Port", f: func(Update) {}},
+				},
+			},
+			"Database.Pool.Size",
+			Update{Name: "Size", Path: "Database.Pool.Size", Value: 20, OldValue: 10},
+			"Database.Pool.Size",
+			[][]interface{}{{10, 20}},
+		},
+	}
+
+	for _, tc := range tests {
+		calls := [][]interface{}{}
+		opt := OnChange(tc.field, func(old, new interface{}) {
+			calls = append(calls, []interface{}{old, new})
+		})
+		opt(tc.c)
+
+		// Handlers are appended to the ones already registered
+		h := tc.c.handlers[len(tc.c.handlers)-1]
+		assert.Equal(t, tc.expectedPath, h.path)
+
+		h.f(tc.update)
+		assert.Equal(t, tc.expectedCalls, calls)
+	}
+}
+
+func TestOnAnyChange(t *testing.T) {
+	tests := []struct {
+		c      *controller
+		update Update
+	}{
+		{
+			&controller{},
+			Update{Name: "LogLevel", Path: "LogLevel", Value: "debug", OldValue: "info"},
+		},
+	}
+
+	for _, tc := range tests {
+		var received Update
+		opt := OnAnyChange(func(update Update) {
+			received = update
+		})
+		opt(tc.c)
+
+		assert.Len(t, tc.c.handlers, 1)
+		assert.Empty(t, tc.c.handlers[0].path)
+
+		tc.c.handlers[0].f(tc.update)
+		assert.Equal(t, tc.update, received)
+	}
+}
+
+func TestChangeSets(t *testing.T) {
+	cs1 := make(chan ChangeSet)
+	cs2 := make(chan ChangeSet)
+
+	tests := []struct {
+		c           *controller
+		subscribers []chan ChangeSet
+		expected    *controller
+	}{
+		{
+			&controller{},
+			[]chan ChangeSet{cs1, cs2},
+			&controller{
+				changeSets: []chan ChangeSet{cs1, cs2},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		opt := ChangeSets(tc.subscribers...)
+		opt(tc.c)
+
+		assert.Equal(t, tc.expected, tc.c)
+	}
+}
+
+func TestReloadOnSignal(t *testing.T) {
+	tests := []struct {
+		c        *controller
+		signals  []os.Signal
+		expected *controller
+	}{
+		{
+			&controller{},
+			nil,
+			&controller{
+				reloadSignals: []os.Signal{syscall.SIGHUP},
+			},
+		},
+		{
+			&controller{},
+			[]os.Signal{syscall.SIGUSR1, syscall.SIGUSR2},
+			&controller{
+				reloadSignals: []os.Signal{syscall.SIGUSR1, syscall.SIGUSR2},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		opt := ReloadOnSignal(tc.signals...)
+		opt(tc.c)
+
+		assert.Equal(t, tc.expected, tc.c)
+	}
+}
+
+func TestPolling(t *testing.T) {
+	tests := []struct {
+		c        *controller
+		interval time.Duration
+		expected *controller
+	}{
+		{
+			&controller{},
+			10 * time.Second,
+			&controller{
+				pollInterval: 10 * time.Second,
+			},
+		},
+		{
+			&controller{
+				pollInterval: time.Second,
+				pollFallback: true,
+			},
+			0,
+			&controller{
+				pollInterval: 5 * time.Second,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		opt := Polling(tc.interval)
+		opt(tc.c)
+
+		assert.Equal(t, tc.expected, tc.c)
+	}
+}
+
+func TestPollingFallback(t *testing.T) {
+	tests := []struct {
+		c        *controller
+		interval time.Duration
+		expected *controller
+	}{
+		{
+			&controller{},
+			10 * time.Second,
+			&controller{
+				pollInterval: 10 * time.Second,
+				pollFallback: true,
+			},
+		},
+		{
+			&controller{},
+			-time.Second,
+			&controller{
+				pollInterval: 5 * time.Second,
+				pollFallback: true,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		opt := PollingFallback(tc.interval)
+		opt(tc.c)
+
+		assert.Equal(t, tc.expected, tc.c)
+	}
+}
+
+func TestDebounce(t *testing.T) {
+	tests := []struct {
+		c        *controller
+		window   time.Duration
+		expected *controller
+	}{
+		{
+			&controller{},
+			100 * time.Millisecond,
+			&controller{
+				debounce: 100 * time.Millisecond,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		opt := Debounce(tc.window)
+		opt(tc.c)
+
+		assert.Equal(t, tc.expected, tc.c)
+	}
+}
+
+func TestArgs(t *testing.T) {
+	tests := []struct {
+		c        *controller
+		args     []string
+		expected *controller
+	}{
+		{
+			&controller{},
+			[]string{"-port", "8080"},
+			&controller{
+				args: []string{"-port", "8080"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		opt := Args(tc.args)
+		opt(tc.c)
+
+		assert.Equal(t, tc.expected, tc.c)
+	}
+}
+
+func TestLookupEnv(t *testing.T) {
+	tests := []struct {
+		c             *controller
+		env           map[string]string
+		name          string
+		expectedValue string
+	}{
+		{
+			&controller{},
+			map[string]string{"PORT": "8080"},
+			"PORT",
+			"8080",
 		},
 	}
 
 	for _, tc := range tests {
-		opt := PrefixFlag(tc.prefix)
+		opt := LookupEnv(func(name string) (string, bool) {
+			val, ok := tc.env[name]
+			return val, ok
+		})
 		opt(tc.c)
 
-		assert.Equal(t, tc.expected, tc.c)
+		assert.NotNil(t, tc.c.lookupEnv)
+		assert.Equal(t, tc.expectedValue, tc.c.getEnv(tc.name))
 	}
 }
 
-func TestPrefixEnv(t *testing.T) {
+func TestFlagSet(t *testing.T) {
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+
 	tests := []struct {
 		c        *controller
-		prefix   string
+		fs       *flag.FlagSet
 		expected *controller
 	}{
 		{
 			&controller{},
-			"CONFIG_",
+			fs,
 			&controller{
-				prefixEnv: "CONFIG_",
+				flagSet: fs,
 			},
 		},
 	}
 
 	for _, tc := range tests {
-		opt := PrefixEnv(tc.prefix)
+		opt := FlagSet(tc.fs)
 		opt(tc.c)
 
 		assert.Equal(t, tc.expected, tc.c)
 	}
 }
 
-func TestPrefixFileEnv(t *testing.T) {
+func TestFS(t *testing.T) {
 	tests := []struct {
 		c        *controller
-		prefix   string
+		fs       FileSystem
 		expected *controller
 	}{
 		{
 			&controller{},
-			"CONFIG_",
+			mapFS{"/secrets/token": "secret"},
 			&controller{
-				prefixFileEnv: "CONFIG_",
+				fs: mapFS{"/secrets/token": "secret"},
 			},
 		},
 	}
 
 	for _, tc := range tests {
-		opt := PrefixFileEnv(tc.prefix)
+		opt := FS(tc.fs)
 		opt(tc.c)
 
 		assert.Equal(t, tc.expected, tc.c)
 	}
 }
 
-func TestTelepresence(t *testing.T) {
+func TestNewController(t *testing.T) {
 	tests := []struct {
-		c        *controller
-		expected *controller
+		name              string
+		env               map[string]string
+		opts              []Option
+		expectedDebug     uint
+		expectedListSep   string
+		expectedSkipFlag  bool
+		expectedPrefixEnv string
 	}{
 		{
-			&controller{},
-			&controller{
-				telepresence: true,
+			name:            "Defaults",
+			env:             map[string]string{},
+			opts:            nil,
+			expectedListSep: ",",
+		},
+		{
+			name: "OptionsFromEnv",
+			env: map[string]string{
+				"KONFIG_DEBUG":      "2",
+				"KONFIG_SKIP_FLAG":  "true",
+				"KONFIG_PREFIX_ENV": "APP_",
+			},
+			opts:              nil,
+			expectedDebug:     2,
+			expectedListSep:   ",",
+			expectedSkipFlag:  true,
+			expectedPrefixEnv: "APP_",
+		},
+		{
+			name: "OptionsOverrideEnv",
+			env: map[string]string{
+				"KONFIG_DEBUG":    "2",
+				"KONFIG_LIST_SEP": ";",
 			},
+			opts:            []Option{Debug(5), ListSep("|")},
+			expectedDebug:   5,
+			expectedListSep: "|",
 		},
 	}
 
 	for _, tc := range tests {
-		opt := Telepresence()
-		opt(tc.c)
+		t.Run(tc.name, func(t *testing.T) {
+			lookupEnv := func(name string) (string, bool) {
+				val, ok := tc.env[name]
+				return val, ok
+			}
 
-		assert.Equal(t, tc.expected, tc.c)
+			opts := append([]Option{LookupEnv(lookupEnv)}, tc.opts...)
+			c := newController(opts...)
+
+			assert.Equal(t, tc.expectedDebug, c.debug)
+			assert.Equal(t, tc.expectedListSep, c.listSep)
+			assert.Equal(t, tc.expectedSkipFlag, c.skipFlag)
+			assert.Equal(t, tc.expectedPrefixEnv, c.prefixEnv)
+		})
 	}
 }
 
@@ -630,6 +1302,13 @@ func TestString(t *testing.T) {
 			},
 			"ListSep<|>",
 		},
+		{
+			"WithTrim",
+			&controller{
+				trim: TrimSpace,
+			},
+			"Trim<space>",
+		},
 		{
 			"WithPrefixFlag",
 			&controller{
@@ -679,6 +1358,23 @@ func TestString(t *testing.T) {
 			},
 			"Telepresence",
 		},
+		{
+			"WithFile",
+			&controller{
+				file: "config.yaml",
+			},
+			"File<config.yaml>",
+		},
+		{
+			"WithSources",
+			&controller{
+				sources: []Source{
+					EnvSource,
+					&mockSource{name: "vault"},
+				},
+			},
+			"Sources<env,vault>",
+		},
 		{
 			"WithSubscribers",
 			&controller{
@@ -701,12 +1397,72 @@ func TestString(t *testing.T) {
 				skipEnv:       true,
 				skipFileEnv:   true,
 				telepresence:  true,
+				file:          "config.yaml",
 				subscribers: []chan Update{
 					make(chan Update),
 					make(chan Update),
 				},
 			},
-			"Debug<2> + ListSep<|> + SkipFlag + SkipEnv + SkipFileEnv + PrefixFlag<config.> + PrefixEnv<CONFIG_> + PrefixFileEnv<CONFIG_> + Telepresence + Subscribers<2>",
+			"Debug<2> + ListSep<|> + SkipFlag + SkipEnv + SkipFileEnv + PrefixFlag<config.> + PrefixEnv<CONFIG_> + PrefixFileEnv<CONFIG_> + Telepresence + File<config.yaml> + Subscribers<2>",
+		},
+		{
+			"WithDelivery",
+			&controller{
+				delivery:     Coalesce,
+				deliverySize: 10,
+				subscribers: []chan Update{
+					make(chan Update),
+				},
+			},
+			"Delivery<coalesce,10> + Subscribers<1>",
+		},
+		{
+			"WithChangeSets",
+			&controller{
+				changeSets: []chan ChangeSet{
+					make(chan ChangeSet),
+				},
+			},
+			"ChangeSets<1>",
+		},
+		{
+			"WithHandlers",
+			&controller{
+				handlers: []handler{
+					{path: "LogLevel", f: func(Update) {}},
+					{f: func(Update) {}},
+				},
+			},
+			"Handlers<2>",
+		},
+		{
+			"WithReloadOnSignal",
+			&controller{
+				reloadSignals: []os.Signal{syscall.SIGHUP, syscall.SIGUSR1},
+			},
+			"ReloadOnSignal<hangup,user defined signal 1>",
+		},
+		{
+			"WithPolling",
+			&controller{
+				pollInterval: 10 * time.Second,
+			},
+			"Polling<10s>",
+		},
+		{
+			"WithPollingFallback",
+			&controller{
+				pollInterval: time.Second,
+				pollFallback: true,
+			},
+			"PollingFallback<1s>",
+		},
+		{
+			"WithDebounce",
+			&controller{
+				debounce: 100 * time.Millisecond,
+			},
+			"Debounce<100ms>",
 		},
 	}
 
@@ -936,87 +1692,438 @@ func TestGetFieldValue(t *testing.T) {
 				defer os.Unsetenv(envTelepresenceRoot)
 			}
 
-			// Write value in a temporary config file
+			// Write value in a temporary config file
+
+			tmpfile, err := ioutil.TempFile("", "gotest_")
+			assert.NoError(t, err)
+			defer os.Remove(tmpfile.Name())
+
+			_, err = tmpfile.WriteString(tc.fileConfig.value)
+			assert.NoError(t, err)
+
+			err = tmpfile.Close()
+			assert.NoError(t, err)
+
+			err = os.Setenv(tc.fileConfig.varName, tmpfile.Name())
+			assert.NoError(t, err)
+			defer os.Unsetenv(tc.fileConfig.varName)
+
+			// Verify
+			value, source, key := tc.c.getFieldValue(Field{
+				Name:        tc.fieldName,
+				FlagName:    tc.flagName,
+				EnvName:     tc.envName,
+				FileEnvName: tc.fileEnvName,
+			})
+			assert.Equal(t, tc.expectedValue, value)
+			if tc.expectFilePath {
+				assert.Equal(t, sourceFile, source)
+				assert.Equal(t, tmpfile.Name(), key)
+			}
+		})
+	}
+}
+
+func TestNewUpdate(t *testing.T) {
+	tests := []struct {
+		name           string
+		path           string
+		oldValue       interface{}
+		value          interface{}
+		source         string
+		key            string
+		secret         bool
+		expectedUpdate Update
+	}{
+		{
+			"Field",
+			"LogLevel", "info", "debug", "file", "/etc/config/log_level", false,
+			Update{Name: "LogLevel", Path: "LogLevel", Value: "debug", OldValue: "info", Source: "file", Key: "/etc/config/log_level"},
+		},
+		{
+			"NestedField",
+			"Database.Pool.Size", 10, 20, "env", "DATABASE_POOL_SIZE", false,
+			Update{Name: "Size", Path: "Database.Pool.Size", Value: 20, OldValue: 10, Source: "env", Key: "DATABASE_POOL_SIZE"},
+		},
+		{
+			"SecretField",
+			"Password", "old", "new", "file", "/etc/secrets/password", true,
+			Update{Name: "Password", Path: "Password", Value: "new", OldValue: "old", Source: "file", Key: "/etc/secrets/password", Secret: true},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			update := newUpdate(tc.path, tc.oldValue, tc.value, tc.source, tc.key, tc.secret)
+
+			assert.False(t, update.Time.IsZero())
+			update.Time = time.Time{}
+			assert.Equal(t, tc.expectedUpdate, update)
+		})
+	}
+}
+
+func TestUpdateString(t *testing.T) {
+	tests := []struct {
+		update         Update
+		expectedString string
+	}{
+		{
+			Update{Name: "LogLevel", Path: "LogLevel", Value: "debug", OldValue: "info", Source: "file", Key: "/etc/config/log_level"},
+			"LogLevel changed info -> debug from file /etc/config/log_level",
+		},
+		{
+			Update{Name: "Size", Path: "Database.Pool.Size", Value: 20, OldValue: 10, Source: "env", Key: "DATABASE_POOL_SIZE"},
+			"Database.Pool.Size changed 10 -> 20 from env DATABASE_POOL_SIZE",
+		},
+		{
+			Update{Name: "Password", Path: "Password", Value: "new", OldValue: "old", Source: "file", Key: "/etc/secrets/password", Secret: true},
+			"Password changed ****** -> ****** from file /etc/secrets/password",
+		},
+		{
+			Update{Name: "Password", Path: "Password", Value: "new", OldValue: "", Source: "env", Key: "PASSWORD", Secret: true},
+			"Password changed  -> ****** from env PASSWORD",
+		},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.expectedString, tc.update.String())
+	}
+}
+
+func TestNotifySubscribers(t *testing.T) {
+	tests := []struct {
+		name           string
+		c              *controller
+		update         Update
+		expectedUpdate Update
+	}{
+		{
+			"Nil",
+			&controller{},
+			Update{Name: "FieldBool", Path: "FieldBool", Value: true},
+			Update{},
+		},
+		{
+			"NoChannel",
+			&controller{
+				subscribers: []chan Update{},
+			},
+			Update{Name: "FieldString", Path: "FieldString", Value: "value"},
+			Update{},
+		},
+		{
+			"WithBlockingChannels",
+			&controller{
+				subscribers: []chan Update{
+					make(chan Update),
+					make(chan Update),
+				},
+			},
+			Update{Name: "FieldInt", Path: "FieldInt", Value: 27, OldValue: 0, Source: "env", Key: "FIELD_INT"},
+			Update{Name: "FieldInt", Path: "FieldInt", Value: 27, OldValue: 0, Source: "env", Key: "FIELD_INT"},
+		},
+		{
+			"WithBufferedChannels",
+			&controller{
+				subscribers: []chan Update{
+					make(chan Update, 1),
+					make(chan Update, 1),
+				},
+			},
+			Update{Name: "FieldFloat", Path: "FieldFloat", Value: 3.1415, OldValue: 2.7182, Source: "flag", Key: "field.float"},
+			Update{Name: "FieldFloat", Path: "FieldFloat", Value: 3.1415, OldValue: 2.7182, Source: "flag", Key: "field.float"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.c.notifySubscribers(tc.update)
+
+			if tc.expectedUpdate != (Update{}) {
+				for _, ch := range tc.c.subscribers {
+					update := <-ch
+					assert.Equal(t, tc.expectedUpdate, update)
+				}
+			}
+		})
+	}
+}
+
+func TestCallHandlers(t *testing.T) {
+	tests := []struct {
+		name          string
+		paths         []string
+		updates       []Update
+		expectedCalls []string
+	}{
+		{
+			"NoHandler",
+			[]string{},
+			[]Update{
+				{Name: "LogLevel", Path: "LogLevel", Value: "debug"},
+			},
+			[]string{},
+		},
+		{
+			"ByField",
+			[]string{"LogLevel", "Port"},
+			[]Update{
+				{Name: "LogLevel", Path: "LogLevel", Value: "debug"},
+				{Name: "Port", Path: "Port", Value: 8080},
+				{Name: "Timeout", Path: "Timeout", Value: time.Second},
+			},
+			[]string{"0:LogLevel=debug", "1:Port=8080"},
+		},
+		{
+			"ByPath",
+			[]string{"Size", "Database.Pool.Size"},
+			[]Update{
+				{Name: "Size", Path: "Database.Pool.Size", Value: 20},
+			},
+			[]string{"1:Database.Pool.Size=20"},
+		},
+		{
+			"AnyField",
+			[]string{"LogLevel", ""},
+			[]Update{
+				{Name: "LogLevel", Path: "LogLevel", Value: "debug"},
+				{Name: "Port", Path: "Port", Value: 8080},
+			},
+			[]string{"0:LogLevel=debug", "1:LogLevel=debug", "1:Port=8080"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			calls := []string{}
+
+			c := &controller{
+				watching: true,
+			}
+			for i, path := range tc.paths {
+				i := i
+				c.handlers = append(c.handlers, handler{
+					path: path,
+					f: func(update Update) {
+						calls = append(calls, fmt.Sprintf("%d:%s=%v", i, update.Path, update.Value))
+					},
+				})
+			}
+
+			for _, update := range tc.updates {
+				c.notifySubscribers(update)
+			}
+
+			assert.Equal(t, tc.expectedCalls, calls)
+
+			// No handler is called after closing
+			c.closeSubscribers()
+			c.notifySubscribers(tc.updates[0])
+			assert.Equal(t, tc.expectedCalls, calls)
+		})
+	}
+}
+
+func TestCloseSubscribers(t *testing.T) {
+	ch1 := make(chan Update)
+	ch2 := make(chan Update)
+	ch3 := make(chan Update)
+
+	tests := []struct {
+		name          string
+		c             *controller
+		updates       []Update
+		expectedTotal int
+	}{
+		{
+			"NoChannel",
+			&controller{},
+			[]Update{},
+			0,
+		},
+		{
+			"PendingNotifications",
+			&controller{
+				subscribers: []chan Update{
+					make(chan Update),
+					make(chan Update),
+				},
+			},
+			[]Update{
+				{Name: "FieldInt", Path: "FieldInt", Value: 27},
+				{Name: "FieldString", Path: "FieldString", Value: "value"},
+			},
+			4,
+		},
+		{
+			"DuplicateChannels",
+			&controller{
+				subscribers: []chan Update{ch1, ch2, ch1, ch3},
+			},
+			[]Update{
+				{Name: "FieldInt", Path: "FieldInt", Value: 27},
+			},
+			4,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, update := range tc.updates {
+				tc.c.notifySubscribers(update)
+			}
 
-			tmpfile, err := ioutil.TempFile("", "gotest_")
-			assert.NoError(t, err)
-			defer os.Remove(tmpfile.Name())
+			// Receive updates on every distinct channel until it is closed
+			var mu sync.Mutex
+			var wg sync.WaitGroup
+			total := 0
+			seen := map[chan Update]bool{}
+			for _, sub := range tc.c.subscribers {
+				if seen[sub] {
+					continue
+				}
+				seen[sub] = true
 
-			_, err = tmpfile.WriteString(tc.fileConfig.value)
-			assert.NoError(t, err)
+				wg.Add(1)
+				go func(ch chan Update) {
+					defer wg.Done()
+					for range ch {
+						mu.Lock()
+						total++
+						mu.Unlock()
+					}
+				}(sub)
+			}
 
-			err = tmpfile.Close()
-			assert.NoError(t, err)
+			tc.c.closeSubscribers()
+			wg.Wait()
 
-			err = os.Setenv(tc.fileConfig.varName, tmpfile.Name())
-			assert.NoError(t, err)
-			defer os.Unsetenv(tc.fileConfig.varName)
+			// All in-flight notifications are received before channels are closed
+			assert.Equal(t, tc.expectedTotal, total)
 
-			// Verify
-			value, filePath := tc.c.getFieldValue(tc.fieldName, tc.flagName, tc.envName, tc.fileEnvName)
-			assert.Equal(t, tc.expectedValue, value)
-			if tc.expectFilePath {
-				assert.Equal(t, tmpfile.Name(), filePath)
-			}
+			// No subscriber is notified after closing
+			tc.c.notifySubscribers(Update{Name: "FieldBool", Path: "FieldBool", Value: true})
 		})
 	}
 }
 
-func TestNotifySubscribers(t *testing.T) {
+func TestNotifyChangeSets(t *testing.T) {
 	tests := []struct {
-		name           string
-		c              *controller
-		fieldName      string
-		fieldValue     interface{}
-		expectedUpdate Update
+		name       string
+		c          *controller
+		changeSets []ChangeSet
 	}{
-		{
-			"Nil",
-			&controller{},
-			"FieldBool", true,
-			Update{},
-		},
 		{
 			"NoChannel",
-			&controller{
-				subscribers: []chan Update{},
+			&controller{},
+			[]ChangeSet{
+				{Updates: []Update{{Name: "FieldInt", Path: "FieldInt", Value: 27}}},
 			},
-			"FieldString", "value",
-			Update{},
 		},
 		{
-			"WithBlockingChannels",
+			"InOrder",
 			&controller{
-				subscribers: []chan Update{
-					make(chan Update),
-					make(chan Update),
+				changeSets: []chan ChangeSet{
+					make(chan ChangeSet),
+					make(chan ChangeSet),
 				},
 			},
-			"FieldInt", 27,
-			Update{"FieldInt", 27},
+			[]ChangeSet{
+				{Updates: []Update{{Name: "FieldInt", Path: "FieldInt", Value: 27}}},
+				{Updates: []Update{{Name: "FieldInt", Path: "FieldInt", Value: 28}, {Name: "FieldString", Path: "FieldString", Value: "value"}}},
+				{Updates: []Update{{Name: "FieldInt", Path: "FieldInt", Value: 29}}},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var wg sync.WaitGroup
+			received := make([][]ChangeSet, len(tc.c.changeSets))
+			for i, sub := range tc.c.changeSets {
+				wg.Add(1)
+				go func(i int, ch chan ChangeSet) {
+					defer wg.Done()
+					for cs := range ch {
+						received[i] = append(received[i], cs)
+					}
+				}(i, sub)
+			}
+
+			for _, cs := range tc.changeSets {
+				tc.c.notifyChangeSets(cs)
+			}
+
+			tc.c.closeSubscribers()
+			wg.Wait()
+
+			for i := range tc.c.changeSets {
+				assert.Equal(t, tc.changeSets, received[i])
+			}
+
+			// No subscriber is notified after closing
+			tc.c.notifyChangeSets(tc.changeSets[0])
+		})
+	}
+}
+
+func TestNotifyChangeSetsStopped(t *testing.T) {
+	c := &controller{
+		changeSets: []chan ChangeSet{make(chan ChangeSet)},
+		stopping:   make(chan struct{}),
+	}
+
+	notified := make(chan struct{})
+	go func() {
+		// Nothing ever receives from the subscriber
+		c.notifyChangeSets(ChangeSet{Updates: []Update{{Name: "FieldInt", Path: "FieldInt", Value: 27}}})
+		close(notified)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	c.stopNotifying()
+	c.stopNotifying()
+
+	select {
+	case <-notified:
+	case <-time.After(time.Second):
+		t.Fatal("change set still being sent")
+	}
+}
+
+func TestFail(t *testing.T) {
+	tests := []struct {
+		name          string
+		c             *controller
+		errs          []error
+		expectedError error
+	}{
+		{
+			"NotWatching",
+			&controller{},
+			[]error{errors.New("watcher closed")},
+			nil,
 		},
 		{
-			"WithBufferedChannels",
+			"Watching",
 			&controller{
-				subscribers: []chan Update{
-					make(chan Update, 1),
-					make(chan Update, 1),
-				},
+				watchErrs: make(chan error, 1),
 			},
-			"FieldFloat", 3.1415,
-			Update{"FieldFloat", 3.1415},
+			[]error{errors.New("watcher closed"), errors.New("another error")},
+			errors.New("watcher closed"),
 		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			tc.c.notifySubscribers(tc.fieldName, tc.fieldValue)
+			// Reporting errors should never block
+			for _, err := range tc.errs {
+				tc.c.fail(err)
+			}
 
-			if tc.expectedUpdate != (Update{}) {
-				for _, ch := range tc.c.subscribers {
-					update := <-ch
-					assert.Equal(t, tc.expectedUpdate, update)
-				}
+			if tc.expectedError != nil {
+				assert.Equal(t, tc.expectedError, <-tc.c.watchErrs)
 			}
 		})
 	}
@@ -1025,27 +2132,21 @@ func TestNotifySubscribers(t *testing.T) {
 func TestSetString(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          string
-		fieldName      string
 		fieldValue     string
 		expectedValue  string
 		expectedResult bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          "",
-			fieldName:      "Field",
 			fieldValue:     "test",
 			expectedValue:  "test",
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          "test",
-			fieldName:      "Field",
 			fieldValue:     "test",
 			expectedValue:  "test",
 			expectedResult: false,
@@ -1055,7 +2156,8 @@ func TestSetString(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setString(v, tc.fieldName, tc.fieldValue)
+			res, err := setString(v, tc.fieldValue)
+			assert.NoError(t, err)
 
 			assert.Equal(t, tc.expectedValue, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1066,37 +2168,46 @@ func TestSetString(t *testing.T) {
 func TestSetBool(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          bool
-		fieldName      string
 		fieldValue     string
 		expectedValue  bool
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          false,
-			fieldName:      "Field",
 			fieldValue:     "true",
 			expectedValue:  true,
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          true,
-			fieldName:      "Field",
 			fieldValue:     "true",
 			expectedValue:  true,
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          true,
+			fieldValue:     "invalid",
+			expectedValue:  true,
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setBool(v, tc.fieldName, tc.fieldValue)
+			res, err := setBool(v, tc.fieldValue)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValue, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1107,37 +2218,46 @@ func TestSetBool(t *testing.T) {
 func TestSetFloat32(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          float32
-		fieldName      string
 		fieldValue     string
 		expectedValue  float32
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          0,
-			fieldName:      "Field",
 			fieldValue:     "3.1415",
 			expectedValue:  3.1415,
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          3.1415,
-			fieldName:      "Field",
 			fieldValue:     "3.1415",
 			expectedValue:  3.1415,
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          3.1415,
+			fieldValue:     "invalid",
+			expectedValue:  3.1415,
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setFloat32(v, tc.fieldName, tc.fieldValue)
+			res, err := setFloat32(v, tc.fieldValue)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValue, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1148,37 +2268,46 @@ func TestSetFloat32(t *testing.T) {
 func TestSetFloat64(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          float64
-		fieldName      string
 		fieldValue     string
 		expectedValue  float64
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          0,
-			fieldName:      "Field",
 			fieldValue:     "3.14159265359",
 			expectedValue:  3.14159265359,
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          3.14159265359,
-			fieldName:      "Field",
 			fieldValue:     "3.14159265359",
 			expectedValue:  3.14159265359,
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          3.14159265359,
+			fieldValue:     "invalid",
+			expectedValue:  3.14159265359,
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setFloat64(v, tc.fieldName, tc.fieldValue)
+			res, err := setFloat64(v, tc.fieldValue)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValue, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1189,37 +2318,46 @@ func TestSetFloat64(t *testing.T) {
 func TestSetInt(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          int
-		fieldName      string
 		fieldValue     string
 		expectedValue  int
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          0,
-			fieldName:      "Field",
 			fieldValue:     "-2147483648",
 			expectedValue:  -2147483648,
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          -2147483648,
-			fieldName:      "Field",
 			fieldValue:     "-2147483648",
 			expectedValue:  -2147483648,
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          -2147483648,
+			fieldValue:     "invalid",
+			expectedValue:  -2147483648,
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setInt(v, tc.fieldName, tc.fieldValue)
+			res, err := setInt(v, tc.fieldValue)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValue, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1230,37 +2368,46 @@ func TestSetInt(t *testing.T) {
 func TestSetInt8(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          int8
-		fieldName      string
 		fieldValue     string
 		expectedValue  int8
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          0,
-			fieldName:      "Field",
 			fieldValue:     "-128",
 			expectedValue:  -128,
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          -128,
-			fieldName:      "Field",
 			fieldValue:     "-128",
 			expectedValue:  -128,
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          -128,
+			fieldValue:     "invalid",
+			expectedValue:  -128,
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setInt8(v, tc.fieldName, tc.fieldValue)
+			res, err := setInt8(v, tc.fieldValue)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValue, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1271,37 +2418,46 @@ func TestSetInt8(t *testing.T) {
 func TestSetInt16(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          int16
-		fieldName      string
 		fieldValue     string
 		expectedValue  int16
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          0,
-			fieldName:      "Field",
 			fieldValue:     "-32768",
 			expectedValue:  -32768,
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          -32768,
-			fieldName:      "Field",
 			fieldValue:     "-32768",
 			expectedValue:  -32768,
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          -32768,
+			fieldValue:     "invalid",
+			expectedValue:  -32768,
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setInt16(v, tc.fieldName, tc.fieldValue)
+			res, err := setInt16(v, tc.fieldValue)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValue, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1312,37 +2468,46 @@ func TestSetInt16(t *testing.T) {
 func TestSetInt32(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          int32
-		fieldName      string
 		fieldValue     string
 		expectedValue  int32
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          0,
-			fieldName:      "Field",
 			fieldValue:     "-2147483648",
 			expectedValue:  -2147483648,
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          -2147483648,
-			fieldName:      "Field",
 			fieldValue:     "-2147483648",
 			expectedValue:  -2147483648,
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          -2147483648,
+			fieldValue:     "invalid",
+			expectedValue:  -2147483648,
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setInt32(v, tc.fieldName, tc.fieldValue)
+			res, err := setInt32(v, tc.fieldValue)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValue, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1353,37 +2518,46 @@ func TestSetInt32(t *testing.T) {
 func TestSetInt64(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          int64
-		fieldName      string
 		fieldValue     string
 		expectedValue  int64
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          0,
-			fieldName:      "Field",
 			fieldValue:     "-9223372036854775808",
 			expectedValue:  -9223372036854775808,
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          -9223372036854775808,
-			fieldName:      "Field",
 			fieldValue:     "-9223372036854775808",
 			expectedValue:  -9223372036854775808,
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          -9223372036854775808,
+			fieldValue:     "invalid",
+			expectedValue:  -9223372036854775808,
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setInt64(v, tc.fieldName, tc.fieldValue)
+			res, err := setInt64(v, tc.fieldValue)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValue, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1394,37 +2568,46 @@ func TestSetInt64(t *testing.T) {
 func TestSetDuration(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          time.Duration
-		fieldName      string
 		fieldValue     string
 		expectedValue  time.Duration
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          0,
-			fieldName:      "Field",
 			fieldValue:     "1h0m0s",
 			expectedValue:  time.Hour,
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          time.Hour,
-			fieldName:      "Field",
 			fieldValue:     "1h0m0s",
 			expectedValue:  time.Hour,
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          time.Hour,
+			fieldValue:     "invalid",
+			expectedValue:  time.Hour,
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setInt64(v, tc.fieldName, tc.fieldValue)
+			res, err := setInt64(v, tc.fieldValue)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValue, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1435,37 +2618,46 @@ func TestSetDuration(t *testing.T) {
 func TestSetUint(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          uint
-		fieldName      string
 		fieldValue     string
 		expectedValue  uint
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          0,
-			fieldName:      "Field",
 			fieldValue:     "4294967295",
 			expectedValue:  4294967295,
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          4294967295,
-			fieldName:      "Field",
 			fieldValue:     "4294967295",
 			expectedValue:  4294967295,
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          4294967295,
+			fieldValue:     "invalid",
+			expectedValue:  4294967295,
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setUint(v, tc.fieldName, tc.fieldValue)
+			res, err := setUint(v, tc.fieldValue)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValue, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1476,37 +2668,46 @@ func TestSetUint(t *testing.T) {
 func TestSetUint8(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          uint8
-		fieldName      string
 		fieldValue     string
 		expectedValue  uint8
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          0,
-			fieldName:      "Field",
 			fieldValue:     "255",
 			expectedValue:  255,
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          255,
-			fieldName:      "Field",
 			fieldValue:     "255",
 			expectedValue:  255,
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          255,
+			fieldValue:     "invalid",
+			expectedValue:  255,
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setUint8(v, tc.fieldName, tc.fieldValue)
+			res, err := setUint8(v, tc.fieldValue)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValue, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1517,37 +2718,46 @@ func TestSetUint8(t *testing.T) {
 func TestSetUint16(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          uint16
-		fieldName      string
 		fieldValue     string
 		expectedValue  uint16
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          0,
-			fieldName:      "Field",
 			fieldValue:     "65535",
 			expectedValue:  65535,
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          65535,
-			fieldName:      "Field",
 			fieldValue:     "65535",
 			expectedValue:  65535,
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          65535,
+			fieldValue:     "invalid",
+			expectedValue:  65535,
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setUint16(v, tc.fieldName, tc.fieldValue)
+			res, err := setUint16(v, tc.fieldValue)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValue, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1558,37 +2768,46 @@ func TestSetUint16(t *testing.T) {
 func TestSetUint32(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          uint32
-		fieldName      string
 		fieldValue     string
 		expectedValue  uint32
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          0,
-			fieldName:      "Field",
 			fieldValue:     "4294967295",
 			expectedValue:  4294967295,
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          4294967295,
-			fieldName:      "Field",
 			fieldValue:     "4294967295",
 			expectedValue:  4294967295,
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          4294967295,
+			fieldValue:     "invalid",
+			expectedValue:  4294967295,
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setUint32(v, tc.fieldName, tc.fieldValue)
+			res, err := setUint32(v, tc.fieldValue)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValue, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1599,37 +2818,46 @@ func TestSetUint32(t *testing.T) {
 func TestSetUint64(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          uint64
-		fieldName      string
 		fieldValue     string
 		expectedValue  uint64
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          0,
-			fieldName:      "Field",
 			fieldValue:     "18446744073709551615",
 			expectedValue:  18446744073709551615,
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          18446744073709551615,
-			fieldName:      "Field",
 			fieldValue:     "18446744073709551615",
 			expectedValue:  18446744073709551615,
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          18446744073709551615,
+			fieldValue:     "invalid",
+			expectedValue:  18446744073709551615,
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setUint64(v, tc.fieldName, tc.fieldValue)
+			res, err := setUint64(v, tc.fieldValue)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValue, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1642,37 +2870,46 @@ func TestSetURL(t *testing.T) {
 
 	tests := []struct {
 		name           string
-		c              *controller
 		field          url.URL
-		fieldName      string
 		fieldValue     string
 		expectedValue  url.URL
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          url.URL{},
-			fieldName:      "Field",
 			fieldValue:     "example.com",
 			expectedValue:  *u,
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          *u,
-			fieldName:      "Field",
 			fieldValue:     "example.com",
 			expectedValue:  *u,
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          *u,
+			fieldValue:     "%zz",
+			expectedValue:  *u,
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setStruct(v, tc.fieldName, tc.fieldValue)
+			res, err := setStruct(v, tc.fieldValue)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValue, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1683,27 +2920,21 @@ func TestSetURL(t *testing.T) {
 func TestSetStringSlice(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          []string
-		fieldName      string
 		fieldValues    []string
 		expectedValues []string
 		expectedResult bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          []string{},
-			fieldName:      "Field",
 			fieldValues:    []string{"milad", "mona"},
 			expectedValues: []string{"milad", "mona"},
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          []string{"milad", "mona"},
-			fieldName:      "Field",
 			fieldValues:    []string{"milad", "mona"},
 			expectedValues: []string{"milad", "mona"},
 			expectedResult: false,
@@ -1713,7 +2944,8 @@ func TestSetStringSlice(t *testing.T) {
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setStringSlice(v, tc.fieldName, tc.fieldValues)
+			res, err := setStringSlice(v, tc.fieldValues)
+			assert.NoError(t, err)
 
 			assert.Equal(t, tc.expectedValues, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1724,37 +2956,46 @@ func TestSetStringSlice(t *testing.T) {
 func TestSetBoolSlice(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          []bool
-		fieldName      string
 		fieldValues    []string
 		expectedValues []bool
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          []bool{},
-			fieldName:      "Field",
 			fieldValues:    []string{"false", "true"},
 			expectedValues: []bool{false, true},
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          []bool{false, true},
-			fieldName:      "Field",
 			fieldValues:    []string{"false", "true"},
 			expectedValues: []bool{false, true},
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          []bool{false, true},
+			fieldValues:    []string{"invalid"},
+			expectedValues: []bool{false, true},
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setBoolSlice(v, tc.fieldName, tc.fieldValues)
+			res, err := setBoolSlice(v, tc.fieldValues)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValues, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1765,37 +3006,46 @@ func TestSetBoolSlice(t *testing.T) {
 func TestSetFloat32Slice(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          []float32
-		fieldName      string
 		fieldValues    []string
 		expectedValues []float32
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          []float32{},
-			fieldName:      "Field",
 			fieldValues:    []string{"3.1415", "2.7182"},
 			expectedValues: []float32{3.1415, 2.7182},
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          []float32{3.1415, 2.7182},
-			fieldName:      "Field",
 			fieldValues:    []string{"3.1415", "2.7182"},
 			expectedValues: []float32{3.1415, 2.7182},
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          []float32{3.1415, 2.7182},
+			fieldValues:    []string{"invalid"},
+			expectedValues: []float32{3.1415, 2.7182},
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setFloat32Slice(v, tc.fieldName, tc.fieldValues)
+			res, err := setFloat32Slice(v, tc.fieldValues)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValues, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1806,37 +3056,46 @@ func TestSetFloat32Slice(t *testing.T) {
 func TestSetFloat64Slice(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          []float64
-		fieldName      string
 		fieldValues    []string
 		expectedValues []float64
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          []float64{},
-			fieldName:      "Field",
 			fieldValues:    []string{"3.14159265", "2.71828182"},
 			expectedValues: []float64{3.14159265, 2.71828182},
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          []float64{3.14159265, 2.71828182},
-			fieldName:      "Field",
 			fieldValues:    []string{"3.14159265", "2.71828182"},
 			expectedValues: []float64{3.14159265, 2.71828182},
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          []float64{3.14159265, 2.71828182},
+			fieldValues:    []string{"invalid"},
+			expectedValues: []float64{3.14159265, 2.71828182},
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setFloat64Slice(v, tc.fieldName, tc.fieldValues)
+			res, err := setFloat64Slice(v, tc.fieldValues)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValues, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1847,37 +3106,46 @@ func TestSetFloat64Slice(t *testing.T) {
 func TestSetIntSlice(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          []int
-		fieldName      string
 		fieldValues    []string
 		expectedValues []int
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          []int{},
-			fieldName:      "Field",
 			fieldValues:    []string{"27", "69"},
 			expectedValues: []int{27, 69},
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          []int{27, 69},
-			fieldName:      "Field",
 			fieldValues:    []string{"27", "69"},
 			expectedValues: []int{27, 69},
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          []int{27, 69},
+			fieldValues:    []string{"invalid"},
+			expectedValues: []int{27, 69},
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setIntSlice(v, tc.fieldName, tc.fieldValues)
+			res, err := setIntSlice(v, tc.fieldValues)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValues, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1888,37 +3156,46 @@ func TestSetIntSlice(t *testing.T) {
 func TestSetInt8Slice(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          []int8
-		fieldName      string
 		fieldValues    []string
 		expectedValues []int8
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          []int8{},
-			fieldName:      "Field",
 			fieldValues:    []string{"-128", "127"},
 			expectedValues: []int8{-128, 127},
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          []int8{-128, 127},
-			fieldName:      "Field",
 			fieldValues:    []string{"-128", "127"},
 			expectedValues: []int8{-128, 127},
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          []int8{-128, 127},
+			fieldValues:    []string{"invalid"},
+			expectedValues: []int8{-128, 127},
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setInt8Slice(v, tc.fieldName, tc.fieldValues)
+			res, err := setInt8Slice(v, tc.fieldValues)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValues, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1929,37 +3206,46 @@ func TestSetInt8Slice(t *testing.T) {
 func TestSetInt16Slice(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          []int16
-		fieldName      string
 		fieldValues    []string
 		expectedValues []int16
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          []int16{},
-			fieldName:      "Field",
 			fieldValues:    []string{"-32768", "32767"},
 			expectedValues: []int16{-32768, 32767},
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          []int16{-32768, 32767},
-			fieldName:      "Field",
 			fieldValues:    []string{"-32768", "32767"},
 			expectedValues: []int16{-32768, 32767},
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          []int16{-32768, 32767},
+			fieldValues:    []string{"invalid"},
+			expectedValues: []int16{-32768, 32767},
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setInt16Slice(v, tc.fieldName, tc.fieldValues)
+			res, err := setInt16Slice(v, tc.fieldValues)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValues, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -1970,37 +3256,46 @@ func TestSetInt16Slice(t *testing.T) {
 func TestSetInt32Slice(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          []int32
-		fieldName      string
 		fieldValues    []string
 		expectedValues []int32
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          []int32{},
-			fieldName:      "Field",
 			fieldValues:    []string{"-2147483648", "2147483647"},
 			expectedValues: []int32{-2147483648, 2147483647},
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          []int32{-2147483648, 2147483647},
-			fieldName:      "Field",
 			fieldValues:    []string{"-2147483648", "2147483647"},
 			expectedValues: []int32{-2147483648, 2147483647},
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          []int32{-2147483648, 2147483647},
+			fieldValues:    []string{"invalid"},
+			expectedValues: []int32{-2147483648, 2147483647},
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setInt32Slice(v, tc.fieldName, tc.fieldValues)
+			res, err := setInt32Slice(v, tc.fieldValues)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValues, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -2011,37 +3306,46 @@ func TestSetInt32Slice(t *testing.T) {
 func TestSetInt64Slice(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          []int64
-		fieldName      string
 		fieldValues    []string
 		expectedValues []int64
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          []int64{},
-			fieldName:      "Field",
 			fieldValues:    []string{"-9223372036854775808", "9223372036854775807"},
 			expectedValues: []int64{-9223372036854775808, 9223372036854775807},
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          []int64{-9223372036854775808, 9223372036854775807},
-			fieldName:      "Field",
 			fieldValues:    []string{"-9223372036854775808", "9223372036854775807"},
 			expectedValues: []int64{-9223372036854775808, 9223372036854775807},
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          []int64{-9223372036854775808, 9223372036854775807},
+			fieldValues:    []string{"invalid"},
+			expectedValues: []int64{-9223372036854775808, 9223372036854775807},
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setInt64Slice(v, tc.fieldName, tc.fieldValues)
+			res, err := setInt64Slice(v, tc.fieldValues)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValues, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -2052,37 +3356,46 @@ func TestSetInt64Slice(t *testing.T) {
 func TestSetDurationSlice(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          []time.Duration
-		fieldName      string
 		fieldValues    []string
 		expectedValues []time.Duration
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          []time.Duration{},
-			fieldName:      "Field",
 			fieldValues:    []string{"1h0m0s", "1m0s"},
 			expectedValues: []time.Duration{time.Hour, time.Minute},
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          []time.Duration{time.Hour, time.Minute},
-			fieldName:      "Field",
 			fieldValues:    []string{"1h0m0s", "1m0s"},
 			expectedValues: []time.Duration{time.Hour, time.Minute},
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          []time.Duration{time.Hour, time.Minute},
+			fieldValues:    []string{"invalid"},
+			expectedValues: []time.Duration{time.Hour, time.Minute},
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setInt64Slice(v, tc.fieldName, tc.fieldValues)
+			res, err := setInt64Slice(v, tc.fieldValues)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValues, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -2093,37 +3406,46 @@ func TestSetDurationSlice(t *testing.T) {
 func TestSetUintSlice(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          []uint
-		fieldName      string
 		fieldValues    []string
 		expectedValues []uint
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          []uint{},
-			fieldName:      "Field",
 			fieldValues:    []string{"27", "69"},
 			expectedValues: []uint{27, 69},
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          []uint{27, 69},
-			fieldName:      "Field",
 			fieldValues:    []string{"27", "69"},
 			expectedValues: []uint{27, 69},
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          []uint{27, 69},
+			fieldValues:    []string{"invalid"},
+			expectedValues: []uint{27, 69},
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setUintSlice(v, tc.fieldName, tc.fieldValues)
+			res, err := setUintSlice(v, tc.fieldValues)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValues, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -2134,37 +3456,46 @@ func TestSetUintSlice(t *testing.T) {
 func TestSetUint8Slice(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          []uint8
-		fieldName      string
 		fieldValues    []string
 		expectedValues []uint8
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          []uint8{},
-			fieldName:      "Field",
 			fieldValues:    []string{"128", "255"},
 			expectedValues: []uint8{128, 255},
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          []uint8{128, 255},
-			fieldName:      "Field",
 			fieldValues:    []string{"128", "255"},
 			expectedValues: []uint8{128, 255},
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          []uint8{128, 255},
+			fieldValues:    []string{"invalid"},
+			expectedValues: []uint8{128, 255},
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setUint8Slice(v, tc.fieldName, tc.fieldValues)
+			res, err := setUint8Slice(v, tc.fieldValues)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValues, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -2175,37 +3506,46 @@ func TestSetUint8Slice(t *testing.T) {
 func TestSetUint16Slice(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          []uint16
-		fieldName      string
 		fieldValues    []string
 		expectedValues []uint16
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          []uint16{},
-			fieldName:      "Field",
 			fieldValues:    []string{"32768", "65535"},
 			expectedValues: []uint16{32768, 65535},
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          []uint16{32768, 65535},
-			fieldName:      "Field",
 			fieldValues:    []string{"32768", "65535"},
 			expectedValues: []uint16{32768, 65535},
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          []uint16{32768, 65535},
+			fieldValues:    []string{"invalid"},
+			expectedValues: []uint16{32768, 65535},
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setUint16Slice(v, tc.fieldName, tc.fieldValues)
+			res, err := setUint16Slice(v, tc.fieldValues)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValues, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -2216,78 +3556,309 @@ func TestSetUint16Slice(t *testing.T) {
 func TestSetUint32Slice(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
 		field          []uint32
-		fieldName      string
 		fieldValues    []string
 		expectedValues []uint32
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
 			field:          []uint32{},
-			fieldName:      "Field",
 			fieldValues:    []string{"2147483648", "4294967295"},
 			expectedValues: []uint32{2147483648, 4294967295},
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
 			field:          []uint32{2147483648, 4294967295},
-			fieldName:      "Field",
 			fieldValues:    []string{"2147483648", "4294967295"},
 			expectedValues: []uint32{2147483648, 4294967295},
 			expectedResult: false,
 		},
+		{
+			name:           "InvalidValue",
+			field:          []uint32{2147483648, 4294967295},
+			fieldValues:    []string{"invalid"},
+			expectedValues: []uint32{2147483648, 4294967295},
+			expectedResult: false,
+			expectError:    true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			v := reflect.ValueOf(&tc.field).Elem()
+			res, err := setUint32Slice(v, tc.fieldValues)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.expectedValues, tc.field)
+			assert.Equal(t, tc.expectedResult, res)
+		})
+	}
+}
+
+func TestSetUint64Slice(t *testing.T) {
+	tests := []struct {
+		name           string
+		field          []uint64
+		fieldValues    []string
+		expectedValues []uint64
+		expectedResult bool
+		expectError    bool
+	}{
+		{
+			name:           "NewValue",
+			field:          []uint64{},
+			fieldValues:    []string{"9223372036854775808", "18446744073709551615"},
+			expectedValues: []uint64{9223372036854775808, 18446744073709551615},
+			expectedResult: true,
+		},
+		{
+			name:           "NoNewValue",
+			field:          []uint64{9223372036854775808, 18446744073709551615},
+			fieldValues:    []string{"9223372036854775808", "18446744073709551615"},
+			expectedValues: []uint64{9223372036854775808, 18446744073709551615},
+			expectedResult: false,
+		},
+		{
+			name:           "InvalidValue",
+			field:          []uint64{9223372036854775808, 18446744073709551615},
+			fieldValues:    []string{"invalid"},
+			expectedValues: []uint64{9223372036854775808, 18446744073709551615},
+			expectedResult: false,
+			expectError:    true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			v := reflect.ValueOf(&tc.field).Elem()
+			res, err := setUint64Slice(v, tc.fieldValues)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.expectedValues, tc.field)
+			assert.Equal(t, tc.expectedResult, res)
+		})
+	}
+}
+
+func TestSetURLSlice(t *testing.T) {
+	u1, _ := url.Parse("localhost")
+	u2, _ := url.Parse("example.com")
+
+	tests := []struct {
+		name           string
+		field          []url.URL
+		fieldValues    []string
+		expectedValues []url.URL
+		expectedResult bool
+		expectError    bool
+	}{
+		{
+			name:           "NewValue",
+			field:          []url.URL{},
+			fieldValues:    []string{"localhost", "example.com"},
+			expectedValues: []url.URL{*u1, *u2},
+			expectedResult: true,
+		},
+		{
+			name:           "NoNewValue",
+			field:          []url.URL{*u1, *u2},
+			fieldValues:    []string{"localhost", "example.com"},
+			expectedValues: []url.URL{*u1, *u2},
+			expectedResult: false,
+		},
+		{
+			name:           "InvalidValue",
+			field:          []url.URL{*u1, *u2},
+			fieldValues:    []string{"%zz"},
+			expectedValues: []url.URL{*u1, *u2},
+			expectedResult: false,
+			expectError:    true,
+		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setUint32Slice(v, tc.fieldName, tc.fieldValues)
+			res, err := setURLSlice(v, tc.fieldValues)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.expectedValues, tc.field)
+			assert.Equal(t, tc.expectedResult, res)
+		})
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	u, _ := url.Parse("service-1:8080")
+
+	tests := []struct {
+		name          string
+		typ           reflect.Type
+		val           string
+		expectedValue interface{}
+		expectError   bool
+	}{
+		{"String", reflect.TypeOf(""), "content", "content", false},
+		{"Bool", reflect.TypeOf(false), "true", true, false},
+		{"InvalidBool", reflect.TypeOf(false), "invalid", nil, true},
+		{"Float32", reflect.TypeOf(float32(0)), "3.1415", float32(3.1415), false},
+		{"Float64", reflect.TypeOf(float64(0)), "3.14159265359", float64(3.14159265359), false},
+		{"InvalidFloat", reflect.TypeOf(float64(0)), "invalid", nil, true},
+		{"Int", reflect.TypeOf(int(0)), "-2147483648", int(-2147483648), false},
+		{"Int8", reflect.TypeOf(int8(0)), "-128", int8(-128), false},
+		{"OutOfRangeInt8", reflect.TypeOf(int8(0)), "128", nil, true},
+		{"Duration", reflect.TypeOf(time.Duration(0)), "90m", 90 * time.Minute, false},
+		{"InvalidDuration", reflect.TypeOf(time.Duration(0)), "90", nil, true},
+		{"Uint16", reflect.TypeOf(uint16(0)), "65535", uint16(65535), false},
+		{"InvalidUint", reflect.TypeOf(uint(0)), "-1", nil, true},
+		{"URL", reflect.TypeOf(url.URL{}), "service-1:8080", *u, false},
+		{"InvalidURL", reflect.TypeOf(url.URL{}), "%zz", nil, true},
+		{"TextUnmarshaler", reflect.TypeOf(logLevel(0)), "error", levelError, false},
+		{"InvalidTextUnmarshaler", reflect.TypeOf(logLevel(0)), "invalid", nil, true},
+		{"FlagValue", reflect.TypeOf(byteSize(0)), "2KB", byteSize(2048), false},
+		{"InvalidFlagValue", reflect.TypeOf(byteSize(0)), "2XB", nil, true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := parseValue(tc.typ, tc.val)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedValue, v.Interface())
+			}
+		})
+	}
+}
+
+func TestSetUnmarshaler(t *testing.T) {
+	tests := []struct {
+		name           string
+		field          interface{}
+		fieldValue     string
+		expectedValue  interface{}
+		expectedResult bool
+		expectError    bool
+	}{
+		{
+			name:           "NewTextUnmarshalerValue",
+			field:          new(logLevel),
+			fieldValue:     "info",
+			expectedValue:  levelInfo,
+			expectedResult: true,
+		},
+		{
+			name:           "NoNewTextUnmarshalerValue",
+			field:          new(logLevel),
+			fieldValue:     "debug",
+			expectedValue:  levelDebug,
+			expectedResult: false,
+		},
+		{
+			name:           "InvalidTextUnmarshalerValue",
+			field:          new(logLevel),
+			fieldValue:     "invalid",
+			expectedValue:  levelDebug,
+			expectedResult: false,
+			expectError:    true,
+		},
+		{
+			name:           "NewFlagValue",
+			field:          new(byteSize),
+			fieldValue:     "64MB",
+			expectedValue:  byteSize(64 << 20),
+			expectedResult: true,
+		},
+		{
+			name:           "InvalidFlagValue",
+			field:          new(byteSize),
+			fieldValue:     "64",
+			expectedValue:  byteSize(0),
+			expectedResult: false,
+			expectError:    true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			v := reflect.ValueOf(tc.field).Elem()
+			res, err := setUnmarshaler(v, tc.fieldValue)
 
-			assert.Equal(t, tc.expectedValues, tc.field)
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Equal(t, tc.expectedValue, v.Interface())
 			assert.Equal(t, tc.expectedResult, res)
 		})
 	}
 }
 
-func TestSetUint64Slice(t *testing.T) {
+func TestSetUnmarshalerSlice(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
-		field          []uint64
-		fieldName      string
+		field          []logLevel
 		fieldValues    []string
-		expectedValues []uint64
+		expectedValues []logLevel
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
-			field:          []uint64{},
-			fieldName:      "Field",
-			fieldValues:    []string{"9223372036854775808", "18446744073709551615"},
-			expectedValues: []uint64{9223372036854775808, 18446744073709551615},
+			field:          []logLevel{},
+			fieldValues:    []string{"info", "error"},
+			expectedValues: []logLevel{levelInfo, levelError},
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
-			field:          []uint64{9223372036854775808, 18446744073709551615},
-			fieldName:      "Field",
-			fieldValues:    []string{"9223372036854775808", "18446744073709551615"},
-			expectedValues: []uint64{9223372036854775808, 18446744073709551615},
+			field:          []logLevel{levelInfo, levelError},
+			fieldValues:    []string{"info", "error"},
+			expectedValues: []logLevel{levelInfo, levelError},
+			expectedResult: false,
+		},
+		{
+			name:           "InvalidValue",
+			field:          []logLevel{levelInfo, levelError},
+			fieldValues:    []string{"info", "invalid"},
+			expectedValues: []logLevel{levelInfo, levelError},
 			expectedResult: false,
+			expectError:    true,
 		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
 			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setUint64Slice(v, tc.fieldName, tc.fieldValues)
+			res, err := setUnmarshalerSlice(v, tc.fieldValues)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValues, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -2295,43 +3866,86 @@ func TestSetUint64Slice(t *testing.T) {
 	}
 }
 
-func TestSetURLSlice(t *testing.T) {
-	u1, _ := url.Parse("localhost")
-	u2, _ := url.Parse("example.com")
-
+func TestSetMap(t *testing.T) {
 	tests := []struct {
 		name           string
-		c              *controller
-		field          []url.URL
-		fieldName      string
+		field          interface{}
 		fieldValues    []string
-		expectedValues []url.URL
+		kvSep          string
+		expectedValues interface{}
 		expectedResult bool
+		expectError    bool
 	}{
 		{
 			name:           "NewValue",
-			c:              &controller{},
-			field:          []url.URL{},
-			fieldName:      "Field",
-			fieldValues:    []string{"localhost", "example.com"},
-			expectedValues: []url.URL{*u1, *u2},
+			field:          &map[string]string{},
+			fieldValues:    []string{"env=prod", "team=core"},
+			kvSep:          "=",
+			expectedValues: &map[string]string{"env": "prod", "team": "core"},
 			expectedResult: true,
 		},
 		{
 			name:           "NoNewValue",
-			c:              &controller{},
-			field:          []url.URL{*u1, *u2},
-			fieldName:      "Field",
-			fieldValues:    []string{"localhost", "example.com"},
-			expectedValues: []url.URL{*u1, *u2},
+			field:          &map[string]string{"env": "prod", "team": "core"},
+			fieldValues:    []string{"team=core", "env=prod"},
+			kvSep:          "=",
+			expectedValues: &map[string]string{"env": "prod", "team": "core"},
+			expectedResult: false,
+		},
+		{
+			name:           "ValueWithSeparator",
+			field:          &map[string]string{},
+			fieldValues:    []string{"query=a=b"},
+			kvSep:          "=",
+			expectedValues: &map[string]string{"query": "a=b"},
+			expectedResult: true,
+		},
+		{
+			name:           "IntValues",
+			field:          &map[string]int{"tenant-a": 10},
+			fieldValues:    []string{"tenant-a:100", "tenant-b:200"},
+			kvSep:          ":",
+			expectedValues: &map[string]int{"tenant-a": 100, "tenant-b": 200},
+			expectedResult: true,
+		},
+		{
+			name:           "DurationValues",
+			field:          &map[string]time.Duration{},
+			fieldValues:    []string{"read=30s", "write=1m"},
+			kvSep:          "=",
+			expectedValues: &map[string]time.Duration{"read": 30 * time.Second, "write": time.Minute},
+			expectedResult: true,
+		},
+		{
+			name:           "MissingSeparator",
+			field:          &map[string]string{"env": "prod"},
+			fieldValues:    []string{"env"},
+			kvSep:          "=",
+			expectedValues: &map[string]string{"env": "prod"},
+			expectedResult: false,
+			expectError:    true,
+		},
+		{
+			name:           "InvalidValue",
+			field:          &map[string]int{"tenant-a": 10},
+			fieldValues:    []string{"tenant-a=invalid"},
+			kvSep:          "=",
+			expectedValues: &map[string]int{"tenant-a": 10},
 			expectedResult: false,
+			expectError:    true,
 		},
 	}
 
 	for _, tc := range tests {
 		t.Run(tc.name, func(t *testing.T) {
-			v := reflect.ValueOf(&tc.field).Elem()
-			res := tc.c.setURLSlice(v, tc.fieldName, tc.fieldValues)
+			v := reflect.ValueOf(tc.field).Elem()
+			res, err := setMap(v, tc.fieldValues, tc.kvSep)
+
+			if tc.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
 
 			assert.Equal(t, tc.expectedValues, tc.field)
 			assert.Equal(t, tc.expectedResult, res)
@@ -2339,6 +3953,43 @@ func TestSetURLSlice(t *testing.T) {
 	}
 }
 
+func TestResetField(t *testing.T) {
+	tests := []struct {
+		name            string
+		value           interface{}
+		def             interface{}
+		expectedChanged bool
+		expectedValue   interface{}
+	}{
+		{"Unchanged", "info", "info", false, "info"},
+		{"String", "debug", "info", true, "info"},
+		{"Slice", []string{"a", "b"}, []string{"a"}, true, []string{"a"}},
+		{"NoDefault", 27, nil, true, 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			v := reflect.New(reflect.TypeOf(tc.value)).Elem()
+			v.Set(reflect.ValueOf(tc.value))
+
+			f := fieldInfo{
+				Field: Field{Name: "Field"},
+				v:     v,
+			}
+
+			if tc.def != nil {
+				f.def = reflect.ValueOf(tc.def)
+			}
+
+			c := &controller{}
+			changed := c.resetField(f)
+
+			assert.Equal(t, tc.expectedChanged, changed)
+			assert.Equal(t, tc.expectedValue, v.Interface())
+		})
+	}
+}
+
 func TestSetField(t *testing.T) {
 	d90m := 90 * time.Minute
 	d120m := 120 * time.Minute
@@ -2584,12 +4235,15 @@ func TestSetField(t *testing.T) {
 				// Only consider exported and supported fields that their names start with "Field"
 				if v.CanSet() && isTypeSupported(v.Type()) && strings.HasPrefix(f.Name, "Field") {
 					f := fieldInfo{
-						v:       v,
-						name:    f.Name,
-						listSep: ",",
+						Field: Field{
+							Name:    f.Name,
+							ListSep: ",",
+						},
+						v: v,
 					}
 
-					res := tc.c.setField(f, tc.values[f.name])
+					res, err := tc.c.setField(f, tc.values[f.Name])
+					assert.NoError(t, err)
 					assert.Equal(t, tc.expectedResult, res)
 				}
 			}
@@ -2867,6 +4521,42 @@ func TestIterateOnFields(t *testing.T) {
 			},
 			expectedError: nil,
 		},
+		{
+			name: "NestedStructs",
+			c: &controller{
+				listSep:    ",",
+				prefixFlag: "config.",
+				prefixEnv:  "CONFIG_",
+			},
+			config:         &nestedConfig{},
+			expectedValues: []reflect.Value{},
+			expectedFieldNames: []string{
+				"Host", "Port",
+				"Database.URL", "Database.Pool.Size", "Database.Pool.Timeout",
+				"Cache.Address",
+			},
+			expectedFlagNames: []string{
+				"config.host", "config.port",
+				"config.database.url", "config.database.pool.size", "config.database.pool.wait",
+				"redis.address",
+			},
+			expectedEnvNames: []string{
+				"CONFIG_HOST", "CONFIG_PORT",
+				"CONFIG_DATABASE_URL", "CONFIG_DATABASE_POOL_SIZE", "CONFIG_DATABASE_POOL_WAIT",
+				"REDIS_ADDRESS",
+			},
+			expectedFileEnvNames: []string{
+				"HOST_FILE", "PORT_FILE",
+				"DATABASE_URL_FILE", "DATABASE_POOL_SIZE_FILE", "DATABASE_POOL_WAIT_PATH",
+				"-",
+			},
+			expectedListSeps: []string{
+				",", ",",
+				",", ",", ",",
+				",",
+			},
+			expectedError: nil,
+		},
 	}
 
 	for _, tc := range tests {
@@ -2881,13 +4571,13 @@ func TestIterateOnFields(t *testing.T) {
 			vStruct, err := validateStruct(tc.config)
 			assert.NoError(t, err)
 
-			tc.c.iterateOnFields(vStruct, func(v reflect.Value, fieldName, flagName, envName, fileEnvName, listSep string) {
+			tc.c.iterateOnFields(vStruct, func(v reflect.Value, f Field) {
 				// values = append(values, v)
-				fieldNames = append(fieldNames, fieldName)
-				flagNames = append(flagNames, flagName)
-				envNames = append(envNames, envName)
-				fileEnvNames = append(fileEnvNames, fileEnvName)
-				listSeps = append(listSeps, listSep)
+				fieldNames = append(fieldNames, f.Name)
+				flagNames = append(flagNames, f.FlagName)
+				envNames = append(envNames, f.EnvName)
+				fileEnvNames = append(fileEnvNames, f.FileEnvName)
+				listSeps = append(listSeps, f.ListSep)
 			})
 
 			// assert.Equal(t, tc.expectedValues, values)
@@ -2951,6 +4641,15 @@ func TestRegisterFlags(t *testing.T) {
 				"config.field.duration.array", "config.field.url.array",
 			},
 		},
+		{
+			name: "WithFlagSetOption",
+			c: &controller{
+				flagSet: flag.NewFlagSet("app", flag.ContinueOnError),
+			},
+			config:        &struct{ Port int }{},
+			expectedError: nil,
+			expectedFlags: []string{"port"},
+		},
 	}
 
 	for _, tc := range tests {
@@ -2961,7 +4660,7 @@ func TestRegisterFlags(t *testing.T) {
 			tc.c.registerFlags(vStruct)
 
 			for _, expectedFlag := range tc.expectedFlags {
-				f := flag.Lookup(expectedFlag)
+				f := tc.c.getFlagSet().Lookup(expectedFlag)
 				assert.NotEmpty(t, f)
 			}
 		})
@@ -3001,7 +4700,7 @@ func TestReadFields(t *testing.T) {
 			[]file{},
 			&controller{
 				listSep:       ",",
-				filesToFields: map[string]fieldInfo{},
+				filesToFields: map[string][]fieldInfo{},
 			},
 			&config{},
 			&config{},
@@ -3014,7 +4713,7 @@ func TestReadFields(t *testing.T) {
 			[]file{},
 			&controller{
 				listSep:       ",",
-				filesToFields: map[string]fieldInfo{},
+				filesToFields: map[string][]fieldInfo{},
 			},
 			&config{
 				unexported:         "internal",
@@ -3135,7 +4834,7 @@ func TestReadFields(t *testing.T) {
 			[]file{},
 			&controller{
 				listSep:       ",",
-				filesToFields: map[string]fieldInfo{},
+				filesToFields: map[string][]fieldInfo{},
 			},
 			&config{},
 			&config{
@@ -3219,7 +4918,7 @@ func TestReadFields(t *testing.T) {
 			[]file{},
 			&controller{
 				listSep:       ",",
-				filesToFields: map[string]fieldInfo{},
+				filesToFields: map[string][]fieldInfo{},
 			},
 			&config{},
 			&config{
@@ -3303,7 +5002,7 @@ func TestReadFields(t *testing.T) {
 			[]file{},
 			&controller{
 				listSep:       ",",
-				filesToFields: map[string]fieldInfo{},
+				filesToFields: map[string][]fieldInfo{},
 			},
 			&config{},
 			&config{
@@ -3387,7 +5086,7 @@ func TestReadFields(t *testing.T) {
 			[]file{},
 			&controller{
 				listSep:       ",",
-				filesToFields: map[string]fieldInfo{},
+				filesToFields: map[string][]fieldInfo{},
 			},
 			&config{},
 			&config{
@@ -3472,7 +5171,7 @@ func TestReadFields(t *testing.T) {
 			&controller{
 				listSep:       ",",
 				prefixFlag:    "config.",
-				filesToFields: map[string]fieldInfo{},
+				filesToFields: map[string][]fieldInfo{},
 			},
 			&config{},
 			&config{
@@ -3556,7 +5255,7 @@ func TestReadFields(t *testing.T) {
 			[]file{},
 			&controller{
 				listSep:       "|",
-				filesToFields: map[string]fieldInfo{},
+				filesToFields: map[string][]fieldInfo{},
 			},
 			&config{},
 			&config{
@@ -3642,7 +5341,7 @@ func TestReadFields(t *testing.T) {
 			[]file{},
 			&controller{
 				listSep:       ",",
-				filesToFields: map[string]fieldInfo{},
+				filesToFields: map[string][]fieldInfo{},
 			},
 			&config{},
 			&config{
@@ -3683,7 +5382,7 @@ func TestReadFields(t *testing.T) {
 				FieldDurationArray: []time.Duration{d90m, d120m},
 				FieldURLArray:      []url.URL{*service1URL, *service2URL},
 			},
-			0,
+			1, // SKIP_FLAG_ENV_FILE is a path to a file that does not exist
 		},
 		{
 			"AllFromEnvVarsWithPrefixEnvOption",
@@ -3729,7 +5428,7 @@ func TestReadFields(t *testing.T) {
 			&controller{
 				listSep:       ",",
 				prefixEnv:     "CONFIG_",
-				filesToFields: map[string]fieldInfo{},
+				filesToFields: map[string][]fieldInfo{},
 			},
 			&config{},
 			&config{
@@ -3815,7 +5514,7 @@ func TestReadFields(t *testing.T) {
 			[]file{},
 			&controller{
 				listSep:       "|",
-				filesToFields: map[string]fieldInfo{},
+				filesToFields: map[string][]fieldInfo{},
 			},
 			&config{},
 			&config{
@@ -3856,7 +5555,7 @@ func TestReadFields(t *testing.T) {
 				FieldDurationArray: []time.Duration{d90m, d120m},
 				FieldURLArray:      []url.URL{*service1URL, *service2URL},
 			},
-			0,
+			1, // SKIP_FLAG_ENV_FILE is a path to a file that does not exist
 		},
 		{
 			"AllFromFromFiles",
@@ -3901,7 +5600,7 @@ func TestReadFields(t *testing.T) {
 			},
 			&controller{
 				listSep:       ",",
-				filesToFields: map[string]fieldInfo{},
+				filesToFields: map[string][]fieldInfo{},
 			},
 			&config{},
 			&config{
@@ -3988,7 +5687,7 @@ func TestReadFields(t *testing.T) {
 			&controller{
 				listSep:       ",",
 				prefixFileEnv: "CONFIG_",
-				filesToFields: map[string]fieldInfo{},
+				filesToFields: map[string][]fieldInfo{},
 			},
 			&config{},
 			&config{
@@ -4074,7 +5773,7 @@ func TestReadFields(t *testing.T) {
 			},
 			&controller{
 				listSep:       "|",
-				filesToFields: map[string]fieldInfo{},
+				filesToFields: map[string][]fieldInfo{},
 			},
 			&config{},
 			&config{
@@ -4158,7 +5857,7 @@ func TestReadFields(t *testing.T) {
 			},
 			&controller{
 				listSep:       ",",
-				filesToFields: map[string]fieldInfo{},
+				filesToFields: map[string][]fieldInfo{},
 			},
 			&config{
 				FieldString:        "default",
@@ -4254,7 +5953,7 @@ func TestReadFields(t *testing.T) {
 				skipFlag:      true,
 				skipEnv:       true,
 				skipFileEnv:   true,
-				filesToFields: map[string]fieldInfo{},
+				filesToFields: map[string][]fieldInfo{},
 			},
 			&config{
 				FieldString:        "default",
@@ -4322,7 +6021,7 @@ func TestReadFields(t *testing.T) {
 			&controller{
 				listSep:       ",",
 				telepresence:  true,
-				filesToFields: map[string]fieldInfo{},
+				filesToFields: map[string][]fieldInfo{},
 			},
 			&config{},
 			&config{
@@ -4365,6 +6064,29 @@ func TestReadFields(t *testing.T) {
 			},
 			34,
 		},
+		{
+			"SharedFile",
+			[]string{"path/to/binary"},
+			[]env{},
+			[]file{
+				{"API_KEY_FILE", "secret"},
+			},
+			&controller{
+				filesToFields: map[string][]fieldInfo{},
+			},
+			&struct {
+				APIKey     string `fileenv:"API_KEY_FILE"`
+				BackendKey string `fileenv:"API_KEY_FILE"`
+			}{},
+			&struct {
+				APIKey     string `fileenv:"API_KEY_FILE"`
+				BackendKey string `fileenv:"API_KEY_FILE"`
+			}{
+				APIKey:     "secret",
+				BackendKey: "secret",
+			},
+			1,
+		},
 	}
 
 	origArgs := os.Args
@@ -4410,13 +6132,139 @@ func TestReadFields(t *testing.T) {
 			vStruct, err := validateStruct(tc.config)
 			assert.NoError(t, err)
 
-			tc.c.readFields(vStruct)
+			err = tc.c.readFields(vStruct)
+			assert.NoError(t, err)
 			assert.Equal(t, tc.expectedConfig, tc.config)
 			assert.Equal(t, tc.expectedFilesLen, len(tc.c.filesToFields))
 		})
 	}
 }
 
+func TestUpdateFields(t *testing.T) {
+	tests := []struct {
+		name            string
+		vals            map[string]string
+		expectedMin     int
+		expectedMax     int
+		expectedUpdates []Update
+	}{
+		{
+			name:        "NewValue",
+			vals:        map[string]string{"MaxConns": "20"},
+			expectedMin: 2,
+			expectedMax: 20,
+			expectedUpdates: []Update{
+				{Name: "MaxConns", Path: "MaxConns", Value: 20, OldValue: 10, Source: "file", Key: "/path/to/file"},
+			},
+		},
+		{
+			name:            "SameValue",
+			vals:            map[string]string{"MaxConns": "10"},
+			expectedMin:     2,
+			expectedMax:     10,
+			expectedUpdates: []Update{},
+		},
+		{
+			name:            "InvalidValue",
+			vals:            map[string]string{"MaxConns": "invalid"},
+			expectedMin:     2,
+			expectedMax:     10,
+			expectedUpdates: []Update{},
+		},
+		{
+			name:            "FailedValidation",
+			vals:            map[string]string{"MinConns": "0"},
+			expectedMin:     2,
+			expectedMax:     10,
+			expectedUpdates: []Update{},
+		},
+		{
+			name:        "BatchPassingValidator",
+			vals:        map[string]string{"MinConns": "20", "MaxConns": "40"},
+			expectedMin: 20,
+			expectedMax: 40,
+			expectedUpdates: []Update{
+				{Name: "MinConns", Path: "MinConns", Value: 20, OldValue: 2, Source: "file", Key: "/path/to/file"},
+				{Name: "MaxConns", Path: "MaxConns", Value: 40, OldValue: 10, Source: "file", Key: "/path/to/file"},
+			},
+		},
+		{
+			name:            "BatchFailingValidator",
+			vals:            map[string]string{"MinConns": "5", "MaxConns": "4"},
+			expectedMin:     2,
+			expectedMax:     10,
+			expectedUpdates: []Update{},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ch := make(chan Update, 2)
+			cs := make(chan ChangeSet, 1)
+			c := &controller{
+				subscribers: []chan Update{ch},
+				changeSets:  []chan ChangeSet{cs},
+			}
+
+			cfg := &poolConfig{
+				MinConns: 2,
+				MaxConns: 10,
+			}
+
+			updates := []fieldUpdate{}
+			for _, name := range []string{"MinConns", "MaxConns"} {
+				if val, ok := tc.vals[name]; ok {
+					sf, _ := reflect.TypeOf(cfg).Elem().FieldByName(name)
+					updates = append(updates, fieldUpdate{
+						fieldInfo: fieldInfo{
+							Field: Field{Name: name, Tag: sf.Tag},
+							v:     reflect.ValueOf(cfg).Elem().FieldByName(name),
+						},
+						val:    val,
+						source: sourceFile,
+						key:    "/path/to/file",
+					})
+				}
+			}
+
+			c.updateFields(cfg, updates)
+
+			cfg.Lock()
+			assert.Equal(t, tc.expectedMin, cfg.MinConns)
+			assert.Equal(t, tc.expectedMax, cfg.MaxConns)
+			cfg.Unlock()
+
+			received := []Update{}
+			timeout := time.After(100 * time.Millisecond)
+		loop:
+			for {
+				select {
+				case update := <-ch:
+					assert.False(t, update.Time.IsZero())
+					update.Time = time.Time{}
+					received = append(received, update)
+				case <-timeout:
+					break loop
+				}
+			}
+
+			assert.ElementsMatch(t, tc.expectedUpdates, received)
+
+			// All updates in the batch are sent as one change set
+			if len(tc.expectedUpdates) == 0 {
+				assert.Len(t, cs, 0)
+			} else {
+				changeSet := <-cs
+				assert.False(t, changeSet.Time.IsZero())
+				for i := range changeSet.Updates {
+					changeSet.Updates[i].Time = time.Time{}
+				}
+				assert.Equal(t, tc.expectedUpdates, changeSet.Updates)
+			}
+		})
+	}
+}
+
 func TestPick(t *testing.T) {
 	type env struct {
 		varName string
@@ -4441,7 +6289,7 @@ func TestPick(t *testing.T) {
 		config         interface{}
 		opts           []Option
 		expectedError  error
-		expectedConfig *config
+		expectedConfig interface{}
 	}{
 		{
 			"NonStruct",
@@ -5794,6 +7642,278 @@ func TestPick(t *testing.T) {
 				FieldURLArray:      []url.URL{*service1URL, *service2URL},
 			},
 		},
+		{
+			"WithCustomSource",
+			[]string{"path/to/binary"},
+			[]env{
+				{"FIELD_STRING", "content"},
+			},
+			[]file{},
+			&config{},
+			[]Option{
+				Sources(&mockSource{
+					name: "vault",
+					values: map[string]string{
+						"FieldString": "secret",
+						"FieldInt":    "27",
+					},
+				}),
+			},
+			nil,
+			&config{
+				FieldString: "content",
+				FieldInt:    27,
+			},
+		},
+		{
+			"WithCustomSourcePrecedence",
+			[]string{"path/to/binary"},
+			[]env{
+				{"FIELD_STRING", "content"},
+			},
+			[]file{},
+			&config{},
+			[]Option{
+				Sources(
+					FlagSource,
+					&mockSource{
+						name: "vault",
+						values: map[string]string{
+							"FieldString": "secret",
+							"FieldInt":    "27",
+						},
+					},
+					EnvSource,
+					FileEnvSource,
+				),
+			},
+			nil,
+			&config{
+				FieldString: "secret",
+				FieldInt:    27,
+			},
+		},
+		{
+			"CustomTypes",
+			[]string{
+				"path/to/binary",
+				"-log.level=error",
+			},
+			[]env{
+				{"LEVELS", "debug,info"},
+				{"CACHE_SIZE", "64MB"},
+				{"LIMITS", "upload=10MB,download=1GB"},
+			},
+			[]file{
+				{"SINCE_FILE", "2020-02-02T20:20:20Z"},
+			},
+			&customConfig{},
+			nil,
+			nil,
+			&customConfig{
+				LogLevel:  levelError,
+				Levels:    []logLevel{levelDebug, levelInfo},
+				CacheSize: byteSize(64 << 20),
+				Limits:    map[string]byteSize{"upload": byteSize(10 << 20), "download": byteSize(1 << 30)},
+				Since:     time.Date(2020, 2, 2, 20, 20, 20, 0, time.UTC),
+			},
+		},
+		{
+			"MapFields",
+			[]string{
+				"path/to/binary",
+				"-labels=env=prod,team=core",
+			},
+			[]env{
+				{"LIMITS", "tenant-a:100;tenant-b:200"},
+			},
+			[]file{
+				{"TIMEOUTS_FILE", "read=30s,write=1m"},
+			},
+			&mapConfig{},
+			nil,
+			nil,
+			&mapConfig{
+				Labels:   map[string]string{"env": "prod", "team": "core"},
+				Limits:   map[string]int{"tenant-a": 100, "tenant-b": 200},
+				Timeouts: map[string]time.Duration{"read": 30 * time.Second, "write": time.Minute},
+			},
+		},
+		{
+			"RequiredFields",
+			[]string{"path/to/binary"},
+			[]env{
+				{"PORT", "8080"},
+				{"DATABASE_URL", "postgres://localhost"},
+				{"TOKEN", "secret"},
+			},
+			[]file{},
+			&requiredConfig{},
+			nil,
+			nil,
+			&requiredConfig{
+				Port:        8080,
+				DatabaseURL: "postgres://localhost",
+				Token:       "secret",
+			},
+		},
+		{
+			"MissingRequiredFields",
+			[]string{"path/to/binary"},
+			[]env{
+				{"PORT", "8080"},
+			},
+			[]file{},
+			&requiredConfig{},
+			[]Option{
+				SkipFlag(),
+			},
+			Errors{
+				&MissingError{
+					Field:       "DatabaseURL",
+					EnvName:     "DATABASE_URL",
+					FileEnvName: "DATABASE_URL_FILE",
+				},
+				&MissingError{
+					Field:   "Token",
+					EnvName: "TOKEN",
+				},
+			},
+			nil,
+		},
+		{
+			"ValidValues",
+			[]string{"path/to/binary"},
+			[]env{
+				{"PORT", "8080"},
+				{"LOG_LEVEL", "info"},
+				{"NAME", "konfig"},
+				{"REPLICAS", "3"},
+				{"TAGS", "a,b"},
+			},
+			[]file{},
+			&validatedConfig{},
+			nil,
+			nil,
+			&validatedConfig{
+				Port:     8080,
+				LogLevel: "info",
+				Name:     "konfig",
+				Replicas: 3,
+				Tags:     []string{"a", "b"},
+			},
+		},
+		{
+			"InvalidValuesByValidation",
+			[]string{"path/to/binary"},
+			[]env{
+				{"PORT", "80000"},
+				{"LOG_LEVEL", "trace"},
+				{"NAME", "Konfig"},
+				{"TAGS", "a,b,c"},
+			},
+			[]file{},
+			&validatedConfig{},
+			nil,
+			Errors{
+				&ValidationError{Field: "Port", Value: 80000, Tag: "max", Message: "must be at most 65535"},
+				&ValidationError{Field: "LogLevel", Value: "trace", Tag: "oneof", Message: "must be one of debug, info, warn, error"},
+				&ValidationError{Field: "Name", Value: "Konfig", Tag: "pattern", Message: "must match ^[a-z]+$"},
+				&ValidationError{Field: "Replicas", Value: 0, Tag: "min", Message: "must be at least 1"},
+				&ValidationError{Field: "Tags", Value: []string{"a", "b", "c"}, Tag: "max", Message: "must be at most 2 elements"},
+			},
+			nil,
+		},
+		{
+			"PassedValidator",
+			[]string{"path/to/binary"},
+			[]env{
+				{"MIN_CONNS", "2"},
+				{"MAX_CONNS", "10"},
+			},
+			[]file{},
+			&poolConfig{},
+			nil,
+			nil,
+			&poolConfig{
+				MinConns: 2,
+				MaxConns: 10,
+			},
+		},
+		{
+			"FailedValidator",
+			[]string{"path/to/binary"},
+			[]env{
+				{"MIN_CONNS", "10"},
+				{"MAX_CONNS", "2"},
+			},
+			[]file{},
+			&poolConfig{},
+			nil,
+			errors.New("max conns 2 is less than min conns 10"),
+			nil,
+		},
+		{
+			"InvalidValues",
+			[]string{
+				"path/to/binary",
+				"-field.bool=maybe",
+			},
+			[]env{
+				{"FIELD_STRING", "content"},
+				{"FIELD_INT", "NaN"},
+			},
+			[]file{},
+			&config{},
+			nil,
+			Errors{
+				&ParseError{
+					Field:  "FieldBool",
+					Source: "flag",
+					Key:    "field.bool",
+					Value:  "maybe",
+					Err:    &strconv.NumError{Func: "ParseBool", Num: "maybe", Err: strconv.ErrSyntax},
+				},
+				&ParseError{
+					Field:  "FieldInt",
+					Source: "env",
+					Key:    "FIELD_INT",
+					Value:  "NaN",
+					Err:    &strconv.NumError{Func: "ParseInt", Num: "NaN", Err: strconv.ErrSyntax},
+				},
+			},
+			nil,
+		},
+		{
+			"NestedStructs",
+			[]string{
+				"path/to/binary",
+				"-host", "localhost",
+				"--database.pool.wait=30s",
+			},
+			[]env{
+				{"PORT", "8080"},
+				{"DATABASE_POOL_SIZE", "10"},
+				{"REDIS_ADDRESS", "redis:6379"},
+			},
+			[]file{
+				{"DATABASE_URL_FILE", "postgres://localhost:5432"},
+			},
+			&nestedConfig{},
+			nil,
+			nil,
+			func() *nestedConfig {
+				databaseURL, _ := url.Parse("postgres://localhost:5432")
+				c := &nestedConfig{}
+				c.Host = "localhost"
+				c.Port = 8080
+				c.Database.URL = *databaseURL
+				c.Database.Pool.Size = 10
+				c.Database.Pool.Timeout = 30 * time.Second
+				c.Cache.Address = "redis:6379"
+				return c
+			}(),
+		},
 	}
 
 	origArgs := os.Args
@@ -6019,69 +8139,69 @@ func TestWatch(t *testing.T) {
 				FieldURLArray:      []url.URL{*service3URL, *service4URL},
 			},
 			[]Update{
-				{"FieldString", "content"},
-				{"FieldBool", true},
-				{"FieldFloat32", float32(3.1415)},
-				{"FieldFloat64", float64(3.14159265359)},
-				{"FieldInt", int(-2147483648)},
-				{"FieldInt8", int8(-128)},
-				{"FieldInt16", int16(-32768)},
-				{"FieldInt32", int32(-2147483648)},
-				{"FieldInt64", int64(-9223372036854775808)},
-				{"FieldUint", uint(4294967295)},
-				{"FieldUint8", uint8(255)},
-				{"FieldUint16", uint16(65535)},
-				{"FieldUint32", uint32(4294967295)},
-				{"FieldUint64", uint64(18446744073709551615)},
-				{"FieldDuration", d90m},
-				{"FieldURL", *service1URL},
-				{"FieldStringArray", []string{"milad", "mona"}},
-				{"FieldBoolArray", []bool{false, true}},
-				{"FieldFloat32Array", []float32{3.1415, 2.7182}},
-				{"FieldFloat64Array", []float64{3.14159265359, 2.71828182845}},
-				{"FieldIntArray", []int{-2147483648, 2147483647}},
-				{"FieldInt8Array", []int8{-128, 127}},
-				{"FieldInt16Array", []int16{-32768, 32767}},
-				{"FieldInt32Array", []int32{-2147483648, 2147483647}},
-				{"FieldInt64Array", []int64{-9223372036854775808, 9223372036854775807}},
-				{"FieldUintArray", []uint{0, 4294967295}},
-				{"FieldUint8Array", []uint8{0, 255}},
-				{"FieldUint16Array", []uint16{0, 65535}},
-				{"FieldUint32Array", []uint32{0, 4294967295}},
-				{"FieldUint64Array", []uint64{0, 18446744073709551615}},
-				{"FieldDurationArray", []time.Duration{d90m, d120m}},
-				{"FieldURLArray", []url.URL{*service1URL, *service2URL}},
-
-				{"FieldFloat32", float32(2.7182)},
-				{"FieldFloat64", float64(2.7182818284)},
-				{"FieldInt", int(2147483647)},
-				{"FieldInt8", int8(127)},
-				{"FieldInt16", int16(32767)},
-				{"FieldInt32", int32(2147483647)},
-				{"FieldInt64", int64(9223372036854775807)},
-				{"FieldUint", uint(2147483648)},
-				{"FieldUint8", uint8(128)},
-				{"FieldUint16", uint16(32768)},
-				{"FieldUint32", uint32(2147483648)},
-				{"FieldUint64", uint64(9223372036854775808)},
-				{"FieldDuration", d4h},
-				{"FieldURL", *service3URL},
-				{"FieldStringArray", []string{"mona", "milad"}},
-				{"FieldBoolArray", []bool{true, false}},
-				{"FieldFloat32Array", []float32{2.7182, 3.1415}},
-				{"FieldFloat64Array", []float64{2.71828182845, 3.14159265359}},
-				{"FieldIntArray", []int{2147483647, -2147483648}},
-				{"FieldInt8Array", []int8{127, -128}},
-				{"FieldInt16Array", []int16{32767, -32768}},
-				{"FieldInt32Array", []int32{2147483647, -2147483648}},
-				{"FieldInt64Array", []int64{9223372036854775807, -9223372036854775808}},
-				{"FieldUintArray", []uint{4294967295, 0}},
-				{"FieldUint8Array", []uint8{255, 0}},
-				{"FieldUint16Array", []uint16{65535, 0}},
-				{"FieldUint32Array", []uint32{4294967295, 0}},
-				{"FieldUint64Array", []uint64{18446744073709551615, 0}},
-				{"FieldDurationArray", []time.Duration{d4h, d8h}},
-				{"FieldURLArray", []url.URL{*service3URL, *service4URL}},
+				{Name: "FieldString", Value: "content"},
+				{Name: "FieldBool", Value: true},
+				{Name: "FieldFloat32", Value: float32(3.1415)},
+				{Name: "FieldFloat64", Value: float64(3.14159265359)},
+				{Name: "FieldInt", Value: int(-2147483648)},
+				{Name: "FieldInt8", Value: int8(-128)},
+				{Name: "FieldInt16", Value: int16(-32768)},
+				{Name: "FieldInt32", Value: int32(-2147483648)},
+				{Name: "FieldInt64", Value: int64(-9223372036854775808)},
+				{Name: "FieldUint", Value: uint(4294967295)},
+				{Name: "FieldUint8", Value: uint8(255)},
+				{Name: "FieldUint16", Value: uint16(65535)},
+				{Name: "FieldUint32", Value: uint32(4294967295)},
+				{Name: "FieldUint64", Value: uint64(18446744073709551615)},
+				{Name: "FieldDuration", Value: d90m},
+				{Name: "FieldURL", Value: *service1URL},
+				{Name: "FieldStringArray", Value: []string{"milad", "mona"}},
+				{Name: "FieldBoolArray", Value: []bool{false, true}},
+				{Name: "FieldFloat32Array", Value: []float32{3.1415, 2.7182}},
+				{Name: "FieldFloat64Array", Value: []float64{3.14159265359, 2.71828182845}},
+				{Name: "FieldIntArray", Value: []int{-2147483648, 2147483647}},
+				{Name: "FieldInt8Array", Value: []int8{-128, 127}},
+				{Name: "FieldInt16Array", Value: []int16{-32768, 32767}},
+				{Name: "FieldInt32Array", Value: []int32{-2147483648, 2147483647}},
+				{Name: "FieldInt64Array", Value: []int64{-9223372036854775808, 9223372036854775807}},
+				{Name: "FieldUintArray", Value: []uint{0, 4294967295}},
+				{Name: "FieldUint8Array", Value: []uint8{0, 255}},
+				{Name: "FieldUint16Array", Value: []uint16{0, 65535}},
+				{Name: "FieldUint32Array", Value: []uint32{0, 4294967295}},
+				{Name: "FieldUint64Array", Value: []uint64{0, 18446744073709551615}},
+				{Name: "FieldDurationArray", Value: []time.Duration{d90m, d120m}},
+				{Name: "FieldURLArray", Value: []url.URL{*service1URL, *service2URL}},
+
+				{Name: "FieldFloat32", Value: float32(2.7182)},
+				{Name: "FieldFloat64", Value: float64(2.7182818284)},
+				{Name: "FieldInt", Value: int(2147483647)},
+				{Name: "FieldInt8", Value: int8(127)},
+				{Name: "FieldInt16", Value: int16(32767)},
+				{Name: "FieldInt32", Value: int32(2147483647)},
+				{Name: "FieldInt64", Value: int64(9223372036854775807)},
+				{Name: "FieldUint", Value: uint(2147483648)},
+				{Name: "FieldUint8", Value: uint8(128)},
+				{Name: "FieldUint16", Value: uint16(32768)},
+				{Name: "FieldUint32", Value: uint32(2147483648)},
+				{Name: "FieldUint64", Value: uint64(9223372036854775808)},
+				{Name: "FieldDuration", Value: d4h},
+				{Name: "FieldURL", Value: *service3URL},
+				{Name: "FieldStringArray", Value: []string{"mona", "milad"}},
+				{Name: "FieldBoolArray", Value: []bool{true, false}},
+				{Name: "FieldFloat32Array", Value: []float32{2.7182, 3.1415}},
+				{Name: "FieldFloat64Array", Value: []float64{2.71828182845, 3.14159265359}},
+				{Name: "FieldIntArray", Value: []int{2147483647, -2147483648}},
+				{Name: "FieldInt8Array", Value: []int8{127, -128}},
+				{Name: "FieldInt16Array", Value: []int16{32767, -32768}},
+				{Name: "FieldInt32Array", Value: []int32{2147483647, -2147483648}},
+				{Name: "FieldInt64Array", Value: []int64{9223372036854775807, -9223372036854775808}},
+				{Name: "FieldUintArray", Value: []uint{4294967295, 0}},
+				{Name: "FieldUint8Array", Value: []uint8{255, 0}},
+				{Name: "FieldUint16Array", Value: []uint16{65535, 0}},
+				{Name: "FieldUint32Array", Value: []uint32{4294967295, 0}},
+				{Name: "FieldUint64Array", Value: []uint64{18446744073709551615, 0}},
+				{Name: "FieldDurationArray", Value: []time.Duration{d4h, d8h}},
+				{Name: "FieldURLArray", Value: []url.URL{*service3URL, *service4URL}},
 			},
 		},
 		{
@@ -6209,69 +8329,69 @@ func TestWatch(t *testing.T) {
 				FieldURLArray:      []url.URL{*service3URL, *service4URL},
 			},
 			[]Update{
-				{"FieldString", "content"},
-				{"FieldBool", true},
-				{"FieldFloat32", float32(3.1415)},
-				{"FieldFloat64", float64(3.14159265359)},
-				{"FieldInt", int(-2147483648)},
-				{"FieldInt8", int8(-128)},
-				{"FieldInt16", int16(-32768)},
-				{"FieldInt32", int32(-2147483648)},
-				{"FieldInt64", int64(-9223372036854775808)},
-				{"FieldUint", uint(4294967295)},
-				{"FieldUint8", uint8(255)},
-				{"FieldUint16", uint16(65535)},
-				{"FieldUint32", uint32(4294967295)},
-				{"FieldUint64", uint64(18446744073709551615)},
-				{"FieldDuration", d90m},
-				{"FieldURL", *service1URL},
-				{"FieldStringArray", []string{"milad", "mona"}},
-				{"FieldBoolArray", []bool{false, true}},
-				{"FieldFloat32Array", []float32{3.1415, 2.7182}},
-				{"FieldFloat64Array", []float64{3.14159265359, 2.71828182845}},
-				{"FieldIntArray", []int{-2147483648, 2147483647}},
-				{"FieldInt8Array", []int8{-128, 127}},
-				{"FieldInt16Array", []int16{-32768, 32767}},
-				{"FieldInt32Array", []int32{-2147483648, 2147483647}},
-				{"FieldInt64Array", []int64{-9223372036854775808, 9223372036854775807}},
-				{"FieldUintArray", []uint{0, 4294967295}},
-				{"FieldUint8Array", []uint8{0, 255}},
-				{"FieldUint16Array", []uint16{0, 65535}},
-				{"FieldUint32Array", []uint32{0, 4294967295}},
-				{"FieldUint64Array", []uint64{0, 18446744073709551615}},
-				{"FieldDurationArray", []time.Duration{d90m, d120m}},
-				{"FieldURLArray", []url.URL{*service1URL, *service2URL}},
-
-				{"FieldFloat32", float32(2.7182)},
-				{"FieldFloat64", float64(2.7182818284)},
-				{"FieldInt", int(2147483647)},
-				{"FieldInt8", int8(127)},
-				{"FieldInt16", int16(32767)},
-				{"FieldInt32", int32(2147483647)},
-				{"FieldInt64", int64(9223372036854775807)},
-				{"FieldUint", uint(2147483648)},
-				{"FieldUint8", uint8(128)},
-				{"FieldUint16", uint16(32768)},
-				{"FieldUint32", uint32(2147483648)},
-				{"FieldUint64", uint64(9223372036854775808)},
-				{"FieldDuration", d4h},
-				{"FieldURL", *service3URL},
-				{"FieldStringArray", []string{"mona", "milad"}},
-				{"FieldBoolArray", []bool{true, false}},
-				{"FieldFloat32Array", []float32{2.7182, 3.1415}},
-				{"FieldFloat64Array", []float64{2.71828182845, 3.14159265359}},
-				{"FieldIntArray", []int{2147483647, -2147483648}},
-				{"FieldInt8Array", []int8{127, -128}},
-				{"FieldInt16Array", []int16{32767, -32768}},
-				{"FieldInt32Array", []int32{2147483647, -2147483648}},
-				{"FieldInt64Array", []int64{9223372036854775807, -9223372036854775808}},
-				{"FieldUintArray", []uint{4294967295, 0}},
-				{"FieldUint8Array", []uint8{255, 0}},
-				{"FieldUint16Array", []uint16{65535, 0}},
-				{"FieldUint32Array", []uint32{4294967295, 0}},
-				{"FieldUint64Array", []uint64{18446744073709551615, 0}},
-				{"FieldDurationArray", []time.Duration{d4h, d8h}},
-				{"FieldURLArray", []url.URL{*service3URL, *service4URL}},
+				{Name: "FieldString", Value: "content"},
+				{Name: "FieldBool", Value: true},
+				{Name: "FieldFloat32", Value: float32(3.1415)},
+				{Name: "FieldFloat64", Value: float64(3.14159265359)},
+				{Name: "FieldInt", Value: int(-2147483648)},
+				{Name: "FieldInt8", Value: int8(-128)},
+				{Name: "FieldInt16", Value: int16(-32768)},
+				{Name: "FieldInt32", Value: int32(-2147483648)},
+				{Name: "FieldInt64", Value: int64(-9223372036854775808)},
+				{Name: "FieldUint", Value: uint(4294967295)},
+				{Name: "FieldUint8", Value: uint8(255)},
+				{Name: "FieldUint16", Value: uint16(65535)},
+				{Name: "FieldUint32", Value: uint32(4294967295)},
+				{Name: "FieldUint64", Value: uint64(18446744073709551615)},
+				{Name: "FieldDuration", Value: d90m},
+				{Name: "FieldURL", Value: *service1URL},
+				{Name: "FieldStringArray", Value: []string{"milad", "mona"}},
+				{Name: "FieldBoolArray", Value: []bool{false, true}},
+				{Name: "FieldFloat32Array", Value: []float32{3.1415, 2.7182}},
+				{Name: "FieldFloat64Array", Value: []float64{3.14159265359, 2.71828182845}},
+				{Name: "FieldIntArray", Value: []int{-2147483648, 2147483647}},
+				{Name: "FieldInt8Array", Value: []int8{-128, 127}},
+				{Name: "FieldInt16Array", Value: []int16{-32768, 32767}},
+				{Name: "FieldInt32Array", Value: []int32{-2147483648, 2147483647}},
+				{Name: "FieldInt64Array", Value: []int64{-9223372036854775808, 9223372036854775807}},
+				{Name: "FieldUintArray", Value: []uint{0, 4294967295}},
+				{Name: "FieldUint8Array", Value: []uint8{0, 255}},
+				{Name: "FieldUint16Array", Value: []uint16{0, 65535}},
+				{Name: "FieldUint32Array", Value: []uint32{0, 4294967295}},
+				{Name: "FieldUint64Array", Value: []uint64{0, 18446744073709551615}},
+				{Name: "FieldDurationArray", Value: []time.Duration{d90m, d120m}},
+				{Name: "FieldURLArray", Value: []url.URL{*service1URL, *service2URL}},
+
+				{Name: "FieldFloat32", Value: float32(2.7182)},
+				{Name: "FieldFloat64", Value: float64(2.7182818284)},
+				{Name: "FieldInt", Value: int(2147483647)},
+				{Name: "FieldInt8", Value: int8(127)},
+				{Name: "FieldInt16", Value: int16(32767)},
+				{Name: "FieldInt32", Value: int32(2147483647)},
+				{Name: "FieldInt64", Value: int64(9223372036854775807)},
+				{Name: "FieldUint", Value: uint(2147483648)},
+				{Name: "FieldUint8", Value: uint8(128)},
+				{Name: "FieldUint16", Value: uint16(32768)},
+				{Name: "FieldUint32", Value: uint32(2147483648)},
+				{Name: "FieldUint64", Value: uint64(9223372036854775808)},
+				{Name: "FieldDuration", Value: d4h},
+				{Name: "FieldURL", Value: *service3URL},
+				{Name: "FieldStringArray", Value: []string{"mona", "milad"}},
+				{Name: "FieldBoolArray", Value: []bool{true, false}},
+				{Name: "FieldFloat32Array", Value: []float32{2.7182, 3.1415}},
+				{Name: "FieldFloat64Array", Value: []float64{2.71828182845, 3.14159265359}},
+				{Name: "FieldIntArray", Value: []int{2147483647, -2147483648}},
+				{Name: "FieldInt8Array", Value: []int8{127, -128}},
+				{Name: "FieldInt16Array", Value: []int16{32767, -32768}},
+				{Name: "FieldInt32Array", Value: []int32{2147483647, -2147483648}},
+				{Name: "FieldInt64Array", Value: []int64{9223372036854775807, -9223372036854775808}},
+				{Name: "FieldUintArray", Value: []uint{4294967295, 0}},
+				{Name: "FieldUint8Array", Value: []uint8{255, 0}},
+				{Name: "FieldUint16Array", Value: []uint16{65535, 0}},
+				{Name: "FieldUint32Array", Value: []uint32{4294967295, 0}},
+				{Name: "FieldUint64Array", Value: []uint64{18446744073709551615, 0}},
+				{Name: "FieldDurationArray", Value: []time.Duration{d4h, d8h}},
+				{Name: "FieldURLArray", Value: []url.URL{*service3URL, *service4URL}},
 			},
 		},
 	}
@@ -6336,7 +8456,8 @@ func TestWatch(t *testing.T) {
 			for i, sub := range tc.subscribers {
 				go func(id int, ch chan Update) {
 					for update := range ch {
-						assert.Contains(t, tc.expectedUpdates, update)
+						// Initial and new values of fields are compared regardless of where they are read from
+						assert.Contains(t, tc.expectedUpdates, Update{Name: update.Name, Value: update.Value})
 					}
 				}(i, sub)
 			}
@@ -6369,3 +8490,872 @@ func TestWatch(t *testing.T) {
 	// flag.Parse() can be called only once
 	flag.Parse()
 }
+
+func TestLoader(t *testing.T) {
+	type loaderConfig struct {
+		Port     int
+		LogLevel string
+		Token    string
+	}
+
+	tests := []struct {
+		name           string
+		args           []string
+		env            map[string]string
+		fs             mapFS
+		expectedError  error
+		expectedConfig loaderConfig
+	}{
+		{
+			name: "FromArgs",
+			args: []string{"-port", "8080", "-log.level=debug"},
+			env:  map[string]string{},
+			fs:   mapFS{},
+			expectedConfig: loaderConfig{
+				Port:     8080,
+				LogLevel: "debug",
+			},
+		},
+		{
+			name: "FromEnvAndFS",
+			args: []string{},
+			env: map[string]string{
+				"PORT":       "9090",
+				"LOG_LEVEL":  "info",
+				"TOKEN_FILE": "/secrets/token",
+			},
+			fs: mapFS{
+				"/secrets/token": "secret",
+			},
+			expectedConfig: loaderConfig{
+				Port:     9090,
+				LogLevel: "info",
+				Token:    "secret",
+			},
+		},
+		{
+			name: "OptionsFromEnv",
+			args: []string{"-port", "8080"},
+			env: map[string]string{
+				"KONFIG_SKIP_FLAG": "true",
+				"PORT":             "9090",
+			},
+			fs: mapFS{},
+			expectedConfig: loaderConfig{
+				Port: 9090,
+			},
+		},
+		{
+			name: "InvalidValue",
+			args: []string{"-port", "NaN"},
+			env:  map[string]string{},
+			fs:   mapFS{},
+			expectedError: Errors{
+				&ParseError{
+					Field:  "Port",
+					Source: "flag",
+					Key:    "port",
+					Value:  "NaN",
+					Err:    &strconv.NumError{Func: "ParseInt", Num: "NaN", Err: strconv.ErrSyntax},
+				},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			fs := flag.NewFlagSet("app", flag.ContinueOnError)
+			l := New(
+				Args(tc.args),
+				LookupEnv(func(name string) (string, bool) {
+					val, ok := tc.env[name]
+					return val, ok
+				}),
+				FlagSet(fs),
+				FS(tc.fs),
+			)
+
+			config := loaderConfig{}
+			err := l.Pick(&config)
+
+			assert.Equal(t, tc.expectedError, err)
+			if tc.expectedError == nil {
+				assert.Equal(t, tc.expectedConfig, config)
+			}
+
+			// Flags are registered on the loader flag set
+			assert.NotNil(t, fs.Lookup("port"))
+			assert.NotNil(t, fs.Lookup("log.level"))
+			assert.NotNil(t, fs.Lookup("token"))
+		})
+	}
+}
+
+func TestLoaderIndependence(t *testing.T) {
+	type serviceConfig struct {
+		Port int
+	}
+
+	l1 := New(Args([]string{"-port", "8080"}), FlagSet(flag.NewFlagSet("one", flag.ContinueOnError)))
+	l2 := New(Args([]string{"-port", "9090"}), FlagSet(flag.NewFlagSet("two", flag.ContinueOnError)))
+
+	c1 := serviceConfig{}
+	c2 := serviceConfig{}
+
+	assert.NoError(t, l1.Pick(&c1))
+	assert.NoError(t, l2.Pick(&c2))
+
+	assert.Equal(t, 8080, c1.Port)
+	assert.Equal(t, 9090, c2.Port)
+}
+
+func TestLoaderTrim(t *testing.T) {
+	type trimConfig struct {
+		Port     int
+		Enabled  bool
+		Password string
+		Banner   string `trim:"none"`
+		Token    string `trim:"space"`
+	}
+
+	fs := mapFS{
+		"/secrets/port":     "8080\n",
+		"/secrets/enabled":  "true\r\n",
+		"/secrets/password": " pass word \n",
+		"/secrets/banner":   "hello\n",
+		"/secrets/token":    "\t token \n",
+	}
+
+	env := map[string]string{
+		"PORT_FILE":     "/secrets/port",
+		"ENABLED_FILE":  "/secrets/enabled",
+		"PASSWORD_FILE": "/secrets/password",
+		"BANNER_FILE":   "/secrets/banner",
+		"TOKEN_FILE":    "/secrets/token",
+	}
+
+	tests := []struct {
+		name           string
+		opts           []Option
+		expectedConfig trimConfig
+	}{
+		{
+			name: "Default",
+			opts: []Option{},
+			expectedConfig: trimConfig{
+				Port:     8080,
+				Enabled:  true,
+				Password: " pass word ",
+				Banner:   "hello\n",
+				Token:    "token",
+			},
+		},
+		{
+			name: "TrimSpace",
+			opts: []Option{Trim(TrimSpace)},
+			expectedConfig: trimConfig{
+				Port:     8080,
+				Enabled:  true,
+				Password: "pass word",
+				Banner:   "hello\n",
+				Token:    "token",
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := append([]Option{
+				Args([]string{}),
+				LookupEnv(func(name string) (string, bool) {
+					val, ok := env[name]
+					return val, ok
+				}),
+				FlagSet(flag.NewFlagSet("app", flag.ContinueOnError)),
+				FS(fs),
+			}, tc.opts...)
+
+			config := trimConfig{}
+			err := New(opts...).Pick(&config)
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedConfig, config)
+		})
+	}
+}
+
+func TestLoaderSecret(t *testing.T) {
+	type secretConfig struct {
+		sync.Mutex
+		User     string
+		Password string `secret:"true"`
+		APIKey   string `konfig:"secret"`
+		PIN      int    `secret:"true"`
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	env := map[string]string{
+		"USER":          "admin",
+		"PASSWORD_FILE": "/secrets/password",
+		"API_KEY":       "k3y-s3cr3t",
+		"PIN":           "p1n-s3cr3t",
+	}
+
+	fs := flag.NewFlagSet("app", flag.ContinueOnError)
+	l := New(
+		Debug(5),
+		Args([]string{}),
+		LookupEnv(func(name string) (string, bool) {
+			val, ok := env[name]
+			return val, ok
+		}),
+		FlagSet(fs),
+		FS(mapFS{
+			"/secrets/password": "p4ss-s3cr3t\n",
+		}),
+	)
+
+	config := secretConfig{
+		Password: "default-s3cr3t",
+	}
+
+	report, err := l.Explain(&config)
+
+	assert.EqualError(t, err, "invalid value ****** for PIN from env PIN")
+	assert.Equal(t, "admin", config.User)
+	assert.Equal(t, "p4ss-s3cr3t", config.Password)
+	assert.Equal(t, "k3y-s3cr3t", config.APIKey)
+
+	assert.Equal(t, "admin", report[0].Value)
+	assert.Equal(t, "******", report[1].Value)
+	assert.Equal(t, "******", report[2].Value)
+	assert.Equal(t, "******", report[3].Value)
+	assert.Equal(t, "/secrets/password", report[1].Key)
+
+	// The default value is masked in the flag usage
+	assert.Contains(t, fs.Lookup("password").Usage, "******")
+	assert.NotContains(t, fs.Lookup("password").Usage, "default-s3cr3t")
+
+	// Values of secret fields received while watching are masked too
+	var update Update
+	c := &controller{
+		debug:    5,
+		watching: true,
+		handlers: []handler{
+			{f: func(u Update) { update = u }},
+		},
+	}
+
+	c.updateFields(&config, []fieldUpdate{
+		{
+			fieldInfo: fieldInfo{
+				Field: Field{Name: "Password", Secret: true},
+				v:     reflect.ValueOf(&config).Elem().FieldByName("Password"),
+			},
+			val:    "n3w-s3cr3t",
+			source: "file",
+			key:    "/secrets/password",
+		},
+	})
+
+	assert.Equal(t, "n3w-s3cr3t", config.Password)
+	assert.Equal(t, "Password changed ****** -> ****** from file /secrets/password", update.String())
+
+	assert.Contains(t, buf.String(), "[Password] value read from file /secrets/password: ******")
+	assert.Contains(t, buf.String(), "received an update from file /secrets/password: ******")
+
+	logs := buf.String() + report.String()
+	assert.Contains(t, logs, "admin")
+	assert.Contains(t, logs, "******")
+	assert.NotContains(t, logs, "s3cr3t")
+}
+
+func TestLoaderReload(t *testing.T) {
+	type reloadConfig struct {
+		sync.Mutex
+		Port     int
+		LogLevel string
+		Token    string
+		Timeout  time.Duration
+	}
+
+	tests := []struct {
+		name             string
+		env              map[string]string
+		fs               mapFS
+		newEnv           map[string]string
+		expectedPort     int
+		expectedLogLevel string
+		expectedToken    string
+		expectedTimeout  time.Duration
+		expectedUpdates  []Update
+	}{
+		{
+			name:             "NoChange",
+			env:              map[string]string{"PORT": "8080"},
+			fs:               mapFS{},
+			newEnv:           map[string]string{"PORT": "8080"},
+			expectedPort:     8080,
+			expectedLogLevel: "info",
+			expectedUpdates:  []Update{},
+		},
+		{
+			name:             "NewEnvValue",
+			env:              map[string]string{"PORT": "8080"},
+			fs:               mapFS{},
+			newEnv:           map[string]string{"PORT": "9090", "LOG_LEVEL": "debug"},
+			expectedPort:     9090,
+			expectedLogLevel: "debug",
+			expectedUpdates: []Update{
+				{Name: "Port", Path: "Port", Value: 9090, OldValue: 8080, Source: "env", Key: "PORT"},
+				{Name: "LogLevel", Path: "LogLevel", Value: "debug", OldValue: "info", Source: "env", Key: "LOG_LEVEL"},
+			},
+		},
+		{
+			name:             "NewFileEnv",
+			env:              map[string]string{"PORT": "8080"},
+			fs:               mapFS{"/secrets/token": "secret"},
+			newEnv:           map[string]string{"PORT": "8080", "TOKEN_FILE": "/secrets/token"},
+			expectedPort:     8080,
+			expectedLogLevel: "info",
+			expectedToken:    "secret",
+			expectedUpdates: []Update{
+				{Name: "Token", Path: "Token", Value: "secret", OldValue: "", Source: "file", Key: "/secrets/token"},
+			},
+		},
+		{
+			name:             "NoValueAnymore",
+			env:              map[string]string{"PORT": "8080"},
+			fs:               mapFS{},
+			newEnv:           map[string]string{},
+			expectedPort:     8080,
+			expectedLogLevel: "info",
+			expectedUpdates:  []Update{},
+		},
+		{
+			name:             "InvalidValue",
+			env:              map[string]string{"PORT": "8080"},
+			fs:               mapFS{},
+			newEnv:           map[string]string{"PORT": "NaN", "TIMEOUT": "1m"},
+			expectedPort:     8080,
+			expectedLogLevel: "info",
+			expectedTimeout:  time.Minute,
+			expectedUpdates: []Update{
+				{Name: "Timeout", Path: "Timeout", Value: time.Minute, OldValue: time.Duration(0), Source: "env", Key: "TIMEOUT"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var mu sync.Mutex
+			env := tc.env
+			updates := []Update{}
+
+			l := New(
+				Args([]string{}),
+				LookupEnv(func(name string) (string, bool) {
+					mu.Lock()
+					defer mu.Unlock()
+					val, ok := env[name]
+					return val, ok
+				}),
+				FlagSet(flag.NewFlagSet("app", flag.ContinueOnError)),
+				FS(tc.fs),
+				OnAnyChange(func(update Update) {
+					update.Time = time.Time{}
+					updates = append(updates, update)
+				}),
+			)
+
+			config := &reloadConfig{LogLevel: "info"}
+
+			close, err := l.Watch(config, nil)
+			assert.NoError(t, err)
+			defer close()
+
+			// Ignore the updates for values read initially
+			mu.Lock()
+			env = tc.newEnv
+			updates = []Update{}
+			mu.Unlock()
+
+			l.Reload()
+
+			config.Lock()
+			assert.Equal(t, tc.expectedPort, config.Port)
+			assert.Equal(t, tc.expectedLogLevel, config.LogLevel)
+			assert.Equal(t, tc.expectedToken, config.Token)
+			assert.Equal(t, tc.expectedTimeout, config.Timeout)
+			config.Unlock()
+
+			// Handlers are called before Reload returns
+			assert.Equal(t, tc.expectedUpdates, updates)
+
+			// A stopped watch is not reloaded anymore
+			close()
+			mu.Lock()
+			env = map[string]string{"PORT": "7070"}
+			mu.Unlock()
+			l.Reload()
+
+			config.Lock()
+			assert.Equal(t, tc.expectedPort, config.Port)
+			config.Unlock()
+		})
+	}
+}
+
+func TestWatchContext(t *testing.T) {
+	type watchConfig struct {
+		sync.Mutex
+		LogLevel string
+	}
+
+	tests := []struct {
+		name            string
+		config          sync.Locker
+		ctx             func() (context.Context, context.CancelFunc)
+		expectedError   error
+		expectedWaitErr error
+	}{
+		{
+			name: "MissingRequiredField",
+			config: &struct {
+				sync.Mutex
+				Port int `required:"true"`
+			}{},
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+			expectedError: Errors{
+				&MissingError{Field: "Port", FlagName: "port", EnvName: "PORT", FileEnvName: "PORT_FILE"},
+			},
+		},
+		{
+			name:   "Cancelled",
+			config: &watchConfig{},
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithCancel(context.Background())
+			},
+			expectedWaitErr: context.Canceled,
+		},
+		{
+			name:   "DeadlineExceeded",
+			config: &watchConfig{},
+			ctx: func() (context.Context, context.CancelFunc) {
+				return context.WithTimeout(context.Background(), 500*time.Millisecond)
+			},
+			expectedWaitErr: context.DeadlineExceeded,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "gotest_")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			path := filepath.Join(dir, "log_level")
+			err = ioutil.WriteFile(path, []byte("info"), 0644)
+			assert.NoError(t, err)
+
+			env := map[string]string{
+				"LOG_LEVEL_FILE": path,
+			}
+
+			ctx, cancel := tc.ctx()
+			defer cancel()
+
+			// Subscribers receive updates until their channels are closed
+			ch := make(chan Update)
+			received := make(chan []Update)
+			go func() {
+				updates := []Update{}
+				for update := range ch {
+					updates = append(updates, update)
+				}
+				received <- updates
+			}()
+
+			wait, err := WatchContext(ctx, tc.config, []chan Update{ch},
+				Args([]string{}),
+				LookupEnv(func(name string) (string, bool) {
+					val, ok := env[name]
+					return val, ok
+				}),
+				FlagSet(flag.NewFlagSet("app", flag.ContinueOnError)),
+			)
+
+			if tc.expectedError != nil {
+				assert.Equal(t, tc.expectedError, err)
+				assert.Nil(t, wait)
+				return
+			}
+
+			assert.NoError(t, err)
+
+			time.Sleep(100 * time.Millisecond)
+			err = ioutil.WriteFile(path, []byte("debug"), 0644)
+			assert.NoError(t, err)
+			time.Sleep(100 * time.Millisecond)
+
+			if tc.expectedWaitErr == context.Canceled {
+				cancel()
+			}
+
+			assert.Equal(t, tc.expectedWaitErr, wait())
+			// The terminal error can be read more than once
+			assert.Equal(t, tc.expectedWaitErr, wait())
+
+			select {
+			case updates := <-received:
+				values := []interface{}{}
+				for _, update := range updates {
+					values = append(values, update.Value)
+				}
+				assert.Equal(t, []interface{}{"info", "debug"}, values)
+			case <-time.After(2 * time.Second):
+				t.Fatal("subscriber channel is not closed")
+			}
+		})
+	}
+}
+
+func TestWatchStopsDispatchers(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           map[string]string
+		expectedError bool
+	}{
+		{
+			name:          "Success",
+			env:           map[string]string{"PORT": "8080"},
+			expectedError: false,
+		},
+		{
+			name:          "ReadError",
+			env:           map[string]string{"PORT": "invalid"},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &struct {
+				sync.Mutex
+				LogLevel string
+				Port     int
+			}{}
+
+			before := runtime.NumGoroutine()
+
+			// Nothing ever receives from the subscriber
+			close, err := Watch(config, []chan Update{make(chan Update)},
+				Args([]string{}),
+				LookupEnv(func(name string) (string, bool) {
+					val, ok := tc.env[name]
+					return val, ok
+				}),
+				FlagSet(flag.NewFlagSet("app", flag.ContinueOnError)),
+				Delivery(Block, 1),
+			)
+
+			if tc.expectedError {
+				assert.Error(t, err)
+				assert.Nil(t, close)
+			} else {
+				assert.NoError(t, err)
+				close()
+			}
+
+			deadline := time.Now().Add(time.Second)
+			for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+		})
+	}
+}
+
+func TestWatchContextWithChangeSetNotReceived(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotest_")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log_level")
+	err = ioutil.WriteFile(path, []byte("info"), 0644)
+	assert.NoError(t, err)
+
+	env := map[string]string{
+		"LOG_LEVEL_FILE": path,
+	}
+
+	config := &struct {
+		sync.Mutex
+		LogLevel string
+	}{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Nothing ever receives from the subscriber
+	wait, err := WatchContext(ctx, config, nil,
+		Args([]string{}),
+		LookupEnv(func(name string) (string, bool) {
+			val, ok := env[name]
+			return val, ok
+		}),
+		FlagSet(flag.NewFlagSet("app", flag.ContinueOnError)),
+		ChangeSets(make(chan ChangeSet)),
+	)
+	assert.NoError(t, err)
+
+	time.Sleep(100 * time.Millisecond)
+	err = ioutil.WriteFile(path, []byte("debug"), 0644)
+	assert.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+
+	cancel()
+
+	waitErr := make(chan error, 1)
+	go func() {
+		waitErr <- wait()
+	}()
+
+	select {
+	case err := <-waitErr:
+		assert.Equal(t, context.Canceled, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("watch not stopped")
+	}
+}
+
+func TestPickOnChange(t *testing.T) {
+	config := &struct {
+		LogLevel string
+	}{
+		LogLevel: "warn",
+	}
+
+	calls := 0
+	err := Pick(config,
+		Args([]string{}),
+		LookupEnv(func(name string) (string, bool) {
+			if name == "LOG_LEVEL" {
+				return "info", true
+			}
+			return "", false
+		}),
+		FlagSet(flag.NewFlagSet("app", flag.ContinueOnError)),
+		OnChange("LogLevel", func(old, new interface{}) {
+			calls++
+		}),
+		OnAnyChange(func(update Update) {
+			calls++
+		}),
+	)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "info", config.LogLevel)
+
+	// Handlers are only called while watching
+	assert.Equal(t, 0, calls)
+}
+
+func TestWatchBlockDelivery(t *testing.T) {
+	type blockConfig struct {
+		sync.Mutex
+		LogLevel string
+		Port     int
+		Timeout  time.Duration
+	}
+
+	newLoader := func(env map[string]string, opts ...Option) *Loader {
+		return New(append([]Option{
+			Args([]string{}),
+			LookupEnv(func(name string) (string, bool) {
+				val, ok := env[name]
+				return val, ok
+			}),
+			FlagSet(flag.NewFlagSet("app", flag.ContinueOnError)),
+			Delivery(Block, 1),
+		}, opts...)...)
+	}
+
+	t.Run("InitialValues", func(t *testing.T) {
+		env := map[string]string{"LOG_LEVEL": "debug", "PORT": "8080", "TIMEOUT": "1m"}
+		sub := make(chan Update)
+
+		// The subscriber only starts receiving once Watch returns
+		watched := make(chan func(), 1)
+		go func() {
+			close, err := newLoader(env).Watch(&blockConfig{}, []chan Update{sub})
+			assert.NoError(t, err)
+			watched <- close
+		}()
+
+		var close func()
+		select {
+		case close = <-watched:
+		case <-time.After(time.Second):
+			t.Fatal("watch not started")
+		}
+		defer close()
+
+		names := []string{}
+		for i := 0; i < 3; i++ {
+			select {
+			case update := <-sub:
+				names = append(names, update.Name)
+			case <-time.After(time.Second):
+				t.Fatal("timed out waiting for update")
+			}
+		}
+
+		assert.Equal(t, []string{"LogLevel", "Port", "Timeout"}, names)
+	})
+
+	t.Run("SubscriberStalled", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "gotest_")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+
+		path := filepath.Join(dir, "config.yaml")
+		err = ioutil.WriteFile(path, []byte("log.level: info\nport: 8080\ntimeout: 1m\n"), 0644)
+		assert.NoError(t, err)
+
+		// Nothing ever receives from the subscriber
+		close, err := newLoader(nil, File(path)).Watch(&blockConfig{}, []chan Update{make(chan Update)})
+		assert.NoError(t, err)
+
+		time.Sleep(100 * time.Millisecond)
+		err = ioutil.WriteFile(path, []byte("log.level: debug\nport: 9090\ntimeout: 2m\n"), 0644)
+		assert.NoError(t, err)
+		time.Sleep(100 * time.Millisecond)
+
+		closed := make(chan struct{})
+		go func() {
+			close()
+			closed <- struct{}{}
+		}()
+
+		select {
+		case <-closed:
+		case <-time.After(2 * time.Second):
+			t.Fatal("watch not stopped")
+		}
+	})
+}
+
+func TestWatchInitialValuesRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+	}{
+		{
+			name: "ParseError",
+			env:  map[string]string{"MIN_CONNS": "1", "MAX_CONNS": "invalid"},
+		},
+		{
+			name: "ValidationError",
+			env:  map[string]string{"MIN_CONNS": "10", "MAX_CONNS": "1"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &connsConfig{}
+			sub := make(chan Update, 10)
+
+			calls := 0
+			before := runtime.NumGoroutine()
+
+			close, err := Watch(cfg, []chan Update{sub, make(chan Update)},
+				Args([]string{}),
+				LookupEnv(func(name string) (string, bool) {
+					val, ok := tc.env[name]
+					return val, ok
+				}),
+				FlagSet(flag.NewFlagSet("app", flag.ContinueOnError)),
+				OnAnyChange(func(update Update) {
+					calls++
+				}),
+			)
+
+			assert.Error(t, err)
+			assert.Nil(t, close)
+
+			// Nothing is notified of values that are rejected
+			time.Sleep(50 * time.Millisecond)
+			assert.Equal(t, 0, calls)
+			assert.Len(t, sub, 0)
+			assert.LessOrEqual(t, runtime.NumGoroutine(), before)
+		})
+	}
+}
+
+func TestWatchOnChange(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotest_")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "log_level")
+	err = ioutil.WriteFile(path, []byte("info"), 0644)
+	assert.NoError(t, err)
+
+	env := map[string]string{
+		"LOG_LEVEL_FILE": path,
+	}
+
+	config := &struct {
+		sync.Mutex
+		LogLevel string
+		Port     int
+	}{
+		LogLevel: "warn",
+		Port:     8080,
+	}
+
+	var mu sync.Mutex
+	logLevels := [][]interface{}{}
+	paths := []string{}
+
+	close, err := Watch(config, nil,
+		Args([]string{}),
+		LookupEnv(func(name string) (string, bool) {
+			val, ok := env[name]
+			return val, ok
+		}),
+		FlagSet(flag.NewFlagSet("app", flag.ContinueOnError)),
+		OnChange("LogLevel", func(old, new interface{}) {
+			mu.Lock()
+			logLevels = append(logLevels, []interface{}{old, new})
+			mu.Unlock()
+		}),
+		OnAnyChange(func(update Update) {
+			mu.Lock()
+			paths = append(paths, update.Path)
+			mu.Unlock()
+		}),
+	)
+
+	assert.NoError(t, err)
+	defer close()
+
+	time.Sleep(100 * time.Millisecond)
+	err = ioutil.WriteFile(path, []byte("debug"), 0644)
+	assert.NoError(t, err)
+	time.Sleep(100 * time.Millisecond)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// Handlers are called for values read initially too
+	assert.Equal(t, [][]interface{}{{"warn", "info"}, {"info", "debug"}}, logLevels)
+	assert.Equal(t, []string{"LogLevel", "LogLevel"}, paths)
+}
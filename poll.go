@@ -0,0 +1,101 @@
+package konfig
+
+import (
+	"crypto/sha256"
+	"errors"
+	"os"
+	"time"
+)
+
+const defaultPollInterval = 5 * time.Second
+
+// fileState is the state of a file used for detecting changes to the file when polling.
+type fileState struct {
+	modTime int64
+	size    int64
+	hash    [sha256.Size]byte
+}
+
+// getFileState returns the modification time, the size, and the hash of the content of a file.
+// The content is hashed too, since the modification time may not change on some file systems (i.e. with a coarse time resolution).
+func (c *controller) getFileState(path string) (fileState, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return fileState{}, err
+	}
+
+	b, err := c.getFS().ReadFile(path)
+	if err != nil {
+		return fileState{}, err
+	}
+
+	return fileState{
+		modTime: info.ModTime().UnixNano(),
+		size:    info.Size(),
+		hash:    sha256.Sum256(b),
+	}, nil
+}
+
+// pollFiles checks a list of files for changes every poll interval and calls a function with all files changed since the last check.
+// Symlinks are followed, so files replaced by renaming or swapping a symlink (i.e. Kubernetes volumes) are picked up as well.
+// It returns a function for stopping the poll that returns once the poll is stopped.
+func (c *controller) pollFiles(paths []string, changed func(paths []string)) func() {
+	states := make(map[string]fileState, len(paths))
+	for _, path := range paths {
+		// A file that cannot be read initially is considered changed once it can be read
+		states[path], _ = c.getFileState(path)
+	}
+
+	c.log(2, "polling %d files every %s", len(paths), c.pollInterval)
+
+	ticker := time.NewTicker(c.pollInterval)
+	stopping := make(chan struct{})
+	done := make(chan struct{})
+
+	// Changes to a file written in several chunks are applied once
+	deb := newDebouncer(c.debounce)
+
+	go func() {
+		defer close(done)
+		defer ticker.Stop()
+		defer deb.stop()
+
+		for {
+			select {
+			case <-deb.C():
+				if paths := deb.due(); len(paths) > 0 {
+					changed(paths)
+				}
+			case <-ticker.C:
+				changedPaths := []string{}
+				for _, path := range paths {
+					// A deleted file has the zero state, so it is changed once it is deleted and once it is created again
+					state, err := c.getFileState(path)
+					if err != nil && !errors.Is(err, os.ErrNotExist) {
+						c.log(5, "cannot poll file %s: %s", path, err)
+						continue
+					}
+
+					if state != states[path] {
+						states[path] = state
+						changedPaths = append(changedPaths, path)
+					}
+				}
+
+				if len(changedPaths) > 0 {
+					c.log(3, "polled %d changed files", len(changedPaths))
+					if changedPaths = deb.add(changedPaths); len(changedPaths) > 0 {
+						changed(changedPaths)
+					}
+				}
+			case <-stopping:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(stopping)
+		<-done
+	}
+}
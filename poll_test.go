@@ -0,0 +1,177 @@
+package konfig
+
+import (
+	"crypto/sha256"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetFileState(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotest_")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	path := filepath.Join(dir, "token")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("secret"), 0644))
+	assert.NoError(t, os.Chtimes(path, modTime, modTime))
+
+	tests := []struct {
+		name          string
+		path          string
+		expectedState fileState
+		expectedError bool
+	}{
+		{
+			name: "Exists",
+			path: path,
+			expectedState: fileState{
+				modTime: modTime.UnixNano(),
+				size:    6,
+				hash:    sha256.Sum256([]byte("secret")),
+			},
+		},
+		{
+			name:          "NotExists",
+			path:          filepath.Join(dir, "missing"),
+			expectedState: fileState{},
+			expectedError: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &controller{}
+			state, err := c.getFileState(tc.path)
+
+			assert.Equal(t, tc.expectedState, state)
+			assert.Equal(t, tc.expectedError, err != nil)
+		})
+	}
+}
+
+func TestPollFiles(t *testing.T) {
+	tests := []struct {
+		name            string
+		setup           func(t *testing.T, dir string) string
+		update          func(t *testing.T, dir string)
+		expectedChanged bool
+	}{
+		{
+			name: "NoChange",
+			setup: func(t *testing.T, dir string) string {
+				path := filepath.Join(dir, "token")
+				assert.NoError(t, ioutil.WriteFile(path, []byte("old-token"), 0644))
+				return path
+			},
+			update:          func(t *testing.T, dir string) {},
+			expectedChanged: false,
+		},
+		{
+			name: "Write",
+			setup: func(t *testing.T, dir string) string {
+				path := filepath.Join(dir, "token")
+				assert.NoError(t, ioutil.WriteFile(path, []byte("old-token"), 0644))
+				return path
+			},
+			update: func(t *testing.T, dir string) {
+				assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "token"), []byte("new-token"), 0644))
+			},
+			expectedChanged: true,
+		},
+		{
+			name: "SameSizeAndModTime",
+			setup: func(t *testing.T, dir string) string {
+				path := filepath.Join(dir, "token")
+				assert.NoError(t, ioutil.WriteFile(path, []byte("old-token"), 0644))
+				modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+				assert.NoError(t, os.Chtimes(path, modTime, modTime))
+				return path
+			},
+			update: func(t *testing.T, dir string) {
+				path := filepath.Join(dir, "token")
+				assert.NoError(t, ioutil.WriteFile(path, []byte("new-token"), 0644))
+				modTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+				assert.NoError(t, os.Chtimes(path, modTime, modTime))
+			},
+			expectedChanged: true,
+		},
+		{
+			name: "SymlinkSwap",
+			setup: func(t *testing.T, dir string) string {
+				writeAtomicDir(t, dir, "2020_01_01", map[string]string{"token": "old-token"})
+				return filepath.Join(dir, "token")
+			},
+			update: func(t *testing.T, dir string) {
+				writeAtomicDir(t, dir, "2020_01_02", map[string]string{"token": "new-token"})
+			},
+			expectedChanged: true,
+		},
+		{
+			name: "NotCreated",
+			setup: func(t *testing.T, dir string) string {
+				return filepath.Join(dir, "token")
+			},
+			update:          func(t *testing.T, dir string) {},
+			expectedChanged: false,
+		},
+		{
+			name: "Created",
+			setup: func(t *testing.T, dir string) string {
+				return filepath.Join(dir, "token")
+			},
+			update: func(t *testing.T, dir string) {
+				assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "token"), []byte("new-token"), 0644))
+			},
+			expectedChanged: true,
+		},
+		{
+			name: "Removed",
+			setup: func(t *testing.T, dir string) string {
+				path := filepath.Join(dir, "token")
+				assert.NoError(t, ioutil.WriteFile(path, []byte("old-token"), 0644))
+				return path
+			},
+			update: func(t *testing.T, dir string) {
+				assert.NoError(t, os.Remove(filepath.Join(dir, "token")))
+			},
+			expectedChanged: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "gotest_")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			path := tc.setup(t, dir)
+
+			changed := make(chan []string, 10)
+			c := &controller{
+				pollInterval: 20 * time.Millisecond,
+			}
+
+			stop := c.pollFiles([]string{path}, func(paths []string) {
+				changed <- paths
+			})
+			defer stop()
+
+			tc.update(t, dir)
+
+			select {
+			case paths := <-changed:
+				assert.True(t, tc.expectedChanged, "unexpected change")
+				assert.Equal(t, []string{path}, paths)
+			case <-time.After(200 * time.Millisecond):
+				assert.False(t, tc.expectedChanged, "timed out waiting for change")
+			}
+		})
+	}
+}
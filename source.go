@@ -0,0 +1,244 @@
+package konfig
+
+import (
+	"path/filepath"
+	"reflect"
+	"sync"
+)
+
+// Field has the information about a struct field for reading its value from a source.
+type Field struct {
+	// Name is the name of the field.
+	// For a field in a nested struct, it is the path to the field separated by dots (i.e. Database.Pool.Size).
+	Name string
+	// FlagName is the name of command-line flag for the field or - if the flag is skipped.
+	FlagName string
+	// EnvName is the name of environment variable for the field or - if the environment variable is skipped.
+	EnvName string
+	// FileEnvName is the name of file environment variable for the field or - if the file environment variable is skipped.
+	FileEnvName string
+	// ListSep is the list separator for the field if the field has a slice or map type.
+	ListSep string
+	// KVSep is the key/value separator for the field if the field has a map type.
+	KVSep string
+	// Trim is how values read from files are trimmed for the field.
+	Trim TrimMode
+	// Secret determines whether or not the field is a secret, so its values should not be logged.
+	Secret bool
+	// Tag is the struct tag of the field, so custom sources can define their own struct tags.
+	Tag reflect.StructTag
+}
+
+// Source is a backend for reading configuration values.
+type Source interface {
+	// Name returns a short name for the source that is used in errors and logs.
+	// The name should be unique among all sources.
+	Name() string
+	// Lookup reads the value of a field.
+	// It returns the value and the key (i.e. an environment variable name or a file path) the value is looked up by.
+	// An empty value means the source does not have any value for the field.
+	Lookup(f Field) (string, string)
+}
+
+// WatchableSource is a Source that can also notify about changes to its values.
+type WatchableSource interface {
+	Source
+	// Watch watches the values for a list of keys previously returned by Lookup.
+	// notify should be called with the keys whenever the values for those keys change.
+	// Keys notified together are applied as one batch of changes.
+	// The returned function should stop watching.
+	Watch(keys []string, notify func(keys ...string)) (func(), error)
+}
+
+var (
+	// FlagSource is the built-in source for reading values from command-line flags.
+	FlagSource Source = &flagSource{}
+
+	// EnvSource is the built-in source for reading values from environment variables.
+	EnvSource Source = &envSource{}
+
+	// FileEnvSource is the built-in source for reading values from files specified by file environment variables.
+	FileEnvSource Source = &fileEnvSource{}
+)
+
+type flagSource struct {
+	c *controller
+}
+
+func (s *flagSource) Name() string {
+	return sourceFlag
+}
+
+func (s *flagSource) Lookup(f Field) (string, string) {
+	if f.FlagName == skip || s.c.skipFlag {
+		return "", ""
+	}
+
+	return getFlagValue(s.c.getArgs(), f.FlagName), f.FlagName
+}
+
+type envSource struct {
+	c *controller
+}
+
+func (s *envSource) Name() string {
+	return sourceEnv
+}
+
+func (s *envSource) Lookup(f Field) (string, string) {
+	if f.EnvName == skip || s.c.skipEnv {
+		return "", ""
+	}
+
+	return s.c.getEnv(f.EnvName), f.EnvName
+}
+
+type fileEnvSource struct {
+	c *controller
+}
+
+func (s *fileEnvSource) Name() string {
+	return sourceFile
+}
+
+func (s *fileEnvSource) Lookup(f Field) (string, string) {
+	filePath := s.c.getFilePath(f)
+	if filePath == "" {
+		return "", ""
+	}
+
+	// Read config file
+	b, err := s.c.getFS().ReadFile(filePath)
+	if err != nil {
+		return "", filePath
+	}
+
+	return f.Trim.trim(string(b)), filePath
+}
+
+// getFilePath returns the path to the file specified by the file environment variable of a field.
+// It returns an empty string if no file is specified.
+func (c *controller) getFilePath(f Field) string {
+	if f.FileEnvName == skip || c.skipFileEnv {
+		return ""
+	}
+
+	// Read file environment variable
+	filePath := c.getEnv(f.FileEnvName)
+	c.log(5, "[%s] value read from file environment variable %s: %s", f.Name, f.FileEnvName, filePath)
+
+	if filePath == "" {
+		return ""
+	}
+
+	// Check for Telepresence
+	// See https://telepresence.io/howto/volumes.html for details
+	if c.telepresence {
+		if mountPath := c.getEnv(envTelepresenceRoot); mountPath != "" {
+			filePath = filepath.Join(mountPath, filePath)
+			c.log(5, "[%s] telepresence mount path: %s", f.Name, mountPath)
+		}
+	}
+
+	return filePath
+}
+
+// getSources returns the list of sources in the order of precedence with the built-in sources bound to the controller.
+// If no built-in source is specified using the Sources option, the custom sources will come after the built-in ones.
+func (c *controller) getSources() []Source {
+	builtin := false
+	sources := make([]Source, 0, len(c.sources)+4)
+
+	for _, src := range c.sources {
+		switch src.(type) {
+		case *flagSource:
+			builtin = true
+			sources = append(sources, &flagSource{c: c})
+		case *envSource:
+			builtin = true
+			sources = append(sources, &envSource{c: c})
+		case *fileEnvSource:
+			builtin = true
+			sources = append(sources, &fileEnvSource{c: c})
+		case *configFileSource:
+			builtin = true
+			sources = append(sources, &configFileSource{c: c})
+		default:
+			sources = append(sources, src)
+		}
+	}
+
+	if !builtin {
+		sources = append([]Source{
+			&flagSource{c: c},
+			&envSource{c: c},
+			&fileEnvSource{c: c},
+			&configFileSource{c: c},
+		}, sources...)
+	}
+
+	return sources
+}
+
+// batchSource is implemented by built-in sources that need to know whether the values of a batch of keys are applied or rolled back.
+type batchSource interface {
+	watch(keys []string, apply func(keys ...string) error) (func(), error)
+}
+
+// watchSources watches the values of fields read from custom sources that support watching.
+// It returns a function for stopping all watches.
+func (c *controller) watchSources(config sync.Locker) (func(), error) {
+	stops := []func(){}
+	stopAll := func() {
+		for _, stop := range stops {
+			stop()
+		}
+	}
+
+	for _, src := range c.getSources() {
+		ws, ok := src.(WatchableSource)
+		if !ok {
+			continue
+		}
+
+		keysToFields := c.sourceKeysToFields[src.Name()]
+		if len(keysToFields) == 0 {
+			continue
+		}
+
+		keys := make([]string, 0, len(keysToFields))
+		for key := range keysToFields {
+			keys = append(keys, key)
+		}
+
+		apply := func(keys ...string) error {
+			fields := []fieldInfo{}
+			for _, key := range keys {
+				fields = append(fields, keysToFields[key]...)
+			}
+			// A key removed from a source has no value anymore, so its fields fall back to values from other sources or their default values,
+			// the same as when a file is deleted
+			return c.reloadFields(config, fields, true)
+		}
+
+		var stop func()
+		var err error
+		if bs, ok := src.(batchSource); ok {
+			stop, err = bs.watch(keys, apply)
+		} else {
+			stop, err = ws.Watch(keys, func(keys ...string) {
+				apply(keys...)
+			})
+		}
+
+		if err != nil {
+			c.log(1, "cannot watch source %s: %s", src.Name(), err)
+			stopAll()
+			return nil, err
+		}
+
+		stops = append(stops, stop)
+	}
+
+	return stopAll, nil
+}
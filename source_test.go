@@ -0,0 +1,496 @@
+package konfig
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockSource struct {
+	sync.Mutex
+	name   string
+	values map[string]string
+}
+
+func (s *mockSource) Name() string {
+	return s.name
+}
+
+func (s *mockSource) Lookup(f Field) (string, string) {
+	s.Lock()
+	defer s.Unlock()
+
+	key := f.Name
+	if k := f.Tag.Get("store"); k != "" {
+		key = k
+	}
+
+	return s.values[key], key
+}
+
+func (s *mockSource) set(key, value string) {
+	s.Lock()
+	defer s.Unlock()
+	s.values[key] = value
+}
+
+type mockWatchableSource struct {
+	mockSource
+	WatchError  error
+	WatchedKeys []string
+	Stopped     bool
+	notify      func(keys ...string)
+}
+
+func (s *mockWatchableSource) Watch(keys []string, notify func(keys ...string)) (func(), error) {
+	if s.WatchError != nil {
+		return nil, s.WatchError
+	}
+
+	s.WatchedKeys = keys
+	s.notify = notify
+
+	return func() {
+		s.Stopped = true
+	}, nil
+}
+
+func TestFlagSource(t *testing.T) {
+	tests := []struct {
+		name          string
+		args          []string
+		c             *controller
+		f             Field
+		expectedValue string
+		expectedKey   string
+	}{
+		{
+			"Skipped",
+			[]string{"/path/to/executable", "-log.level=debug"},
+			&controller{},
+			Field{Name: "LogLevel", FlagName: "-"},
+			"", "",
+		},
+		{
+			"SkipFlagOption",
+			[]string{"/path/to/executable", "-log.level=debug"},
+			&controller{skipFlag: true},
+			Field{Name: "LogLevel", FlagName: "log.level"},
+			"", "",
+		},
+		{
+			"NoValue",
+			[]string{"/path/to/executable"},
+			&controller{},
+			Field{Name: "LogLevel", FlagName: "log.level"},
+			"", "log.level",
+		},
+		{
+			"WithValue",
+			[]string{"/path/to/executable", "-log.level=debug"},
+			&controller{},
+			Field{Name: "LogLevel", FlagName: "log.level"},
+			"debug", "log.level",
+		},
+	}
+
+	origArgs := os.Args
+	defer func() {
+		os.Args = origArgs
+	}()
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			os.Args = tc.args
+
+			src := &flagSource{c: tc.c}
+			value, key := src.Lookup(tc.f)
+
+			assert.Equal(t, "flag", src.Name())
+			assert.Equal(t, tc.expectedValue, value)
+			assert.Equal(t, tc.expectedKey, key)
+		})
+	}
+}
+
+func TestEnvSource(t *testing.T) {
+	tests := []struct {
+		name          string
+		env           map[string]string
+		c             *controller
+		f             Field
+		expectedValue string
+		expectedKey   string
+	}{
+		{
+			"Skipped",
+			map[string]string{"LOG_LEVEL": "info"},
+			&controller{},
+			Field{Name: "LogLevel", EnvName: "-"},
+			"", "",
+		},
+		{
+			"SkipEnvOption",
+			map[string]string{"LOG_LEVEL": "info"},
+			&controller{skipEnv: true},
+			Field{Name: "LogLevel", EnvName: "LOG_LEVEL"},
+			"", "",
+		},
+		{
+			"NoValue",
+			map[string]string{},
+			&controller{},
+			Field{Name: "LogLevel", EnvName: "LOG_LEVEL"},
+			"", "LOG_LEVEL",
+		},
+		{
+			"WithValue",
+			map[string]string{"LOG_LEVEL": "info"},
+			&controller{},
+			Field{Name: "LogLevel", EnvName: "LOG_LEVEL"},
+			"info", "LOG_LEVEL",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for name, value := range tc.env {
+				err := os.Setenv(name, value)
+				assert.NoError(t, err)
+				defer os.Unsetenv(name)
+			}
+
+			src := &envSource{c: tc.c}
+			value, key := src.Lookup(tc.f)
+
+			assert.Equal(t, "env", src.Name())
+			assert.Equal(t, tc.expectedValue, value)
+			assert.Equal(t, tc.expectedKey, key)
+		})
+	}
+}
+
+func TestFileEnvSource(t *testing.T) {
+	tmpfile, err := ioutil.TempFile("", "gotest_")
+	assert.NoError(t, err)
+	defer os.Remove(tmpfile.Name())
+
+	_, err = tmpfile.WriteString("error")
+	assert.NoError(t, err)
+
+	err = tmpfile.Close()
+	assert.NoError(t, err)
+
+	// The file is created by echo
+	echofile, err := ioutil.TempFile("", "gotest_")
+	assert.NoError(t, err)
+	defer os.Remove(echofile.Name())
+
+	_, err = echofile.WriteString(" error \n")
+	assert.NoError(t, err)
+
+	err = echofile.Close()
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name          string
+		env           map[string]string
+		c             *controller
+		f             Field
+		expectedValue string
+		expectedKey   string
+	}{
+		{
+			"Skipped",
+			map[string]string{"LOG_LEVEL_FILE": tmpfile.Name()},
+			&controller{},
+			Field{Name: "LogLevel", FileEnvName: "-"},
+			"", "",
+		},
+		{
+			"SkipFileEnvOption",
+			map[string]string{"LOG_LEVEL_FILE": tmpfile.Name()},
+			&controller{skipFileEnv: true},
+			Field{Name: "LogLevel", FileEnvName: "LOG_LEVEL_FILE"},
+			"", "",
+		},
+		{
+			"NoFileEnv",
+			map[string]string{},
+			&controller{},
+			Field{Name: "LogLevel", FileEnvName: "LOG_LEVEL_FILE"},
+			"", "",
+		},
+		{
+			"NoFile",
+			map[string]string{"LOG_LEVEL_FILE": "/path/to/missing/file"},
+			&controller{},
+			Field{Name: "LogLevel", FileEnvName: "LOG_LEVEL_FILE"},
+			"", "/path/to/missing/file",
+		},
+		{
+			"WithValue",
+			map[string]string{"LOG_LEVEL_FILE": tmpfile.Name()},
+			&controller{},
+			Field{Name: "LogLevel", FileEnvName: "LOG_LEVEL_FILE"},
+			"error", tmpfile.Name(),
+		},
+		{
+			"WithTelepresenceOption",
+			map[string]string{"LOG_LEVEL_FILE": tmpfile.Name(), envTelepresenceRoot: "/"},
+			&controller{telepresence: true},
+			Field{Name: "LogLevel", FileEnvName: "LOG_LEVEL_FILE"},
+			"error", tmpfile.Name(),
+		},
+		{
+			"WithNewline",
+			map[string]string{"LOG_LEVEL_FILE": echofile.Name()},
+			&controller{},
+			Field{Name: "LogLevel", FileEnvName: "LOG_LEVEL_FILE"},
+			" error ", echofile.Name(),
+		},
+		{
+			"WithTrimNone",
+			map[string]string{"LOG_LEVEL_FILE": echofile.Name()},
+			&controller{},
+			Field{Name: "LogLevel", FileEnvName: "LOG_LEVEL_FILE", Trim: TrimNone},
+			" error \n", echofile.Name(),
+		},
+		{
+			"WithTrimSpace",
+			map[string]string{"LOG_LEVEL_FILE": echofile.Name()},
+			&controller{},
+			Field{Name: "LogLevel", FileEnvName: "LOG_LEVEL_FILE", Trim: TrimSpace},
+			"error", echofile.Name(),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for name, value := range tc.env {
+				err := os.Setenv(name, value)
+				assert.NoError(t, err)
+				defer os.Unsetenv(name)
+			}
+
+			src := &fileEnvSource{c: tc.c}
+			value, key := src.Lookup(tc.f)
+
+			assert.Equal(t, "file", src.Name())
+			assert.Equal(t, tc.expectedValue, value)
+			assert.Equal(t, tc.expectedKey, key)
+		})
+	}
+}
+
+func TestSources(t *testing.T) {
+	vault := &mockSource{name: "vault"}
+
+	tests := []struct {
+		c        *controller
+		sources  []Source
+		expected *controller
+	}{
+		{
+			&controller{},
+			[]Source{vault},
+			&controller{
+				sources: []Source{vault},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		opt := Sources(tc.sources...)
+		opt(tc.c)
+
+		assert.Equal(t, tc.expected, tc.c)
+	}
+}
+
+func TestGetSources(t *testing.T) {
+	vault := &mockSource{name: "vault"}
+	consul := &mockSource{name: "consul"}
+
+	tests := []struct {
+		name          string
+		sources       []Source
+		expectedNames []string
+	}{
+		{
+			"Default",
+			nil,
+			[]string{"flag", "env", "file", "config"},
+		},
+		{
+			"CustomSources",
+			[]Source{vault, consul},
+			[]string{"flag", "env", "file", "config", "vault", "consul"},
+		},
+		{
+			"WithPrecedence",
+			[]Source{FlagSource, vault, EnvSource, FileEnvSource, ConfigFileSource},
+			[]string{"flag", "vault", "env", "file", "config"},
+		},
+		{
+			"WithoutSomeBuiltinSources",
+			[]Source{EnvSource, vault},
+			[]string{"env", "vault"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			c := &controller{
+				sources: tc.sources,
+			}
+
+			names := []string{}
+			for _, src := range c.getSources() {
+				names = append(names, src.Name())
+
+				// Built-in sources should be bound to the controller
+				switch s := src.(type) {
+				case *flagSource:
+					assert.Equal(t, c, s.c)
+				case *envSource:
+					assert.Equal(t, c, s.c)
+				case *fileEnvSource:
+					assert.Equal(t, c, s.c)
+				case *configFileSource:
+					assert.Equal(t, c, s.c)
+				}
+			}
+
+			assert.Equal(t, tc.expectedNames, names)
+		})
+	}
+}
+
+func TestWatchSources(t *testing.T) {
+	tests := []struct {
+		name          string
+		src           *mockWatchableSource
+		expectedError error
+		expectedKeys  []string
+	}{
+		{
+			"WatchError",
+			&mockWatchableSource{
+				mockSource: mockSource{
+					name:   "vault",
+					values: map[string]string{"FieldString": "content"},
+				},
+				WatchError: errors.New("watch error"),
+			},
+			errors.New("watch error"),
+			nil,
+		},
+		{
+			"Success",
+			&mockWatchableSource{
+				mockSource: mockSource{
+					name:   "vault",
+					values: map[string]string{"FieldString": "content"},
+				},
+			},
+			nil,
+			[]string{"FieldString"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &config{}
+			c := &controller{
+				listSep:            ",",
+				skipFlag:           true,
+				skipEnv:            true,
+				skipFileEnv:        true,
+				sources:            []Source{tc.src},
+				filesToFields:      map[string][]fieldInfo{},
+				sourceKeysToFields: map[string]map[string][]fieldInfo{},
+			}
+
+			vStruct, err := validateStruct(cfg)
+			assert.NoError(t, err)
+
+			err = c.readFields(vStruct)
+			assert.NoError(t, err)
+			assert.Equal(t, "content", cfg.FieldString)
+
+			stop, err := c.watchSources(cfg)
+
+			if tc.expectedError != nil {
+				assert.Equal(t, tc.expectedError, err)
+				assert.Nil(t, stop)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.expectedKeys, tc.src.WatchedKeys)
+
+				// Change the value and notify
+				tc.src.set("FieldString", "new_content")
+				tc.src.notify("FieldString")
+
+				cfg.Lock()
+				assert.Equal(t, "new_content", cfg.FieldString)
+				cfg.Unlock()
+
+				stop()
+				assert.True(t, tc.src.Stopped)
+			}
+		})
+	}
+}
+
+func TestWatchSourcesSharedKey(t *testing.T) {
+	cfg := &struct {
+		sync.Mutex
+		APIKey    string `store:"api-key"`
+		ClientKey string `store:"api-key"`
+	}{}
+
+	src := &mockWatchableSource{
+		mockSource: mockSource{
+			name:   "vault",
+			values: map[string]string{"api-key": "secret"},
+		},
+	}
+
+	c := &controller{
+		listSep:            ",",
+		skipFlag:           true,
+		skipEnv:            true,
+		skipFileEnv:        true,
+		sources:            []Source{src},
+		filesToFields:      map[string][]fieldInfo{},
+		sourceKeysToFields: map[string]map[string][]fieldInfo{},
+	}
+
+	vStruct, err := validateStruct(cfg)
+	assert.NoError(t, err)
+
+	err = c.readFields(vStruct)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", cfg.APIKey)
+	assert.Equal(t, "secret", cfg.ClientKey)
+
+	stop, err := c.watchSources(cfg)
+	assert.NoError(t, err)
+	defer stop()
+
+	assert.Equal(t, []string{"api-key"}, src.WatchedKeys)
+
+	// Both fields are read from the same key, so both are updated
+	src.set("api-key", "new_secret")
+	src.notify("api-key")
+
+	cfg.Lock()
+	assert.Equal(t, "new_secret", cfg.APIKey)
+	assert.Equal(t, "new_secret", cfg.ClientKey)
+	cfg.Unlock()
+}
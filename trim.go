@@ -0,0 +1,57 @@
+package konfig
+
+import "strings"
+
+// TrimMode determines how values read from files are trimmed.
+// Files created by tools like echo or editors usually end with a newline that is not a part of the value.
+type TrimMode int
+
+const (
+	// TrimNewline removes trailing newlines (\n and \r\n) from values read from files.
+	// This is the default mode.
+	TrimNewline TrimMode = iota + 1
+	// TrimNone keeps values read from files as they are.
+	TrimNone
+	// TrimSpace removes all leading and trailing white spaces from values read from files.
+	TrimSpace
+)
+
+func (m TrimMode) String() string {
+	switch m {
+	case TrimNewline:
+		return "newline"
+	case TrimNone:
+		return "none"
+	case TrimSpace:
+		return "space"
+	default:
+		return "unknown"
+	}
+}
+
+// parseTrimMode parses a trim mode from its name.
+func parseTrimMode(s string) (TrimMode, bool) {
+	switch s {
+	case "newline":
+		return TrimNewline, true
+	case "none":
+		return TrimNone, true
+	case "space":
+		return TrimSpace, true
+	default:
+		return 0, false
+	}
+}
+
+// trim trims a value read from a file.
+// If no mode is specified, trailing newlines are removed.
+func (m TrimMode) trim(val string) string {
+	switch m {
+	case TrimNone:
+		return val
+	case TrimSpace:
+		return strings.TrimSpace(val)
+	default:
+		return strings.TrimRight(val, "\r\n")
+	}
+}
@@ -0,0 +1,55 @@
+package konfig
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrimMode(t *testing.T) {
+	tests := []struct {
+		name           string
+		str            string
+		expectedMode   TrimMode
+		expectedOK     bool
+		expectedString string
+	}{
+		{"Newline", "newline", TrimNewline, true, "newline"},
+		{"None", "none", TrimNone, true, "none"},
+		{"Space", "space", TrimSpace, true, "space"},
+		{"Unknown", "all", 0, false, "unknown"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			mode, ok := parseTrimMode(tc.str)
+
+			assert.Equal(t, tc.expectedMode, mode)
+			assert.Equal(t, tc.expectedOK, ok)
+			assert.Equal(t, tc.expectedString, mode.String())
+		})
+	}
+}
+
+func TestTrimModeTrim(t *testing.T) {
+	tests := []struct {
+		name     string
+		mode     TrimMode
+		val      string
+		expected string
+	}{
+		{"Default", 0, " secret \n\n", " secret "},
+		{"DefaultCRLF", 0, "secret\r\n", "secret"},
+		{"Newline", TrimNewline, "secret\n", "secret"},
+		{"NewlineOnly", TrimNewline, "\n", ""},
+		{"NewlineInside", TrimNewline, "line1\nline2\n", "line1\nline2"},
+		{"None", TrimNone, " secret \n", " secret \n"},
+		{"Space", TrimSpace, "\t secret \n", "secret"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.mode.trim(tc.val))
+		})
+	}
+}
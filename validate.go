@@ -0,0 +1,187 @@
+package konfig
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	tagMin     = "min"
+	tagMax     = "max"
+	tagOneOf   = "oneof"
+	tagPattern = "pattern"
+)
+
+// validateConfig calls the Validate method of a struct if it implements Validator.
+func validateConfig(config interface{}) error {
+	if validator, ok := config.(Validator); ok {
+		return validator.Validate()
+	}
+
+	return nil
+}
+
+// validateField checks the value of a field against its validation struct tags.
+//   `min:"..."`      the minimum value for numbers or the minimum length for strings, slices, and maps
+//   `max:"..."`      the maximum value for numbers or the maximum length for strings, slices, and maps
+//   `oneof:"..."`    a space-separated list of allowed values
+//   `pattern:"..."`  a regular expression that values should match
+// For slices and maps, oneof and pattern are checked against every element.
+// Values of secret fields are masked in validation errors.
+func validateField(name string, v reflect.Value, tag reflect.StructTag) (err error) {
+	defer func() {
+		if verr, ok := err.(*ValidationError); ok {
+			verr.Secret = hasOption(tag, optSecret)
+		}
+	}()
+
+	if bound, ok := tag.Lookup(tagMin); ok {
+		if err := checkBound(name, v, tagMin, bound); err != nil {
+			return err
+		}
+	}
+
+	if bound, ok := tag.Lookup(tagMax); ok {
+		if err := checkBound(name, v, tagMax, bound); err != nil {
+			return err
+		}
+	}
+
+	if list, ok := tag.Lookup(tagOneOf); ok {
+		options := strings.Fields(list)
+		for _, elem := range getElements(v) {
+			if str := fmt.Sprint(elem.Interface()); !containsString(options, str) {
+				return &ValidationError{
+					Field:   name,
+					Value:   elem.Interface(),
+					Tag:     tagOneOf,
+					Message: fmt.Sprintf("must be one of %s", strings.Join(options, ", ")),
+				}
+			}
+		}
+	}
+
+	if pattern, ok := tag.Lookup(tagPattern); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid %s tag %q for %s: %s", tagPattern, pattern, name, err)
+		}
+
+		for _, elem := range getElements(v) {
+			if str := fmt.Sprint(elem.Interface()); !re.MatchString(str) {
+				return &ValidationError{
+					Field:   name,
+					Value:   elem.Interface(),
+					Tag:     tagPattern,
+					Message: fmt.Sprintf("must match %s", pattern),
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkBound checks the value of a field against a min or max struct tag.
+func checkBound(name string, v reflect.Value, tag, bound string) error {
+	var less, greater bool
+	var unit string
+	var err error
+
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		if t := v.Type(); t.PkgPath() == "time" && t.Name() == "Duration" {
+			var d time.Duration
+			d, err = time.ParseDuration(bound)
+			i = int64(d)
+		} else {
+			i, err = strconv.ParseInt(bound, 10, 64)
+		}
+		less, greater = v.Int() < i, v.Int() > i
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		u, err = strconv.ParseUint(bound, 10, 64)
+		less, greater = v.Uint() < u, v.Uint() > u
+	case reflect.Float32, reflect.Float64:
+		var f float64
+		f, err = strconv.ParseFloat(bound, 64)
+		less, greater = v.Float() < f, v.Float() > f
+	case reflect.String:
+		var i int
+		i, err = strconv.Atoi(bound)
+		n := utf8.RuneCountInString(v.String())
+		less, greater = n < i, n > i
+		unit = " characters"
+	case reflect.Slice, reflect.Map:
+		var i int
+		i, err = strconv.Atoi(bound)
+		less, greater = v.Len() < i, v.Len() > i
+		unit = " elements"
+	default:
+		return fmt.Errorf("%s tag is not supported for %s of type %s", tag, name, v.Type())
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid %s tag %q for %s: %s", tag, bound, name, err)
+	}
+
+	if tag == tagMin && less {
+		return &ValidationError{
+			Field:   name,
+			Value:   v.Interface(),
+			Tag:     tagMin,
+			Message: fmt.Sprintf("must be at least %s%s", bound, unit),
+		}
+	}
+
+	if tag == tagMax && greater {
+		return &ValidationError{
+			Field:   name,
+			Value:   v.Interface(),
+			Tag:     tagMax,
+			Message: fmt.Sprintf("must be at most %s%s", bound, unit),
+		}
+	}
+
+	return nil
+}
+
+// getElements returns the elements of a slice, the values of a map sorted by keys, or the value itself.
+func getElements(v reflect.Value) []reflect.Value {
+	switch v.Kind() {
+	case reflect.Slice:
+		elems := make([]reflect.Value, v.Len())
+		for i := range elems {
+			elems[i] = v.Index(i)
+		}
+		return elems
+	case reflect.Map:
+		keys := v.MapKeys()
+		sort.Slice(keys, func(i, j int) bool {
+			return keys[i].String() < keys[j].String()
+		})
+		elems := make([]reflect.Value, len(keys))
+		for i, key := range keys {
+			elems[i] = v.MapIndex(key)
+		}
+		return elems
+	default:
+		return []reflect.Value{v}
+	}
+}
+
+func containsString(list []string, str string) bool {
+	for _, s := range list {
+		if s == str {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,167 @@
+package konfig
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateField(t *testing.T) {
+	tests := []struct {
+		name          string
+		value         interface{}
+		tag           reflect.StructTag
+		expectedError error
+	}{
+		{
+			"NoTag",
+			0,
+			``,
+			nil,
+		},
+		{
+			"MinInt",
+			10,
+			`min:"1" max:"100"`,
+			nil,
+		},
+		{
+			"LessThanMinInt",
+			0,
+			`min:"1" max:"100"`,
+			&ValidationError{Field: "Field", Value: 0, Tag: "min", Message: "must be at least 1"},
+		},
+		{
+			"GreaterThanMaxInt",
+			int8(101),
+			`min:"1" max:"100"`,
+			&ValidationError{Field: "Field", Value: int8(101), Tag: "max", Message: "must be at most 100"},
+		},
+		{
+			"MinMaxUint",
+			uint64(18446744073709551615),
+			`min:"0" max:"18446744073709551615"`,
+			nil,
+		},
+		{
+			"GreaterThanMaxUint",
+			uint(65536),
+			`max:"65535"`,
+			&ValidationError{Field: "Field", Value: uint(65536), Tag: "max", Message: "must be at most 65535"},
+		},
+		{
+			"LessThanMinFloat",
+			0.5,
+			`min:"0.75"`,
+			&ValidationError{Field: "Field", Value: 0.5, Tag: "min", Message: "must be at least 0.75"},
+		},
+		{
+			"LessThanMinDuration",
+			500 * time.Millisecond,
+			`min:"1s" max:"1m"`,
+			&ValidationError{Field: "Field", Value: 500 * time.Millisecond, Tag: "min", Message: "must be at least 1s"},
+		},
+		{
+			"MinStringLength",
+			"héllo",
+			`min:"5"`,
+			nil,
+		},
+		{
+			"GreaterThanMaxStringLength",
+			"hello world",
+			`max:"5"`,
+			&ValidationError{Field: "Field", Value: "hello world", Tag: "max", Message: "must be at most 5 characters"},
+		},
+		{
+			"LessThanMinSliceLength",
+			[]string{"url1"},
+			`min:"2"`,
+			&ValidationError{Field: "Field", Value: []string{"url1"}, Tag: "min", Message: "must be at least 2 elements"},
+		},
+		{
+			"GreaterThanMaxMapLength",
+			map[string]int{"a": 1, "b": 2},
+			`max:"1"`,
+			&ValidationError{Field: "Field", Value: map[string]int{"a": 1, "b": 2}, Tag: "max", Message: "must be at most 1 elements"},
+		},
+		{
+			"InvalidMinTag",
+			10,
+			`min:"one"`,
+			errors.New(`invalid min tag "one" for Field: strconv.ParseInt: parsing "one": invalid syntax`),
+		},
+		{
+			"UnsupportedMinTag",
+			true,
+			`min:"1"`,
+			errors.New("min tag is not supported for Field of type bool"),
+		},
+		{
+			"OneOf",
+			"info",
+			`oneof:"debug info warn error"`,
+			nil,
+		},
+		{
+			"NotOneOf",
+			"trace",
+			`oneof:"debug info warn error"`,
+			&ValidationError{Field: "Field", Value: "trace", Tag: "oneof", Message: "must be one of debug, info, warn, error"},
+		},
+		{
+			"OneOfInt",
+			8080,
+			`oneof:"80 443 8080"`,
+			nil,
+		},
+		{
+			"NotOneOfSliceElement",
+			[]string{"debug", "trace"},
+			`oneof:"debug info"`,
+			&ValidationError{Field: "Field", Value: "trace", Tag: "oneof", Message: "must be one of debug, info"},
+		},
+		{
+			"Pattern",
+			"milad",
+			`pattern:"^[a-z]+$"`,
+			nil,
+		},
+		{
+			"NotMatchingPattern",
+			"Milad",
+			`pattern:"^[a-z]+$"`,
+			&ValidationError{Field: "Field", Value: "Milad", Tag: "pattern", Message: "must match ^[a-z]+$"},
+		},
+		{
+			"NotMatchingPatternMapValue",
+			map[string]string{"env": "prod", "team": "Core"},
+			`pattern:"^[a-z]+$"`,
+			&ValidationError{Field: "Field", Value: "Core", Tag: "pattern", Message: "must match ^[a-z]+$"},
+		},
+		{
+			"InvalidPatternTag",
+			"milad",
+			`pattern:"["`,
+			errors.New("invalid pattern tag \"[\" for Field: error parsing regexp: missing closing ]: `[`"),
+		},
+		{
+			"SecretField",
+			"short",
+			`min:"8" secret:"true"`,
+			&ValidationError{Field: "Field", Value: "short", Tag: "min", Message: "must be at least 8 characters", Secret: true},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			v := reflect.ValueOf(tc.value)
+			err := validateField("Field", v, tc.tag)
+
+			assert.Equal(t, tc.expectedError, err)
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package konfig
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Value keeps an immutable snapshot of a configuration struct.
+// Whenever values change while watching, a new copy of the struct is populated and swapped in atomically,
+// so reading the configuration never blocks and never sees a partially updated struct.
+// Unlike Watch, the configuration struct does not need a sync.Mutex field.
+type Value[T any] struct {
+	snapshot atomic.Pointer[T]
+	loader   *Loader
+	once     sync.Once
+	stop     func()
+}
+
+// valueLocker is the sync.Locker for the working copy of the struct that new values are applied to.
+// Every time it is unlocked, a copy of the working copy is stored as the new snapshot.
+type valueLocker[T any] struct {
+	mu     sync.Mutex
+	config *T
+	value  *Value[T]
+}
+
+func (l *valueLocker[T]) Lock() {
+	l.mu.Lock()
+}
+
+func (l *valueLocker[T]) Unlock() {
+	// Fields are always replaced as a whole (i.e. slices and maps), so a shallow copy does not share anything that changes later
+	snapshot := *l.config
+	l.value.snapshot.Store(&snapshot)
+
+	l.mu.Unlock()
+}
+
+// Validate validates the working copy, since batches of new values are validated through the locker.
+func (l *valueLocker[T]) Validate() error {
+	return validateConfig(l.config)
+}
+
+// NewValue reads values for exported fields of a struct of type T the same way as Watch and keeps them in a Value.
+// The fields of the given struct are used as default values.
+// It then watches the same sources as Watch and swaps in a new snapshot every time values change.
+// Handlers registered by OnChange and OnAnyChange options and change set subscribers are notified after the new snapshot is swapped in,
+// including for values read initially.
+func NewValue[T any](config T, opts ...Option) (*Value[T], error) {
+	v := &Value[T]{
+		loader: New(opts...),
+	}
+
+	locker := &valueLocker[T]{
+		config: &config,
+		value:  v,
+	}
+
+	c, stop, err := v.loader.watch(&config, locker, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	v.stop = func() {
+		stop()
+		c.stopDispatchers()
+	}
+
+	return v, nil
+}
+
+// Load returns the current snapshot of the configuration.
+// The returned struct is shared between all readers and must not be modified.
+func (v *Value[T]) Load() *T {
+	return v.snapshot.Load()
+}
+
+// Reload reads the values of all fields again from all sources and swaps in a new snapshot (see Loader.Reload).
+// It returns once the new snapshot is swapped in.
+func (v *Value[T]) Reload() {
+	v.loader.Reload()
+}
+
+// Close stops watching for new values.
+// The last snapshot can still be loaded afterwards.
+func (v *Value[T]) Close() {
+	v.once.Do(v.stop)
+}
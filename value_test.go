@@ -0,0 +1,248 @@
+package konfig
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type valueConfig struct {
+	LogLevel string `oneof:"debug info warn error"`
+	MinConns int
+	MaxConns int
+}
+
+func (c *valueConfig) Validate() error {
+	if c.MaxConns < c.MinConns {
+		return errors.New("MaxConns must be at least MinConns")
+	}
+	return nil
+}
+
+func TestNewValue(t *testing.T) {
+	tests := []struct {
+		name           string
+		config         valueConfig
+		env            map[string]string
+		expectedError  error
+		expectedConfig *valueConfig
+	}{
+		{
+			name:           "Defaults",
+			config:         valueConfig{LogLevel: "info", MinConns: 1, MaxConns: 10},
+			env:            map[string]string{},
+			expectedConfig: &valueConfig{LogLevel: "info", MinConns: 1, MaxConns: 10},
+		},
+		{
+			name:           "FromEnv",
+			config:         valueConfig{LogLevel: "info", MinConns: 1, MaxConns: 10},
+			env:            map[string]string{"LOG_LEVEL": "debug", "MAX_CONNS": "20"},
+			expectedConfig: &valueConfig{LogLevel: "debug", MinConns: 1, MaxConns: 20},
+		},
+		{
+			name:          "InvalidValue",
+			config:        valueConfig{LogLevel: "info", MinConns: 1, MaxConns: 10},
+			env:           map[string]string{"LOG_LEVEL": "trace"},
+			expectedError: Errors{&ValidationError{Field: "LogLevel", Value: "trace", Tag: "oneof", Message: "must be one of debug, info, warn, error"}},
+		},
+		{
+			name:          "FailedValidator",
+			config:        valueConfig{LogLevel: "info", MinConns: 1, MaxConns: 10},
+			env:           map[string]string{"MIN_CONNS": "20"},
+			expectedError: errors.New("MaxConns must be at least MinConns"),
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := NewValue(tc.config,
+				Args([]string{}),
+				LookupEnv(func(name string) (string, bool) {
+					val, ok := tc.env[name]
+					return val, ok
+				}),
+				FlagSet(flag.NewFlagSet("app", flag.ContinueOnError)),
+			)
+
+			if tc.expectedError != nil {
+				assert.Equal(t, tc.expectedError, err)
+				assert.Nil(t, v)
+				return
+			}
+
+			assert.NoError(t, err)
+			defer v.Close()
+
+			assert.Equal(t, tc.expectedConfig, v.Load())
+		})
+	}
+}
+
+// eventLocker records when it is unlocked.
+type eventLocker struct {
+	sync.Mutex
+	events *[]string
+}
+
+func (l *eventLocker) Unlock() {
+	*l.events = append(*l.events, "unlock")
+	l.Mutex.Unlock()
+}
+
+func TestNewValueInitialHandlers(t *testing.T) {
+	events := []string{}
+	config := valueConfig{LogLevel: "info", MinConns: 1, MaxConns: 10}
+	locker := &eventLocker{events: &events}
+
+	c, stop, err := New(
+		Args([]string{}),
+		LookupEnv(func(name string) (string, bool) {
+			if name == "LOG_LEVEL" {
+				return "debug", true
+			}
+			return "", false
+		}),
+		FlagSet(flag.NewFlagSet("app", flag.ContinueOnError)),
+		OnAnyChange(func(update Update) {
+			events = append(events, "handler:"+update.Name)
+		}),
+	).watch(&config, locker, nil)
+
+	assert.NoError(t, err)
+	defer c.stopDispatchers()
+	defer stop()
+
+	// The locker is unlocked before handlers are called for values read initially, so Value stores its first snapshot before they can call Load
+	assert.Equal(t, []string{"unlock", "handler:LogLevel"}, events)
+}
+
+func TestNewValueNonStruct(t *testing.T) {
+	v, err := NewValue(27)
+
+	assert.EqualError(t, err, "a non-struct type is passed")
+	assert.Nil(t, v)
+}
+
+func TestValueWatch(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotest_")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "max_conns")
+	err = ioutil.WriteFile(path, []byte("10"), 0644)
+	assert.NoError(t, err)
+
+	env := map[string]string{
+		"MAX_CONNS_FILE": path,
+	}
+
+	changeSets := make(chan ChangeSet, 10)
+
+	v, err := NewValue(valueConfig{LogLevel: "info", MinConns: 5},
+		Args([]string{}),
+		LookupEnv(func(name string) (string, bool) {
+			val, ok := env[name]
+			return val, ok
+		}),
+		FlagSet(flag.NewFlagSet("app", flag.ContinueOnError)),
+		ChangeSets(changeSets),
+	)
+
+	assert.NoError(t, err)
+	defer v.Close()
+
+	initial := v.Load()
+	assert.Equal(t, &valueConfig{LogLevel: "info", MinConns: 5, MaxConns: 10}, initial)
+
+	// Readers load snapshots without blocking while values are changing
+	stopReading := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stopReading:
+					return
+				default:
+					config := v.Load()
+					assert.True(t, config.MaxConns >= config.MinConns)
+				}
+			}
+		}()
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	err = ioutil.WriteFile(path, []byte("20"), 0644)
+	assert.NoError(t, err)
+
+	select {
+	case <-changeSets:
+		// The new snapshot is swapped in before change set subscribers are notified
+		assert.Equal(t, &valueConfig{LogLevel: "info", MinConns: 5, MaxConns: 20}, v.Load())
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for change set")
+	}
+
+	// A batch failing the validation is rolled back
+	err = ioutil.WriteFile(path, []byte("1"), 0644)
+	assert.NoError(t, err)
+	time.Sleep(200 * time.Millisecond)
+
+	close(stopReading)
+	wg.Wait()
+
+	assert.Equal(t, &valueConfig{LogLevel: "info", MinConns: 5, MaxConns: 20}, v.Load())
+
+	// Previous snapshots never change
+	assert.Equal(t, &valueConfig{LogLevel: "info", MinConns: 5, MaxConns: 10}, initial)
+
+	v.Close()
+	assert.Equal(t, &valueConfig{LogLevel: "info", MinConns: 5, MaxConns: 20}, v.Load())
+}
+
+func TestValueReload(t *testing.T) {
+	var mu sync.Mutex
+	env := map[string]string{"LOG_LEVEL": "info"}
+
+	v, err := NewValue(valueConfig{MinConns: 1, MaxConns: 10},
+		Args([]string{}),
+		LookupEnv(func(name string) (string, bool) {
+			mu.Lock()
+			defer mu.Unlock()
+			val, ok := env[name]
+			return val, ok
+		}),
+		FlagSet(flag.NewFlagSet("app", flag.ContinueOnError)),
+	)
+
+	assert.NoError(t, err)
+	defer v.Close()
+
+	assert.Equal(t, &valueConfig{LogLevel: "info", MinConns: 1, MaxConns: 10}, v.Load())
+
+	mu.Lock()
+	env = map[string]string{"LOG_LEVEL": "debug", "MAX_CONNS": "20"}
+	mu.Unlock()
+
+	v.Reload()
+	assert.Equal(t, &valueConfig{LogLevel: "debug", MinConns: 1, MaxConns: 20}, v.Load())
+
+	// A stopped value is not reloaded anymore
+	v.Close()
+
+	mu.Lock()
+	env = map[string]string{"LOG_LEVEL": "warn"}
+	mu.Unlock()
+
+	v.Reload()
+	assert.Equal(t, &valueConfig{LogLevel: "debug", MinConns: 1, MaxConns: 20}, v.Load())
+}
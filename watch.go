@@ -0,0 +1,354 @@
+package konfig
+
+import (
+	"crypto/sha256"
+	"errors"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchFiles watches the files that values of fields are read from and updates the fields whenever the files change.
+// Files are watched using file system notifications unless polling is specified by Polling or PollingFallback options.
+// It returns a function for stopping the watch that returns once the watch is stopped.
+func (c *controller) watchFiles(config sync.Locker) (func(), error) {
+	if c.pollInterval > 0 && !c.pollFallback {
+		return c.pollFiles(c.getFilePaths(), func(paths []string) {
+			c.reloadFiles(config, paths)
+		}), nil
+	}
+
+	stop, err := c.watchFileEvents(c.getFilePaths(), func(paths []string) {
+		c.reloadFiles(config, paths)
+	})
+	if err != nil && c.pollFallback {
+		c.log(1, "falling back to polling files: %s", err)
+		return c.pollFiles(c.getFilePaths(), func(paths []string) {
+			c.reloadFiles(config, paths)
+		}), nil
+	}
+
+	return stop, err
+}
+
+// getFilePaths returns the sorted paths of all files that values of fields are read from.
+func (c *controller) getFilePaths() []string {
+	paths := make([]string, 0, len(c.filesToFields))
+	for path := range c.filesToFields {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	return paths
+}
+
+// watchFileEvents watches a list of files using file system notifications and calls a function with all files changed together.
+// Parent directories are watched instead of the files themselves, since files can be replaced without being written.
+// For example, editors replace files by renaming a temporary file and
+// Kubernetes updates mounted ConfigMaps and Secrets by atomically swapping a ..data symlink.
+// Symlinks are resolved, so the directories of the files they point to are watched too.
+// It returns a function for stopping the watch that returns once the watch is stopped.
+func (c *controller) watchFileEvents(files []string, changed func(paths []string)) (func(), error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		c.log(1, "cannot create a watcher: %s", err)
+		return nil, err
+	}
+
+	// realPaths keeps the resolved path for every file, so a change to the target of a symlink can be detected
+	realPaths := map[string]string{}
+
+	for _, path := range files {
+		if err := c.watchDir(watcher, filepath.Dir(path)); err != nil {
+			c.log(1, "cannot watch file %s: %s", path, err)
+			watcher.Close()
+			return nil, err
+		}
+
+		realPaths[path] = c.watchRealPath(watcher, path)
+	}
+
+	stopping := make(chan struct{})
+	done := make(chan struct{})
+
+	// closed reports an error if the watcher is closed without being stopped
+	closed := func() {
+		select {
+		case <-stopping:
+		default:
+			c.fail(errors.New("file watcher closed unexpectedly"))
+		}
+	}
+
+	// Changes to a file written in several chunks are applied once
+	deb := newDebouncer(c.debounce)
+
+	go func() {
+		defer close(done)
+		defer deb.stop()
+
+		for {
+			select {
+			case <-deb.C():
+				if paths := deb.due(); len(paths) > 0 {
+					changed(paths)
+				}
+			case event, ok := <-watcher.Events:
+				if !ok {
+					closed()
+					return
+				}
+
+				if event.Op == fsnotify.Chmod {
+					continue
+				}
+
+				// All files affected by one event (i.e. a symlink swap) are reloaded in one batch
+				paths := []string{}
+
+				name := filepath.Clean(event.Name)
+				dir := filepath.Dir(name)
+				for path, realPath := range realPaths {
+					// The directory of the file or one of its parent directories is created or removed
+					if isDirOrParent(name, filepath.Dir(path)) && event.Op&(fsnotify.Create|fsnotify.Remove|fsnotify.Rename) > 0 {
+						if err := c.watchDir(watcher, filepath.Dir(path)); err != nil {
+							c.log(1, "cannot watch file %s: %s", path, err)
+						}
+						realPaths[path] = c.watchRealPath(watcher, path)
+						paths = append(paths, path)
+						continue
+					}
+
+					if dir != filepath.Dir(path) && dir != filepath.Dir(realPath) {
+						continue
+					}
+
+					newRealPath, err := filepath.EvalSymlinks(path)
+					if err != nil {
+						// The file is deleted
+						if os.IsNotExist(err) && (name == filepath.Clean(path) || name == realPath) {
+							paths = append(paths, path)
+						}
+						continue
+					}
+
+					if name != filepath.Clean(path) && name != realPath && newRealPath == realPath {
+						continue
+					}
+
+					if newRealPath != realPath {
+						c.log(3, "file %s now points to %s", path, newRealPath)
+						realPaths[path] = c.watchRealPath(watcher, path)
+					}
+
+					paths = append(paths, path)
+				}
+
+				if len(paths) > 0 {
+					sort.Strings(paths)
+					if paths = deb.add(paths); len(paths) > 0 {
+						changed(paths)
+					}
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					closed()
+					return
+				}
+				c.log(1, "error watching: %s", err)
+			}
+		}
+	}()
+
+	return func() {
+		close(stopping)
+		watcher.Close()
+		<-done
+	}, nil
+}
+
+// watchDir watches a directory or its closest existing parent directory if the directory does not exist yet,
+// so the directory is picked up once it is created.
+func (c *controller) watchDir(watcher *fsnotify.Watcher, dir string) error {
+	for {
+		err := watcher.Add(dir)
+		if err == nil || !os.IsNotExist(err) {
+			return err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return err
+		}
+
+		c.log(5, "directory %s does not exist, watching %s", dir, parent)
+		dir = parent
+	}
+}
+
+// isDirOrParent determines whether or not a path is a directory or one of the parent directories of the directory.
+func isDirOrParent(path, dir string) bool {
+	rel, err := filepath.Rel(path, dir)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// watchRealPath resolves the symlinks in the path of a file and watches the directory of the file it points to.
+// It returns the resolved path.
+func (c *controller) watchRealPath(watcher *fsnotify.Watcher, path string) string {
+	realPath, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return path
+	}
+
+	if dir := filepath.Dir(realPath); dir != filepath.Dir(path) {
+		// Watching the directory may fail if it is removed in the meantime and the next change will be picked up by the parent directory
+		if err := watcher.Add(dir); err != nil {
+			c.log(5, "cannot watch directory %s: %s", dir, err)
+		}
+	}
+
+	return realPath
+}
+
+// reloadFiles reads a list of files again and updates all fields read from the files with the new values in one batch.
+func (c *controller) reloadFiles(config sync.Locker, paths []string) {
+	updates := []fieldUpdate{}
+	contents := map[string][]byte{}
+
+	for _, path := range paths {
+		fields, ok := c.filesToFields[path]
+		if !ok {
+			continue
+		}
+
+		// A deleted file has no value anymore, so its fields fall back to values from other sources or their default values
+		b, err := c.getFS().ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			c.log(3, "file %s does not exist", path)
+			c.deleteFileHash(path)
+			for _, f := range fields {
+				if val, source, key := c.getFieldValue(f.Field); val != "" {
+					updates = append(updates, fieldUpdate{fieldInfo: f, val: val, source: source, key: key})
+				} else {
+					updates = append(updates, fieldUpdate{fieldInfo: f, source: sourceDefault, reset: true})
+				}
+			}
+			continue
+		}
+
+		if err != nil {
+			continue
+		}
+
+		// A file rewritten with the same content is not applied again
+		if !c.isFileChanged(path, b) {
+			c.log(5, "file %s is not changed", path)
+			continue
+		}
+
+		contents[path] = b
+		for _, f := range fields {
+			// An empty file (i.e. while being truncated and written) has no value, the same as when reading fields initially
+			if val := f.Trim.trim(string(b)); val != "" {
+				updates = append(updates, fieldUpdate{fieldInfo: f, val: val, source: sourceFile, key: path})
+			}
+		}
+	}
+
+	if len(updates) == 0 {
+		return
+	}
+
+	// A rolled back file is applied again if it is rewritten with the same content (i.e. once other fields are changed)
+	if err := c.updateFields(config, updates); err != nil {
+		return
+	}
+
+	for path, b := range contents {
+		c.setFileHash(path, b)
+	}
+}
+
+// watchSignals reloads all fields whenever one of the signals specified by ReloadOnSignal option is received.
+// It returns a function for stopping the watch that returns once the watch is stopped.
+func (c *controller) watchSignals(config sync.Locker) func() {
+	if len(c.reloadSignals) == 0 {
+		return func() {}
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, c.reloadSignals...)
+
+	stopping := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for {
+			select {
+			case sig := <-signals:
+				c.log(3, "received signal %s", sig)
+				c.reload(config)
+			case <-stopping:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(stopping)
+		<-done
+	}
+}
+
+// reload reads the values of all fields again from all sources and updates the fields with the new values in one batch.
+func (c *controller) reload(config sync.Locker) {
+	c.log(3, "reloading all fields ...")
+
+	// An invalid configuration file is not applied and fields keep the values read from the file previously
+	b, err := c.readFile()
+	if err != nil {
+		c.log(1, "%s", err)
+	}
+
+	// A rolled back file is applied again if it is rewritten with the same content
+	if err := c.reloadFields(config, c.fields, false); err == nil && b != nil {
+		c.setFileHash(c.file, b)
+	}
+}
+
+// isFileChanged determines whether or not the content of a file is different from the content applied the last time.
+func (c *controller) isFileChanged(path string, b []byte) bool {
+	c.fileHashesLock.Lock()
+	defer c.fileHashesLock.Unlock()
+
+	last, ok := c.fileHashes[path]
+	return !ok || last != sha256.Sum256(b)
+}
+
+// setFileHash keeps the hash of the content of a file applied.
+func (c *controller) setFileHash(path string, b []byte) {
+	c.fileHashesLock.Lock()
+	defer c.fileHashesLock.Unlock()
+
+	if c.fileHashes == nil {
+		c.fileHashes = map[string][sha256.Size]byte{}
+	}
+
+	c.fileHashes[path] = sha256.Sum256(b)
+}
+
+// deleteFileHash removes the hash of the content of a deleted file, so the file is applied once it is created again.
+func (c *controller) deleteFileHash(path string) {
+	c.fileHashesLock.Lock()
+	defer c.fileHashesLock.Unlock()
+
+	delete(c.fileHashes, path)
+}
@@ -0,0 +1,740 @@
+package konfig
+
+import (
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// writeAtomicDir mimics how Kubernetes writes a ConfigMap or Secret volume.
+// Files are written to a new timestamped directory and the ..data symlink is atomically swapped to point to it.
+func writeAtomicDir(t *testing.T, dir, version string, files map[string]string) {
+	tsDir := filepath.Join(dir, ".."+version)
+	assert.NoError(t, os.Mkdir(tsDir, 0755))
+
+	for name, content := range files {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(tsDir, name), []byte(content), 0644))
+
+		// The user-visible files are symlinks to the files behind ..data symlink
+		link := filepath.Join(dir, name)
+		if _, err := os.Lstat(link); os.IsNotExist(err) {
+			assert.NoError(t, os.Symlink(filepath.Join("..data", name), link))
+		}
+	}
+
+	oldDir, _ := os.Readlink(filepath.Join(dir, "..data"))
+
+	tmpLink := filepath.Join(dir, "..data_tmp")
+	assert.NoError(t, os.Symlink(filepath.Base(tsDir), tmpLink))
+	assert.NoError(t, os.Rename(tmpLink, filepath.Join(dir, "..data")))
+
+	if oldDir != "" {
+		assert.NoError(t, os.RemoveAll(filepath.Join(dir, oldDir)))
+	}
+}
+
+func TestWatchFiles(t *testing.T) {
+	tests := []struct {
+		name          string
+		setup         func(t *testing.T, dir string) string
+		update        func(t *testing.T, dir string)
+		expectedValue string
+	}{
+		{
+			name: "Write",
+			setup: func(t *testing.T, dir string) string {
+				path := filepath.Join(dir, "token")
+				assert.NoError(t, ioutil.WriteFile(path, []byte("old-token"), 0644))
+				return path
+			},
+			update: func(t *testing.T, dir string) {
+				assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "token"), []byte("new-token"), 0644))
+			},
+			expectedValue: "new-token",
+		},
+		{
+			name: "Rename",
+			setup: func(t *testing.T, dir string) string {
+				path := filepath.Join(dir, "token")
+				assert.NoError(t, ioutil.WriteFile(path, []byte("old-token"), 0644))
+				return path
+			},
+			update: func(t *testing.T, dir string) {
+				tmpPath := filepath.Join(dir, "token.tmp")
+				assert.NoError(t, ioutil.WriteFile(tmpPath, []byte("new-token"), 0644))
+				assert.NoError(t, os.Rename(tmpPath, filepath.Join(dir, "token")))
+			},
+			expectedValue: "new-token",
+		},
+		{
+			name: "SymlinkSwap",
+			setup: func(t *testing.T, dir string) string {
+				writeAtomicDir(t, dir, "2020_01_01", map[string]string{"token": "old-token"})
+				return filepath.Join(dir, "token")
+			},
+			update: func(t *testing.T, dir string) {
+				writeAtomicDir(t, dir, "2020_01_02", map[string]string{"token": "new-token"})
+			},
+			expectedValue: "new-token",
+		},
+		{
+			name: "SymlinkSwapTwice",
+			setup: func(t *testing.T, dir string) string {
+				writeAtomicDir(t, dir, "2020_01_01", map[string]string{"token": "old-token"})
+				return filepath.Join(dir, "token")
+			},
+			update: func(t *testing.T, dir string) {
+				writeAtomicDir(t, dir, "2020_01_02", map[string]string{"token": "new-token"})
+				time.Sleep(100 * time.Millisecond)
+				writeAtomicDir(t, dir, "2020_01_03", map[string]string{"token": "newer-token"})
+			},
+			expectedValue: "newer-token",
+		},
+		{
+			name: "Created",
+			setup: func(t *testing.T, dir string) string {
+				return filepath.Join(dir, "token")
+			},
+			update: func(t *testing.T, dir string) {
+				assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "token"), []byte("new-token"), 0644))
+			},
+			expectedValue: "new-token",
+		},
+		{
+			name: "CreatedWithDirectory",
+			setup: func(t *testing.T, dir string) string {
+				return filepath.Join(dir, "secrets", "app", "token")
+			},
+			update: func(t *testing.T, dir string) {
+				assert.NoError(t, os.MkdirAll(filepath.Join(dir, "secrets", "app"), 0755))
+				time.Sleep(100 * time.Millisecond)
+				assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "secrets", "app", "token"), []byte("new-token"), 0644))
+			},
+			expectedValue: "new-token",
+		},
+		{
+			name: "Deleted",
+			setup: func(t *testing.T, dir string) string {
+				path := filepath.Join(dir, "token")
+				assert.NoError(t, ioutil.WriteFile(path, []byte("old-token"), 0644))
+				return path
+			},
+			update: func(t *testing.T, dir string) {
+				assert.NoError(t, os.Remove(filepath.Join(dir, "token")))
+			},
+			expectedValue: "default-token",
+		},
+		{
+			name: "DeletedDirectory",
+			setup: func(t *testing.T, dir string) string {
+				path := filepath.Join(dir, "secrets", "token")
+				assert.NoError(t, os.Mkdir(filepath.Join(dir, "secrets"), 0755))
+				assert.NoError(t, ioutil.WriteFile(path, []byte("old-token"), 0644))
+				return path
+			},
+			update: func(t *testing.T, dir string) {
+				assert.NoError(t, os.RemoveAll(filepath.Join(dir, "secrets")))
+			},
+			expectedValue: "default-token",
+		},
+		{
+			name: "DeletedAndCreatedAgain",
+			setup: func(t *testing.T, dir string) string {
+				path := filepath.Join(dir, "secrets", "token")
+				assert.NoError(t, os.Mkdir(filepath.Join(dir, "secrets"), 0755))
+				assert.NoError(t, ioutil.WriteFile(path, []byte("old-token"), 0644))
+				return path
+			},
+			update: func(t *testing.T, dir string) {
+				assert.NoError(t, os.RemoveAll(filepath.Join(dir, "secrets")))
+				time.Sleep(100 * time.Millisecond)
+				assert.NoError(t, os.Mkdir(filepath.Join(dir, "secrets"), 0755))
+				time.Sleep(100 * time.Millisecond)
+				assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "secrets", "token"), []byte("new-token"), 0644))
+			},
+			expectedValue: "new-token",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "gotest_")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			path := tc.setup(t, dir)
+
+			// Both fields are read from the same file
+			cfg := &struct {
+				sync.Mutex
+				Token    string
+				APIToken string
+			}{
+				Token:    "old-token",
+				APIToken: "old-token",
+			}
+
+			ch := make(chan Update, 10)
+			c := &controller{
+				args:        []string{},
+				subscribers: []chan Update{ch},
+				filesToFields: map[string][]fieldInfo{
+					path: {
+						{
+							Field: Field{Name: "Token"},
+							v:     reflect.ValueOf(cfg).Elem().FieldByName("Token"),
+							def:   reflect.ValueOf("default-token"),
+						},
+						{
+							Field: Field{Name: "APIToken"},
+							v:     reflect.ValueOf(cfg).Elem().FieldByName("APIToken"),
+							def:   reflect.ValueOf("default-token"),
+						},
+					},
+				},
+			}
+
+			stop, err := c.watchFiles(cfg)
+			assert.NoError(t, err)
+			defer stop()
+
+			tc.update(t, dir)
+
+			notified := map[string]bool{}
+			timeout := time.After(2 * time.Second)
+			for !notified["Token"] || !notified["APIToken"] {
+				select {
+				case update := <-ch:
+					if update.Value == tc.expectedValue {
+						notified[update.Name] = true
+					}
+				case <-timeout:
+					t.Fatalf("timed out waiting for updates to %q", tc.expectedValue)
+				}
+			}
+
+			cfg.Lock()
+			assert.Equal(t, tc.expectedValue, cfg.Token)
+			assert.Equal(t, tc.expectedValue, cfg.APIToken)
+			cfg.Unlock()
+		})
+	}
+}
+
+func TestWatchFilesChangeSet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotest_")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	writeAtomicDir(t, dir, "2020_01_01", map[string]string{"log_level": "info", "port": "8080"})
+
+	cfg := &struct {
+		sync.Mutex
+		LogLevel string
+		Port     int
+	}{
+		LogLevel: "info",
+		Port:     8080,
+	}
+
+	cs := make(chan ChangeSet, 10)
+	c := &controller{
+		changeSets: []chan ChangeSet{cs},
+		filesToFields: map[string][]fieldInfo{
+			filepath.Join(dir, "log_level"): {
+				{
+					Field: Field{Name: "LogLevel"},
+					v:     reflect.ValueOf(cfg).Elem().FieldByName("LogLevel"),
+				},
+			},
+			filepath.Join(dir, "port"): {
+				{
+					Field: Field{Name: "Port"},
+					v:     reflect.ValueOf(cfg).Elem().FieldByName("Port"),
+				},
+			},
+		},
+	}
+
+	stop, err := c.watchFiles(cfg)
+	assert.NoError(t, err)
+	defer stop()
+
+	// Both files are updated by one symlink swap
+	writeAtomicDir(t, dir, "2020_01_02", map[string]string{"log_level": "debug", "port": "9090"})
+
+	select {
+	case changeSet := <-cs:
+		values := map[string]interface{}{}
+		for _, update := range changeSet.Updates {
+			values[update.Name] = update.Value
+		}
+		assert.Equal(t, map[string]interface{}{"LogLevel": "debug", "Port": 9090}, values)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for change set")
+	}
+
+	cfg.Lock()
+	assert.Equal(t, "debug", cfg.LogLevel)
+	assert.Equal(t, 9090, cfg.Port)
+	cfg.Unlock()
+}
+
+func TestWatchSignals(t *testing.T) {
+	tests := []struct {
+		name          string
+		signals       []os.Signal
+		signal        syscall.Signal
+		expectedValue string
+	}{
+		{
+			name:          "NoSignal",
+			signals:       nil,
+			signal:        syscall.Signal(0),
+			expectedValue: "info",
+		},
+		{
+			name:          "SIGHUP",
+			signals:       []os.Signal{syscall.SIGHUP},
+			signal:        syscall.SIGHUP,
+			expectedValue: "debug",
+		},
+		{
+			name:          "SIGUSR1",
+			signals:       []os.Signal{syscall.SIGUSR1},
+			signal:        syscall.SIGUSR1,
+			expectedValue: "debug",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := &struct {
+				sync.Mutex
+				LogLevel string
+			}{
+				LogLevel: "info",
+			}
+
+			ch := make(chan Update, 1)
+			c := &controller{
+				args: []string{},
+				lookupEnv: func(name string) (string, bool) {
+					if name == "LOG_LEVEL" {
+						return "debug", true
+					}
+					return "", false
+				},
+				reloadSignals: tc.signals,
+				subscribers:   []chan Update{ch},
+				fields: []fieldInfo{
+					{
+						Field: Field{Name: "LogLevel", EnvName: "LOG_LEVEL"},
+						v:     reflect.ValueOf(cfg).Elem().FieldByName("LogLevel"),
+					},
+				},
+			}
+
+			stop := c.watchSignals(cfg)
+			defer stop()
+
+			// Signal 0 only checks the process exists
+			assert.NoError(t, syscall.Kill(os.Getpid(), tc.signal))
+
+			if tc.signal != 0 {
+				select {
+				case update := <-ch:
+					assert.Equal(t, tc.expectedValue, update.Value)
+				case <-time.After(2 * time.Second):
+					t.Fatal("timed out waiting for update")
+				}
+			}
+
+			cfg.Lock()
+			assert.Equal(t, tc.expectedValue, cfg.LogLevel)
+			cfg.Unlock()
+		})
+	}
+}
+
+func TestWatchFilesPolling(t *testing.T) {
+	tests := []struct {
+		name         string
+		pollFallback bool
+		path         func(dir string) string
+		update       func(t *testing.T, dir string)
+	}{
+		{
+			name:         "Polling",
+			pollFallback: false,
+			path: func(dir string) string {
+				return filepath.Join(dir, "token")
+			},
+			update: func(t *testing.T, dir string) {
+				assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "token"), []byte("new-token"), 0644))
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "gotest_")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			path := tc.path(dir)
+			if !tc.pollFallback {
+				assert.NoError(t, ioutil.WriteFile(path, []byte("old-token"), 0644))
+			}
+
+			cfg := &struct {
+				sync.Mutex
+				Token string
+			}{
+				Token: "old-token",
+			}
+
+			ch := make(chan Update, 10)
+			c := &controller{
+				pollInterval: 20 * time.Millisecond,
+				pollFallback: tc.pollFallback,
+				subscribers:  []chan Update{ch},
+				filesToFields: map[string][]fieldInfo{
+					path: {
+						{
+							Field: Field{Name: "Token"},
+							v:     reflect.ValueOf(cfg).Elem().FieldByName("Token"),
+						},
+					},
+				},
+			}
+
+			stop, err := c.watchFiles(cfg)
+			assert.NoError(t, err)
+			defer stop()
+
+			tc.update(t, dir)
+
+			select {
+			case update := <-ch:
+				assert.Equal(t, "new-token", update.Value)
+				assert.Equal(t, path, update.Key)
+			case <-time.After(2 * time.Second):
+				t.Fatal("timed out waiting for update")
+			}
+
+			cfg.Lock()
+			assert.Equal(t, "new-token", cfg.Token)
+			cfg.Unlock()
+		})
+	}
+}
+
+func TestWatchFilesPollingFallback(t *testing.T) {
+	tests := []struct {
+		name          string
+		pollInterval  time.Duration
+		pollFallback  bool
+		expectedError bool
+	}{
+		{
+			name:          "NoFallback",
+			pollInterval:  0,
+			pollFallback:  false,
+			expectedError: true,
+		},
+		{
+			name:          "Fallback",
+			pollInterval:  20 * time.Millisecond,
+			pollFallback:  true,
+			expectedError: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "gotest_")
+			assert.NoError(t, err)
+			defer os.RemoveAll(dir)
+
+			// Watching a directory under a regular file fails
+			assert.NoError(t, ioutil.WriteFile(filepath.Join(dir, "file"), []byte(""), 0644))
+
+			c := &controller{
+				pollInterval: tc.pollInterval,
+				pollFallback: tc.pollFallback,
+				filesToFields: map[string][]fieldInfo{
+					filepath.Join(dir, "file", "secrets", "token"): {},
+				},
+			}
+
+			stop, err := c.watchFiles(&sync.Mutex{})
+
+			if tc.expectedError {
+				assert.Error(t, err)
+				assert.Nil(t, stop)
+			} else {
+				assert.NoError(t, err)
+				assert.NotNil(t, stop)
+				stop()
+			}
+		})
+	}
+}
+
+func TestWatchMissingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotest_")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// The file is injected later (i.e. by a sidecar)
+	path := filepath.Join(dir, "secrets", "token")
+
+	env := map[string]string{
+		"TOKEN_FILE": path,
+	}
+
+	cfg := &struct {
+		sync.Mutex
+		Token string
+	}{
+		Token: "default-token",
+	}
+
+	ch := make(chan Update, 10)
+	close, err := New(
+		Args([]string{}),
+		LookupEnv(func(name string) (string, bool) {
+			val, ok := env[name]
+			return val, ok
+		}),
+		FlagSet(flag.NewFlagSet("app", flag.ContinueOnError)),
+	).Watch(cfg, []chan Update{ch})
+
+	assert.NoError(t, err)
+	defer close()
+
+	waitFor := func(value string) Update {
+		select {
+		case update := <-ch:
+			assert.Equal(t, value, update.Value)
+			return update
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for update to %q", value)
+			return Update{}
+		}
+	}
+
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "secrets"), 0755))
+	time.Sleep(100 * time.Millisecond)
+	assert.NoError(t, ioutil.WriteFile(path, []byte("secret"), 0644))
+
+	update := waitFor("secret")
+	assert.Equal(t, "default-token", update.OldValue)
+	assert.Equal(t, "file", update.Source)
+	assert.Equal(t, path, update.Key)
+
+	// The field falls back to its default value once the file is deleted
+	assert.NoError(t, os.Remove(path))
+
+	update = waitFor("default-token")
+	assert.Equal(t, "secret", update.OldValue)
+	assert.Equal(t, "default", update.Source)
+	assert.Equal(t, "", update.Key)
+
+	cfg.Lock()
+	assert.Equal(t, "default-token", cfg.Token)
+	cfg.Unlock()
+}
+
+type connsConfig struct {
+	sync.Mutex
+	MinConns int
+	MaxConns int
+}
+
+func (c *connsConfig) Validate() error {
+	if c.MaxConns < c.MinConns {
+		return errors.New("MaxConns must be at least MinConns")
+	}
+	return nil
+}
+
+func TestReloadFilesSameContent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotest_")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	minPath := filepath.Join(dir, "min_conns")
+	maxPath := filepath.Join(dir, "max_conns")
+	assert.NoError(t, ioutil.WriteFile(minPath, []byte("1"), 0644))
+	assert.NoError(t, ioutil.WriteFile(maxPath, []byte("10"), 0644))
+
+	cfg := &connsConfig{MinConns: 1, MaxConns: 10}
+
+	updates := map[string]interface{}{}
+	c := &controller{
+		watching: true,
+		handlers: []handler{
+			{f: func(update Update) { updates[update.Name] = update.Value }},
+		},
+		filesToFields: map[string][]fieldInfo{
+			minPath: {
+				{
+					Field: Field{Name: "MinConns"},
+					v:     reflect.ValueOf(cfg).Elem().FieldByName("MinConns"),
+				},
+			},
+			maxPath: {
+				{
+					Field: Field{Name: "MaxConns"},
+					v:     reflect.ValueOf(cfg).Elem().FieldByName("MaxConns"),
+				},
+			},
+		},
+	}
+
+	c.setFileHash(minPath, []byte("1"))
+	c.setFileHash(maxPath, []byte("10"))
+
+	expectUpdates := func(values map[string]interface{}) {
+		assert.Equal(t, values, updates)
+		updates = map[string]interface{}{}
+	}
+
+	// A file rewritten with the same content is not applied again
+	c.reloadFiles(cfg, []string{minPath, maxPath})
+	expectUpdates(map[string]interface{}{})
+
+	// A change failing the validation is rolled back
+	assert.NoError(t, ioutil.WriteFile(minPath, []byte("20"), 0644))
+	c.reloadFiles(cfg, []string{minPath})
+	expectUpdates(map[string]interface{}{})
+	assert.Equal(t, 1, cfg.MinConns)
+
+	// The rolled back file is applied again once the other field is changed
+	assert.NoError(t, ioutil.WriteFile(maxPath, []byte("30"), 0644))
+	c.reloadFiles(cfg, []string{maxPath})
+	expectUpdates(map[string]interface{}{"MaxConns": 30})
+
+	c.reloadFiles(cfg, []string{minPath})
+	expectUpdates(map[string]interface{}{"MinConns": 20})
+	assert.Equal(t, 20, cfg.MinConns)
+	assert.Equal(t, 30, cfg.MaxConns)
+}
+
+func TestWatchFilesDebounce(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotest_")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "token")
+	assert.NoError(t, ioutil.WriteFile(path, []byte("old-token"), 0644))
+
+	cfg := &struct {
+		sync.Mutex
+		Token string
+	}{
+		Token: "old-token",
+	}
+
+	ch := make(chan Update, 10)
+	c := &controller{
+		debounce:    200 * time.Millisecond,
+		subscribers: []chan Update{ch},
+		filesToFields: map[string][]fieldInfo{
+			path: {
+				{
+					Field: Field{Name: "Token"},
+					v:     reflect.ValueOf(cfg).Elem().FieldByName("Token"),
+				},
+			},
+		},
+	}
+
+	stop, err := c.watchFiles(cfg)
+	assert.NoError(t, err)
+	defer stop()
+
+	// The file is written in several chunks
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0644)
+	assert.NoError(t, err)
+	for _, chunk := range []string{"new", "-", "token"} {
+		_, err = f.WriteString(chunk)
+		assert.NoError(t, err)
+		time.Sleep(20 * time.Millisecond)
+	}
+	assert.NoError(t, f.Close())
+
+	select {
+	case update := <-ch:
+		assert.Equal(t, "new-token", update.Value)
+		assert.Equal(t, "old-token", update.OldValue)
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for update")
+	}
+
+	// Rewriting the same content is not applied again
+	assert.NoError(t, ioutil.WriteFile(path, []byte("new-token"), 0644))
+
+	select {
+	case update := <-ch:
+		t.Fatalf("unexpected update: %v", update)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestReloadFilesTrim(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gotest_")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "port")
+
+	cfg := &struct {
+		sync.Mutex
+		Port   int
+		Banner string
+	}{
+		Port:   8080,
+		Banner: "8080",
+	}
+
+	c := &controller{
+		filesToFields: map[string][]fieldInfo{
+			path: {
+				{
+					Field: Field{Name: "Port"},
+					v:     reflect.ValueOf(cfg).Elem().FieldByName("Port"),
+				},
+				{
+					Field: Field{Name: "Banner", Trim: TrimNone},
+					v:     reflect.ValueOf(cfg).Elem().FieldByName("Banner"),
+				},
+			},
+		},
+	}
+
+	// A file written by echo is trimmed the same as when reading fields initially
+	assert.NoError(t, ioutil.WriteFile(path, []byte("9090\n"), 0644))
+	c.reloadFiles(cfg, []string{path})
+
+	assert.Equal(t, 9090, cfg.Port)
+	assert.Equal(t, "9090\n", cfg.Banner)
+
+	// A file with only a newline has no value for trimmed fields
+	assert.NoError(t, ioutil.WriteFile(path, []byte("\n"), 0644))
+	c.reloadFiles(cfg, []string{path})
+
+	assert.Equal(t, 9090, cfg.Port)
+	assert.Equal(t, "\n", cfg.Banner)
+}